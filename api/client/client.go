@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"os"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
@@ -10,10 +11,12 @@ import (
 	"general_ledger_golang/pkg/logger"
 )
 
+// AddHeaderInterceptor sends the service credentials, taken from SERVICE_NAME and SERVICE_TOKEN envs,
+// those should be in the ledger's SERVICE_TOKEN_WHITELIST.
 func AddHeaderInterceptor() grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
 		send, _ := metadata.FromOutgoingContext(ctx)
-		newMD := metadata.Pairs("authorization", "aDummyToken")
+		newMD := metadata.Pairs("x-service-name", os.Getenv("SERVICE_NAME"), "x-service-token", os.Getenv("SERVICE_TOKEN"))
 		ctx = metadata.NewOutgoingContext(ctx, metadata.Join(send, newMD))
 
 		return invoker(ctx, method, req, reply, cc, opts...)
@@ -42,7 +45,7 @@ func GetBalanceCall(c pb.LegerServiceClient) {
 		logger.Logger.Fatalf("Could not call get balance: %v\n", err)
 	}
 
-	logger.Logger.Infof("GetBalanceResp: %s\n", r.Balances)
+	logger.Logger.Infof("GetBalanceResp: %v\n", r.Balances)
 }
 
 func GetBookCall(c pb.LegerServiceClient) {
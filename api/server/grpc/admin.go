@@ -0,0 +1,60 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	proto "general_ledger_golang/api/proto/code/go"
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/service/posting_service"
+	"general_ledger_golang/service/reconcile_service"
+)
+
+// Reconcile recomputes the balances from postings and reports the drifts, with fix the drifted ones are rewritten.
+func (*Grpc) Reconcile(_ context.Context, req *proto.ReconcileReq) (*proto.ReconcileRes, error) {
+	reconcileService := reconcile_service.ReconcileService{}
+	report, err := reconcileService.Reconcile(req.Fix)
+	if err != nil {
+		logger.Logger.Errorf("Reconciliation failed, fix: %v, error: %+v", req.Fix, err)
+		return nil, e.GrpcInternalError("reconcileService.Reconcile", err, nil)
+	}
+
+	res := &proto.ReconcileRes{
+		CheckedAt: report.CheckedAt.Format(time.RFC3339Nano),
+		Checked:   int32(report.Checked),
+		Fixed:     report.Fixed,
+	}
+	for _, drift := range report.Drifts {
+		protoDrift := &proto.BalanceDrift{
+			BookId:        drift.BookId,
+			AssetId:       drift.AssetId,
+			OperationType: drift.OperationType,
+			Expected:      drift.Expected.String(),
+		}
+		if drift.Actual.Valid {
+			protoDrift.Actual = drift.Actual.Decimal.String()
+		}
+		res.Drifts = append(res.Drifts, protoDrift)
+	}
+	return res, nil
+}
+
+// VerifyPostingChain walks the hash chain of the postings of bookId (every book, if not given),
+// and reports the first broken link, if any.
+func (*Grpc) VerifyPostingChain(_ context.Context, req *proto.VerifyPostingChainReq) (*proto.VerifyPostingChainRes, error) {
+	postingService := posting_service.PostingService{}
+	report, err := postingService.VerifyChain(req.BookId)
+	if err != nil {
+		logger.Logger.Errorf("Chain verification failed, bookId: %s, error: %+v", req.BookId, err)
+		return nil, e.GrpcInternalError("postingService.VerifyChain", err, map[string]string{"bookId": req.BookId})
+	}
+
+	return &proto.VerifyPostingChainRes{
+		BookId:               report.BookId,
+		Checked:              int32(report.Checked),
+		Valid:                report.Valid,
+		FirstBrokenPostingId: report.FirstBrokenPostingId,
+		Reason:               report.Reason,
+	}, nil
+}
@@ -0,0 +1,134 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	proto "general_ledger_golang/api/proto/code/go"
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/service/asset_service"
+)
+
+func (*Grpc) CreateOrUpdateAsset(_ context.Context, req *proto.CreateOrUpdateAssetReq) (*proto.CreateOrUpdateAssetRes, error) {
+	minTransferAmount, err := toNullDecimal(req.MinTransferAmount)
+	if err != nil {
+		return nil, e.GrpcFieldNotFound("minTransferAmount is not a valid decimal.")
+	}
+	maxTransferAmount, err := toNullDecimal(req.MaxTransferAmount)
+	if err != nil {
+		return nil, e.GrpcFieldNotFound("maxTransferAmount is not a valid decimal.")
+	}
+
+	assetService := asset_service.AssetService{}
+	asset, operationMessage, err := assetService.CreateOrUpdateAsset(&models.Asset{
+		Code:              req.Code,
+		Name:              req.Name,
+		Scale:             req.Scale,
+		MinTransferAmount: minTransferAmount,
+		MaxTransferAmount: maxTransferAmount,
+	})
+	if errors.Is(err, asset_service.ErrInvalidAsset) {
+		return nil, e.GrpcFieldNotFound(err.Error())
+	}
+	if err != nil {
+		logger.Logger.Errorf("Asset creation failed: %+v", err)
+		return nil, e.GrpcInternalError("assetService.CreateOrUpdateAsset", err, map[string]string{"code": req.Code})
+	}
+
+	return &proto.CreateOrUpdateAssetRes{
+		Message: fmt.Sprintf("asset %s successful", operationMessage),
+		Asset:   toProtoAsset(asset),
+	}, nil
+}
+
+func (*Grpc) GetAsset(_ context.Context, req *proto.GetAssetReq) (*proto.GetAssetRes, error) {
+	if req.Code == "" {
+		return nil, e.GrpcFieldNotFound("code is required.")
+	}
+	assetService := asset_service.AssetService{}
+	asset, err := assetService.GetAsset(req.Code)
+	if err != nil {
+		return nil, e.GrpcInternalError("assetService.GetAsset", err, nil)
+	}
+	if asset == nil {
+		errMsg := fmt.Sprintf("Asset with code %s is not found", req.Code)
+		return nil, e.GrpcRecordNotFound(errMsg, "GetAsset", nil)
+	}
+
+	return &proto.GetAssetRes{
+		Asset: toProtoAsset(asset),
+	}, nil
+}
+
+func (*Grpc) ListAssets(_ context.Context, _ *proto.ListAssetsReq) (*proto.ListAssetsRes, error) {
+	assetService := asset_service.AssetService{}
+	assets, err := assetService.GetAssets()
+	if err != nil {
+		return nil, e.GrpcInternalError("assetService.GetAssets", err, nil)
+	}
+
+	var protoAssets []*proto.Asset
+	for i := range assets {
+		protoAssets = append(protoAssets, toProtoAsset(&assets[i]))
+	}
+	return &proto.ListAssetsRes{
+		Assets: protoAssets,
+	}, nil
+}
+
+func (*Grpc) DeleteAsset(_ context.Context, req *proto.DeleteAssetReq) (*proto.DeleteAssetRes, error) {
+	if req.Code == "" {
+		return nil, e.GrpcFieldNotFound("code is required.")
+	}
+	assetService := asset_service.AssetService{}
+	err := assetService.DeleteAsset(req.Code)
+	if errors.Is(err, asset_service.ErrAssetNotFound) {
+		errMsg := fmt.Sprintf("Asset with code %s is not found", req.Code)
+		return nil, e.GrpcRecordNotFound(errMsg, "DeleteAsset", nil)
+	}
+	if errors.Is(err, asset_service.ErrAssetInUse) {
+		return nil, e.GrpcFailedPrecondition(err.Error(), "DeleteAsset", map[string]string{"code": req.Code})
+	}
+	if err != nil {
+		return nil, e.GrpcInternalError("assetService.DeleteAsset", err, nil)
+	}
+
+	return &proto.DeleteAssetRes{
+		Message: "asset delete successful",
+	}, nil
+}
+
+func toProtoAsset(asset *models.Asset) *proto.Asset {
+	protoAsset := &proto.Asset{
+		Code:      asset.Code,
+		Name:      asset.Name,
+		Scale:     asset.Scale,
+		CreatedAt: asset.CreatedAt.Format(time.RFC3339Nano),
+		UpdatedAt: asset.UpdatedAt.Format(time.RFC3339Nano),
+	}
+	if asset.MinTransferAmount.Valid {
+		protoAsset.MinTransferAmount = asset.MinTransferAmount.Decimal.String()
+	}
+	if asset.MaxTransferAmount.Valid {
+		protoAsset.MaxTransferAmount = asset.MaxTransferAmount.Decimal.String()
+	}
+	return protoAsset
+}
+
+// toNullDecimal parses an optional decimal string, empty string is null.
+func toNullDecimal(value string) (decimal.NullDecimal, error) {
+	if value == "" {
+		return decimal.NullDecimal{}, nil
+	}
+	d, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.NullDecimal{}, err
+	}
+	return decimal.NullDecimal{Decimal: d, Valid: true}, nil
+}
@@ -0,0 +1,149 @@
+package grpc
+
+import (
+	"context"
+	"path"
+
+	"github.com/thoas/go-funk"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
+)
+
+// AuthTokenHeader is the metadata key carrying the Jwt of the admin rpcs, same as the X-Auth-Token header.
+const AuthTokenHeader = "x-auth-token"
+
+// adminMethods are the rpcs of the admin routes, those need a Jwt instead of the service credentials.
+var adminMethods = []string{"Reconcile", "VerifyPostingChain"}
+
+// methodPermissions is the permission each rpc needs, rpcs not listed here need operations:write.
+// Read permissions need a read (or write) token, others need a write token.
+var methodPermissions = map[string]auth_service.Permission{
+	"CreateOrUpdateBook":   auth_service.BooksWrite,
+	"GetBook":              auth_service.BooksRead,
+	"GetBookByName":        auth_service.BooksRead,
+	"GetBalance":           auth_service.BalancesRead,
+	"GetOperationByMemo":   auth_service.OperationsRead,
+	"ListOperations":       auth_service.OperationsRead,
+	"CreateOperation":      auth_service.OperationsWrite,
+	"CreateOperationBatch": auth_service.OperationsWrite,
+	"ReverseOperation":     auth_service.OperationsWrite,
+	"CreateOrUpdateAsset":  auth_service.AssetsWrite,
+	"GetAsset":             auth_service.AssetsRead,
+	"ListAssets":           auth_service.AssetsRead,
+	"DeleteAsset":          auth_service.AssetsWrite,
+	"ListPostings":         auth_service.PostingsRead,
+	"WatchBalances":        auth_service.BalancesRead,
+	"CreateHold":           auth_service.HoldsWrite,
+	"GetHold":              auth_service.HoldsRead,
+	"CaptureHold":          auth_service.HoldsWrite,
+	"ReleaseHold":          auth_service.HoldsWrite,
+	"GetTrialBalance":      auth_service.ReportsRead,
+	"GetBalanceSheet":      auth_service.ReportsRead,
+}
+
+// permissionOf returns the permission needed by fullMethod (ex: /ledger.LegerService/GetBalance).
+func permissionOf(fullMethod string) auth_service.Permission {
+	if permission, ok := methodPermissions[path.Base(fullMethod)]; ok {
+		return permission
+	}
+	return auth_service.OperationsWrite
+}
+
+// serviceNameOf returns the x-service-name metadata of the call, the interceptors have authenticated it already.
+func serviceNameOf(ctx context.Context) string {
+	return metadataOf(ctx, auth_service.ServiceNameHeader)
+}
+
+func metadataOf(ctx context.Context, key string) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// authenticate checks the x-service-name and x-service-token metadata of the call against the ServiceTokenWhitelist,
+// and the permission of fullMethod against the service's scope. Admin rpcs are checked for a Jwt instead.
+func authenticate(ctx context.Context, fullMethod string) error {
+	if funk.ContainsString(adminMethods, path.Base(fullMethod)) {
+		return authenticateAdmin(ctx, fullMethod)
+	}
+	serviceName := serviceNameOf(ctx)
+	token := metadataOf(ctx, auth_service.ServiceTokenHeader)
+	if serviceName == "" || token == "" {
+		logger.Logger.Warnf("Call to %s without service credentials", fullMethod)
+		return status.Errorf(codes.Unauthenticated, "%s and %s metadata are required", auth_service.ServiceNameHeader, auth_service.ServiceTokenHeader)
+	}
+
+	permission := permissionOf(fullMethod)
+	checkType := permission.CheckType()
+	auth := auth_service.Auth{ServiceName: serviceName, ServiceToken: token}
+	if !auth.Check(token, checkType, serviceName) {
+		logger.Logger.Warnf("Service %q is not authorized to %s %s", serviceName, checkType, fullMethod)
+		return status.Errorf(codes.Unauthenticated, "invalid %s token of service %s", checkType, serviceName)
+	}
+	if err := auth.Authorize(permission); err != nil {
+		return e.GrpcPermissionDenied(err.Error(), fullMethod, map[string]string{"service": serviceName})
+	}
+	return nil
+}
+
+// authenticateAdmin checks the x-auth-token metadata of the call, it should be a valid Jwt.
+func authenticateAdmin(ctx context.Context, fullMethod string) error {
+	token := metadataOf(ctx, AuthTokenHeader)
+	if token == "" {
+		logger.Logger.Warnf("Call to %s without a Jwt", fullMethod)
+		return status.Errorf(codes.Unauthenticated, "%s metadata is required", AuthTokenHeader)
+	}
+	if _, err := util.ParseToken(token); err != nil {
+		logger.Logger.Warnf("Call to %s with an invalid Jwt, error: %v", fullMethod, err)
+		return status.Errorf(codes.Unauthenticated, "invalid %s", AuthTokenHeader)
+	}
+	return nil
+}
+
+// authorizeBook checks the permission on bookId against the calling service's scope.
+func authorizeBook(ctx context.Context, permission auth_service.Permission, bookId string) error {
+	auth := auth_service.Auth{ServiceName: serviceNameOf(ctx)}
+	if err := auth.AuthorizeBook(permission, bookId); err != nil {
+		return e.GrpcPermissionDenied(err.Error(), string(permission), map[string]string{"bookId": bookId})
+	}
+	return nil
+}
+
+// authorizeAllBooks checks the permission across all the books against the calling service's scope.
+func authorizeAllBooks(ctx context.Context, permission auth_service.Permission) error {
+	auth := auth_service.Auth{ServiceName: serviceNameOf(ctx)}
+	if err := auth.AuthorizeAllBooks(permission); err != nil {
+		return e.GrpcPermissionDenied(err.Error(), string(permission), nil)
+	}
+	return nil
+}
+
+// AuthUnaryInterceptor rejects unary calls without a valid service token, with Unauthenticated.
+func AuthUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := authenticate(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamInterceptor rejects streaming calls without a valid service token, with Unauthenticated.
+func AuthStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authenticate(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
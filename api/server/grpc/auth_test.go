@@ -0,0 +1,61 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	asrt "github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
+)
+
+func TestPermissionOf(t *testing.T) {
+	assert := asrt.New(t)
+
+	assert.Equal(auth_service.BalancesRead, permissionOf("/ledger.LegerService/GetBalance"))
+	assert.Equal(auth_service.READ, permissionOf("/ledger.LegerService/WatchBalances").CheckType())
+	assert.Equal(auth_service.WRITE, permissionOf("/ledger.LegerService/CreateOperation").CheckType())
+	// unknown rpcs need a write token.
+	assert.Equal(auth_service.OperationsWrite, permissionOf("/ledger.LegerService/SomethingNew"))
+}
+
+func TestAuthenticate(t *testing.T) {
+	assert := asrt.New(t)
+
+	err := authenticate(context.Background(), "/ledger.LegerService/GetBalance")
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(auth_service.ServiceNameHeader, "user_module"))
+	err = authenticate(ctx, "/ledger.LegerService/GetBalance")
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	// config is not set up, no token is allowed.
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(auth_service.ServiceNameHeader, "user_module", auth_service.ServiceTokenHeader, "abc"))
+	err = authenticate(ctx, "/ledger.LegerService/GetBalance")
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func TestAuthenticateAdmin(t *testing.T) {
+	assert := asrt.New(t)
+
+	// service credentials don't do for the admin rpcs.
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(auth_service.ServiceNameHeader, "user_module", auth_service.ServiceTokenHeader, "abc"))
+	err := authenticate(ctx, "/ledger.LegerService/Reconcile")
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(AuthTokenHeader, "not-a-jwt"))
+	err = authenticate(ctx, "/ledger.LegerService/VerifyPostingChain")
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	token, err := util.GenerateToken("admin", "secret")
+	assert.NoError(err)
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(AuthTokenHeader, token))
+	assert.NoError(authenticate(ctx, "/ledger.LegerService/Reconcile"))
+	// a Jwt is not a service credential.
+	err = authenticate(ctx, "/ledger.LegerService/GetBalance")
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+}
@@ -23,7 +23,7 @@ func RegisterGrpcServer(grpcPort int) {
 		logger.Logger.Fatalf("failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer()
+	s := grpc.NewServer(grpc.UnaryInterceptor(AuthUnaryInterceptor()), grpc.StreamInterceptor(AuthStreamInterceptor()))
 	pb.RegisterLegerServiceServer(s, &Grpc{})
 	logger.Logger.Infof("Grpc server listening at %v", lis.Addr())
 
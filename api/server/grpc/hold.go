@@ -0,0 +1,156 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+
+	proto "general_ledger_golang/api/proto/code/go"
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
+	"general_ledger_golang/service/hold_service"
+	"general_ledger_golang/service/operation_service"
+)
+
+func (*Grpc) CreateHold(ctx context.Context, req *proto.CreateHoldReq) (*proto.CreateHoldRes, error) {
+	amount, err := decimal.NewFromString(req.Amount)
+	if err != nil {
+		return nil, e.GrpcFieldNotFound("amount is not a valid decimal.")
+	}
+	expiresAt, err := util.ParseOptionalTime(req.ExpiresAt)
+	if err != nil {
+		return nil, e.GrpcFieldNotFound("expiresAt should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z")
+	}
+
+	holdService := hold_service.HoldService{ServiceName: serviceNameOf(ctx)}
+	hold, err := holdService.CreateHold(req.Memo, req.BookId, req.AssetId, amount, expiresAt, toMetadataInterface(req.Metadata))
+	if err != nil {
+		return nil, holdError("CreateHold", err, req.Memo)
+	}
+
+	return &proto.CreateHoldRes{
+		Hold: toProtoHold(hold),
+	}, nil
+}
+
+func (*Grpc) GetHold(ctx context.Context, req *proto.GetHoldReq) (*proto.GetHoldRes, error) {
+	if req.Memo == "" {
+		return nil, e.GrpcFieldNotFound("memo is required.")
+	}
+	holdService := hold_service.HoldService{ServiceName: serviceNameOf(ctx)}
+	hold, err := holdService.GetHold(req.Memo)
+	if errors.Is(err, auth_service.ErrForbidden) {
+		return nil, e.GrpcPermissionDenied(err.Error(), "GetHold", map[string]string{"memo": req.Memo})
+	}
+	if err != nil {
+		return nil, e.GrpcInternalError("holdService.GetHold", err, nil)
+	}
+	if hold == nil {
+		errMsg := fmt.Sprintf("Hold with memo %s is not found", req.Memo)
+		return nil, e.GrpcRecordNotFound(errMsg, "GetHold", nil)
+	}
+
+	return &proto.GetHoldRes{
+		Hold: toProtoHold(hold),
+	}, nil
+}
+
+// CaptureHold captures the hold into an operation, amount is optional, the remaining held amount is captured by default.
+func (*Grpc) CaptureHold(ctx context.Context, req *proto.CaptureHoldReq) (*proto.CaptureHoldRes, error) {
+	if req.Memo == "" || req.OperationMemo == "" || req.ToBookId == "" || req.Type == "" {
+		return nil, e.GrpcFieldNotFound("memo, operationMemo, toBookId and type are required.")
+	}
+	amount, err := toNullDecimal(req.Amount)
+	if err != nil {
+		return nil, e.GrpcFieldNotFound("amount is not a valid decimal.")
+	}
+
+	holdService := hold_service.HoldService{ServiceName: serviceNameOf(ctx)}
+	hold, operation, err := holdService.CaptureHold(req.Memo, amount, req.OperationMemo, req.ToBookId, req.Type, toMetadataInterface(req.Metadata))
+	if err != nil {
+		return nil, holdError("CaptureHold", err, req.Memo)
+	}
+
+	protoOperation, err := toProtoOperation(&operation_service.OperationService{}, operation)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.CaptureHoldRes{
+		Hold:      toProtoHold(hold),
+		Operation: protoOperation,
+	}, nil
+}
+
+func (*Grpc) ReleaseHold(ctx context.Context, req *proto.ReleaseHoldReq) (*proto.ReleaseHoldRes, error) {
+	if req.Memo == "" {
+		return nil, e.GrpcFieldNotFound("memo is required.")
+	}
+	holdService := hold_service.HoldService{ServiceName: serviceNameOf(ctx)}
+	hold, err := holdService.ReleaseHold(req.Memo)
+	if err != nil {
+		return nil, holdError("ReleaseHold", err, req.Memo)
+	}
+
+	return &proto.ReleaseHoldRes{
+		Hold: toProtoHold(hold),
+	}, nil
+}
+
+// holdError maps the errors of the hold service to grpc errors, same as the http status of the hold routes.
+func holdError(method string, err error, memo string) error {
+	metadata := map[string]string{"memo": memo}
+	switch {
+	case errors.Is(err, auth_service.ErrForbidden):
+		return e.GrpcPermissionDenied(err.Error(), method, metadata)
+	case errors.Is(err, hold_service.ErrInvalidHold), errors.Is(err, models.ErrInvalidOperation):
+		return e.GrpcFieldNotFound(err.Error())
+	case errors.Is(err, hold_service.ErrHoldNotFound):
+		return e.GrpcRecordNotFound(err.Error(), method, metadata)
+	case errors.Is(err, operation_service.ErrIdempotencyConflict):
+		return e.GrpcAlreadyExists(err.Error(), method, metadata)
+	case errors.Is(err, hold_service.ErrHoldNotActive), errors.Is(err, hold_service.ErrHoldExpired), errors.Is(err, hold_service.ErrCaptureExceedsHold),
+		errors.Is(err, hold_service.ErrInsufficientFunds), errors.Is(err, hold_service.ErrCaptureRejected):
+		return e.GrpcFailedPrecondition(err.Error(), method, metadata)
+	default:
+		logger.Logger.Errorf("Hold request failed, memo: %s, error: %+v", memo, err)
+		return e.GrpcInternalError("holdService."+method, err, metadata)
+	}
+}
+
+func toProtoHold(hold map[string]interface{}) *proto.Hold {
+	metadata, err := util.InterfaceToMapOfString(hold["metadata"])
+	if err != nil {
+		logger.Logger.Errorf("converting metadata to map of string failed, hold: %+v, err: %+v", hold, err)
+	}
+
+	protoHold := &proto.Hold{
+		Memo:           fmt.Sprint(hold["memo"]),
+		BookId:         fmt.Sprint(hold["bookId"]),
+		AssetId:        fmt.Sprint(hold["assetId"]),
+		Amount:         fmt.Sprint(hold["amount"]),
+		CapturedAmount: fmt.Sprint(hold["capturedAmount"]),
+		ReleasedAmount: fmt.Sprint(hold["releasedAmount"]),
+		Status:         fmt.Sprint(hold["status"]),
+		Metadata:       metadata,
+		CreatedAt:      fmt.Sprint(hold["createdAt"]),
+		UpdatedAt:      fmt.Sprint(hold["updatedAt"]),
+	}
+	if expiresAt, ok := hold["expiresAt"].(string); ok {
+		protoHold.ExpiresAt = expiresAt
+	}
+	return protoHold
+}
+
+// toMetadataInterface converts the metadata of a request to the map the services take.
+func toMetadataInterface(metadata map[string]string) map[string]interface{} {
+	metadataInterface := map[string]interface{}{}
+	for key, value := range metadata {
+		metadataInterface[key] = value
+	}
+	return metadataInterface
+}
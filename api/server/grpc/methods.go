@@ -3,7 +3,10 @@ package grpc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/datatypes"
@@ -13,20 +16,77 @@ import (
 	"general_ledger_golang/pkg/e"
 	"general_ledger_golang/pkg/logger"
 	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
 	"general_ledger_golang/service/operation_service"
 
 	"general_ledger_golang/service/book_service"
 )
 
-func (*Grpc) GetBook(_ context.Context, req *proto.GetBookReq) (res *proto.GetBookRes, err error) {
+func (*Grpc) GetBook(ctx context.Context, req *proto.GetBookReq) (res *proto.GetBookRes, err error) {
+	if req.BookId == "" {
+		return nil, e.GrpcFieldNotFound("bookId is required.")
+	}
+	if err = authorizeBook(ctx, auth_service.BooksRead, req.BookId); err != nil {
+		return nil, err
+	}
+	if req.Balance {
+		if err = authorizeBook(ctx, auth_service.BalancesRead, req.BookId); err != nil {
+			return nil, err
+		}
+	}
 	bookService := book_service.BookService{}
 
-	result, err := bookService.GetBook(req.BookId, false)
+	result, err := bookService.GetBook(req.BookId, req.Balance)
 	if err != nil {
 		logger.Logger.Infof("Error Occured while calling bookService.GetBook, req: %+v, err: %+v", req, err)
+		return nil, e.GrpcInternalError("bookService.GetBook", err, map[string]string{"bookId": req.BookId})
+	}
+	if result == nil {
+		errMsg := fmt.Sprintf("Book with id %s is not found", req.BookId)
+		return nil, e.GrpcRecordNotFound(errMsg, "GetBook", nil)
+	}
+
+	return toProtoBookRes(result)
+}
+
+// GetBookByName returns the book with the given name, same as GetBook.
+func (*Grpc) GetBookByName(ctx context.Context, req *proto.GetBookByNameReq) (*proto.GetBookRes, error) {
+	if req.Name == "" {
+		return nil, e.GrpcFieldNotFound("name is required.")
+	}
+	bookService := book_service.BookService{}
+
+	result, err := bookService.GetBookByName(req.Name, req.Balance)
+	if err != nil {
+		logger.Logger.Infof("Error Occured while calling bookService.GetBookByName, req: %+v, err: %+v", req, err)
+		return nil, e.GrpcInternalError("bookService.GetBookByName", err, map[string]string{"name": req.Name})
+	}
+	if result == nil {
+		// a service limited to some books is denied, same as for a book out of its scope, so that it can't
+		// tell which names exist.
+		if err = authorizeAllBooks(ctx, auth_service.BooksRead); err != nil {
+			return nil, err
+		}
+		errMsg := fmt.Sprintf("Book with name %s is not found", req.Name)
+		return nil, e.GrpcRecordNotFound(errMsg, "GetBookByName", nil)
+	}
+
+	// the scope is checked once the id of the book is known.
+	bookId := decimal.NewFromFloat(result["id"].(float64)).String()
+	if err = authorizeBook(ctx, auth_service.BooksRead, bookId); err != nil {
 		return nil, err
 	}
+	if req.Balance {
+		if err = authorizeBook(ctx, auth_service.BalancesRead, bookId); err != nil {
+			return nil, err
+		}
+	}
 
+	return toProtoBookRes(result)
+}
+
+// toProtoBookRes maps the book returned by the book service, along with its balance if it has one.
+func toProtoBookRes(result map[string]interface{}) (*proto.GetBookRes, error) {
 	marshal, _ := json.Marshal(result)
 	logger.Logger.Infof("Result: %+v", string(marshal))
 
@@ -36,56 +96,126 @@ func (*Grpc) GetBook(_ context.Context, req *proto.GetBookReq) (res *proto.GetBo
 		return nil, err
 	}
 	mappedBook := &proto.BookResp{
-		CreatedAt: result["createdAt"].(string),
-		Id:        decimal.NewFromFloat(result["id"].(float64)).String(),
-		Metadata:  d,
-		Name:      result["name"].(string),
-		UpdatedAt: result["updatedAt"].(string),
+		CreatedAt:     result["createdAt"].(string),
+		Id:            decimal.NewFromFloat(result["id"].(float64)).String(),
+		Metadata:      d,
+		Name:          result["name"].(string),
+		UpdatedAt:     result["updatedAt"].(string),
+		AccountType:   fmt.Sprint(result["accountType"]),
+		ParentId:      fmt.Sprint(result["parentId"]),
+		NormalSide:    fmt.Sprint(result["normalSide"]),
+		BalancePolicy: fmt.Sprint(result["balancePolicy"]),
+	}
+	if limits, ok := result["overdraftLimits"].(map[string]interface{}); ok {
+		mappedBook.OverdraftLimits, _ = util.InterfaceToMapOfString(limits)
 	}
 
-	return &proto.GetBookRes{
+	res := &proto.GetBookRes{
 		Book: mappedBook,
-	}, nil
+	}
+	if balance, ok := result["balance"].(map[string]interface{}); ok {
+		if res.Balances, err = toProtoBalances(balance); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
 }
 
-// GetBalance returns a map where key is the asset name, and value is the amount of that asset in that book
-func (*Grpc) GetBalance(_ context.Context, req *proto.GetBalanceReq) (res *proto.GetBalanceRes, err error) {
+// GetBalance returns the balances of the book per asset, of the OVERALL operationType unless another one is asked for,
+// and narrowed down to assetId if given.
+func (*Grpc) GetBalance(ctx context.Context, req *proto.GetBalanceReq) (res *proto.GetBalanceRes, err error) {
 	logger.Logger.Infof("Invoked GetBalance")
+	if req.BookId == "" {
+		return nil, e.GrpcFieldNotFound("bookId is required.")
+	}
+	if err = authorizeBook(ctx, auth_service.BalancesRead, req.BookId); err != nil {
+		return nil, err
+	}
 	bookService := book_service.BookService{}
 
-	result, err := bookService.GetBalance(req.BookId, "", "", nil)
+	var result map[string]interface{}
+	if req.AsOf != "" || req.AfterOperationId > 0 {
+		var asOf *time.Time
+		if req.AsOf != "" {
+			t, er := time.Parse(time.RFC3339Nano, req.AsOf)
+			if er != nil {
+				return nil, e.GrpcFieldNotFound("asOf should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z")
+			}
+			asOf = &t
+		}
+		result, err = bookService.GetBalanceAsOf(req.BookId, req.AssetId, req.OperationType, asOf, req.AfterOperationId, nil)
+	} else if req.Rollup {
+		result, err = bookService.GetRollupBalance(req.BookId, req.AssetId, req.OperationType, nil)
+	} else {
+		result, err = bookService.GetBalance(req.BookId, req.AssetId, req.OperationType, nil)
+	}
 	marshal, _ := json.Marshal(result)
 
 	logger.Logger.Infof("Result: %+v", string(marshal))
 
+	if err != nil {
+		return nil, e.GrpcInternalError("bookService.GetBalance", err, map[string]string{"bookId": req.BookId})
+	}
+
+	balances, err := toProtoBalances(result)
 	if err != nil {
 		return nil, err
 	}
+	return &proto.GetBalanceRes{
+		Balances: balances,
+	}, nil
+}
+
+// toProtoBalances maps the balances returned by the book service (assetId -> balance), sorted by assetId.
+func toProtoBalances(result map[string]interface{}) ([]*proto.AssetBalance, error) {
+	assetIds := make([]string, 0, len(result))
+	for assetId := range result {
+		assetIds = append(assetIds, assetId)
+	}
+	sort.Strings(assetIds)
 
-	resBalances := map[string]string{}
-	for k, v := range result {
-		vMap, er := util.InterfaceToMapOfString(v)
+	balances := make([]*proto.AssetBalance, 0, len(assetIds))
+	for _, assetId := range assetIds {
+		vMap, err := util.InterfaceToMapOfString(result[assetId])
 		// in case of err, return
-		if er != nil {
-			logger.Logger.Infof("Error Occured while converting interface to map of string, v: %+v, err: %+v", v, er)
-			return nil, er
-			//return nil, errors.New("something went wrong, we're checking")
+		if err != nil {
+			logger.Logger.Infof("Error Occured while converting interface to map of string, v: %+v, err: %+v", result[assetId], err)
+			return nil, err
 		}
-		resBalances[k] = vMap["balance"]
+		balances = append(balances, &proto.AssetBalance{
+			AssetId:       assetId,
+			OperationType: vMap["operationType"],
+			Balance:       vMap["balance"],
+		})
 	}
-	return &proto.GetBalanceRes{
-		Balances: resBalances,
-	}, nil
+	return balances, nil
 }
 
-func (*Grpc) CreateOrUpdateBook(_ context.Context, req *proto.CreateUpdateBookReq) (*proto.CreateUpdateBookRes, error) {
+func (*Grpc) CreateOrUpdateBook(ctx context.Context, req *proto.CreateUpdateBookReq) (*proto.CreateUpdateBookRes, error) {
 	metadataBytes, _ := json.Marshal(req.Metadata)
 	if req.Name == "" {
 		return nil, e.GrpcFieldNotFound("name is required.")
 	}
-	book := models.Book{Name: req.Name, Metadata: datatypes.JSON(metadataBytes)}
-	result, operationMessage := book.CreateOrUpdateBook(&book)
-	err := result.Error
+	book := models.Book{
+		Name:          req.Name,
+		Metadata:      datatypes.JSON(metadataBytes),
+		AccountType:   req.AccountType,
+		ParentId:      req.ParentId,
+		NormalSide:    req.NormalSide,
+		BalancePolicy: req.BalancePolicy,
+	}
+	if len(req.OverdraftLimits) > 0 {
+		limitsBytes, _ := json.Marshal(req.OverdraftLimits)
+		book.OverdraftLimits = datatypes.JSON(limitsBytes)
+	}
+	bookService := book_service.BookService{ServiceName: serviceNameOf(ctx)}
+	operationMessage, err := bookService.CreateOrUpdateBook(&book)
+	if errors.Is(err, auth_service.ErrForbidden) {
+		return nil, e.GrpcPermissionDenied(err.Error(), "CreateOrUpdateBook", map[string]string{"name": book.Name})
+	}
+	if errors.Is(err, book_service.ErrInvalidBook) {
+		return nil, e.GrpcFieldNotFound(err.Error())
+	}
 	if err != nil {
 		logger.Logger.Errorf("Book creation failed: %+v", err)
 		return nil, e.GrpcInternalError(
@@ -102,8 +232,8 @@ func (*Grpc) CreateOrUpdateBook(_ context.Context, req *proto.CreateUpdateBookRe
 	}, nil
 }
 
-func (*Grpc) GetOperationByMemo(_ context.Context, req *proto.GetOperationByMemoReq) (res *proto.GetOperationByMemoRes, err error) {
-	opService := &operation_service.OperationService{}
+func (*Grpc) GetOperationByMemo(ctx context.Context, req *proto.GetOperationByMemoReq) (res *proto.GetOperationByMemoRes, err error) {
+	opService := &operation_service.OperationService{ServiceName: serviceNameOf(ctx)}
 	if req.Memo == "" {
 		return nil, e.GrpcFieldNotFound("memo is required.")
 	}
@@ -113,35 +243,21 @@ func (*Grpc) GetOperationByMemo(_ context.Context, req *proto.GetOperationByMemo
 		return nil, e.GrpcInternalError("opService.GetOperation", err, nil)
 	}
 	if foundOp == nil {
+		// a service limited to some books is denied, same as for an operation out of its scope, so that it can't
+		// tell which memos exist.
+		if err = authorizeAllBooks(ctx, auth_service.OperationsRead); err != nil {
+			return nil, err
+		}
 		errMsg := fmt.Sprintf("Operation with memo %s is not found", req.Memo)
 		return nil, e.GrpcRecordNotFound(errMsg, "GetOperationByMemo", nil)
 	}
-
-	protoEntries, err2 := opService.EntryInterfaceToProtoEntries(foundOp["entries"])
-	if err2 != nil {
-		logger.Logger.Errorf("converting to proto entries failed, op: %+v, err: %+v", foundOp, err2)
-		protoEntries = nil // it's nil in case of error so response can be sent.
-		return nil, e.GrpcInternalError("opService.GetOperation", err2, nil)
-	}
-
-	metadata, err3 := util.InterfaceToMapOfString(foundOp["metadata"])
-	if err3 != nil {
-		logger.Logger.Errorf("converting metadata to interface failed, op: %+v, err: %+v", foundOp, err2)
+	if err = opService.AuthorizeRead(foundOp); err != nil {
+		return nil, e.GrpcPermissionDenied(err.Error(), "GetOperationByMemo", map[string]string{"memo": req.Memo})
 	}
 
-	operation := &proto.Operation{
-		Memo:            foundOp["memo"].(string),
-		Id:              decimal.NewFromFloat(foundOp["id"].(float64)).IntPart(),
-		CreatedAt:       foundOp["createdAt"].(string),
-		UpdatedAt:       foundOp["updatedAt"].(string),
-		Type:            foundOp["type"].(string),
-		Entries:         protoEntries,
-		Status:          foundOp["status"].(string),
-		RejectionReason: foundOp["rejectionReason"].(string),
-		Metadata:        metadata,
-		// note, postman, for some reason, doesn't show
-		// metadata (empty object in pm), but it's shown
-		// if made request from a raw cli based grpc client.
+	operation, err := toProtoOperation(opService, foundOp)
+	if err != nil {
+		return nil, err
 	}
 
 	logger.Logger.Infof("operation: %+v", operation)
@@ -152,42 +268,214 @@ func (*Grpc) GetOperationByMemo(_ context.Context, req *proto.GetOperationByMemo
 
 }
 
-func (*Grpc) CreateOperation(_ context.Context, req *proto.CreateOperationReq) (res *proto.CreateOperationRes, err error) {
-	opService := &operation_service.OperationService{}
+func (*Grpc) CreateOperation(ctx context.Context, req *proto.CreateOperationReq) (res *proto.CreateOperationRes, err error) {
+	opService := &operation_service.OperationService{ServiceName: serviceNameOf(ctx)}
 
-	reqEntries := opService.ProtoEntriesToEntryInterface(req.Entries)
-	metadataInterface := map[string]interface{}{}
+	op, err := toOperationRequest(opService, req.Type, req.Memo, req.Entries, req.Metadata)
+	if err != nil {
+		return nil, e.GrpcFieldNotFound(err.Error())
+	}
 
-	for key, value := range req.Metadata {
-		metadataInterface[key] = value
+	foundOp, err := opService.PostOperation(op)
+	if errors.Is(err, auth_service.ErrForbidden) {
+		return nil, e.GrpcPermissionDenied(err.Error(), "CreateOperation", map[string]string{"memo": req.Memo})
 	}
-	opMap := map[string]interface{}{
-		"type":     req.Type,
-		"memo":     req.Memo,
-		"entries":  reqEntries,
-		"metadata": metadataInterface,
+	if errors.Is(err, models.ErrInvalidOperation) {
+		return nil, e.GrpcFieldNotFound(err.Error())
+	}
+	if errors.Is(err, operation_service.ErrIdempotencyConflict) {
+		return nil, e.GrpcAlreadyExists(err.Error(), "CreateOperation", map[string]string{"memo": req.Memo})
 	}
-
-	foundOp, err := opService.PostOperation(opMap)
 	if err != nil || foundOp == nil {
 		logger.Logger.Errorf("Creating Operation Failed, error: %+v", err)
 		return nil, e.GrpcInternalError("Creating operation resulted in error!",
 			err, nil)
 	}
+	if operation_service.IsInsufficientFunds(foundOp) {
+		return nil, e.GrpcFailedPrecondition(foundOp["rejectionReason"].(string), "CreateOperation", map[string]string{"memo": req.Memo})
+	}
 
+	operation, err := toProtoOperation(opService, foundOp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.CreateOperationRes{
+		Operation: operation,
+	}, nil
+}
+
+func (*Grpc) CreateOperationBatch(ctx context.Context, req *proto.CreateOperationBatchReq) (*proto.CreateOperationBatchRes, error) {
+	opService := &operation_service.OperationService{ServiceName: serviceNameOf(ctx)}
+
+	var ops []models.OperationRequest
+	for i, reqOp := range req.Operations {
+		op, err := toOperationRequest(opService, reqOp.Type, reqOp.Memo, reqOp.Entries, reqOp.Metadata)
+		if err != nil {
+			return nil, e.GrpcFieldNotFound(fmt.Sprintf("operations[%d]: %v", i, err))
+		}
+		ops = append(ops, op)
+	}
+
+	results, err := opService.ApplyOperationBatch(ops, req.ContinueOnError)
+	if errors.Is(err, auth_service.ErrForbidden) {
+		return nil, e.GrpcPermissionDenied(err.Error(), "CreateOperationBatch", nil)
+	}
+	if errors.Is(err, operation_service.ErrInvalidBatch) {
+		return nil, e.GrpcFieldNotFound(err.Error())
+	}
+	if err != nil && !errors.Is(err, operation_service.ErrBatchRolledBack) {
+		logger.Logger.Errorf("Applying Batch Failed, error: %+v", err)
+		return nil, e.GrpcInternalError("opService.ApplyOperationBatch", err, nil)
+	}
+
+	res := &proto.CreateOperationBatchRes{}
+	if err != nil {
+		res.RolledBack = true
+		res.ErrorMessage = err.Error()
+	}
+	for _, result := range results {
+		protoResult := &proto.OperationBatchResult{
+			Memo:   result.Memo,
+			Status: result.Status,
+			Error:  result.Error,
+		}
+		if result.Operation != nil {
+			protoResult.Operation, err = toProtoOperation(opService, result.Operation)
+			if err != nil {
+				return nil, err
+			}
+		}
+		res.Results = append(res.Results, protoResult)
+	}
+	return res, nil
+}
+
+// operationFilterOf reads the ListOperations filter from the request, the error is meant for the client.
+func operationFilterOf(req *proto.ListOperationsReq) (models.OperationFilter, error) {
+	filter := models.OperationFilter{
+		Type:          req.Type,
+		Status:        req.Status,
+		BookId:        req.BookId,
+		MetadataKey:   req.MetadataKey,
+		MetadataValue: req.MetadataValue,
+		Limit:         int(req.Limit),
+	}
+
+	var err error
+	if filter.From, err = util.ParseOptionalTime(req.From); err != nil {
+		return filter, errors.New("from should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z")
+	}
+	if filter.To, err = util.ParseOptionalTime(req.To); err != nil {
+		return filter, errors.New("to should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z")
+	}
+	if filter.BeforeId, err = util.ParseCursor(req.Cursor); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+func (*Grpc) ListOperations(ctx context.Context, req *proto.ListOperationsReq) (*proto.ListOperationsRes, error) {
+	filter, err := operationFilterOf(req)
+	if err != nil {
+		return nil, e.GrpcFieldNotFound(err.Error())
+	}
+
+	opService := &operation_service.OperationService{ServiceName: serviceNameOf(ctx)}
+	operations, nextCursor, err := opService.ListOperations(filter)
+	if errors.Is(err, auth_service.ErrForbidden) {
+		return nil, e.GrpcPermissionDenied(err.Error(), "ListOperations", map[string]string{"bookId": filter.BookId})
+	}
+	if errors.Is(err, operation_service.ErrInvalidOperationQuery) {
+		return nil, e.GrpcFieldNotFound(err.Error())
+	}
+	if err != nil {
+		return nil, e.GrpcInternalError("opService.ListOperations", err, nil)
+	}
+
+	var protoOperations []*proto.Operation
+	for _, operation := range operations {
+		protoOperation, err := toProtoOperation(opService, operation)
+		if err != nil {
+			return nil, err
+		}
+		protoOperations = append(protoOperations, protoOperation)
+	}
+
+	return &proto.ListOperationsRes{
+		Operations: protoOperations,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+func (*Grpc) ReverseOperation(ctx context.Context, req *proto.ReverseOperationReq) (res *proto.ReverseOperationRes, err error) {
+	opService := &operation_service.OperationService{ServiceName: serviceNameOf(ctx)}
+	if req.Memo == "" {
+		return nil, e.GrpcFieldNotFound("memo is required.")
+	}
+	if req.Reason == "" {
+		return nil, e.GrpcFieldNotFound("reason is required.")
+	}
+
+	reversalOp, err := opService.ReverseOperation(req.Memo, req.Reason)
+	if errors.Is(err, auth_service.ErrForbidden) {
+		return nil, e.GrpcPermissionDenied(err.Error(), "ReverseOperation", map[string]string{"memo": req.Memo})
+	}
+	if errors.Is(err, operation_service.ErrOperationNotFound) {
+		errMsg := fmt.Sprintf("Operation with memo %s is not found", req.Memo)
+		return nil, e.GrpcRecordNotFound(errMsg, "ReverseOperation", nil)
+	}
+	if errors.Is(err, operation_service.ErrOperationAlreadyReversed) || errors.Is(err, operation_service.ErrOperationNotApplied) {
+		return nil, e.GrpcFailedPrecondition(err.Error(), "ReverseOperation", map[string]string{"memo": req.Memo})
+	}
+	if err != nil {
+		logger.Logger.Errorf("Reversing operation failed, memo: %+v, err: %+v", req.Memo, err)
+		return nil, e.GrpcInternalError("opService.ReverseOperation", err, nil)
+	}
+
+	operation, err := toProtoOperation(opService, reversalOp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.ReverseOperationRes{
+		Operation: operation,
+	}, nil
+}
+
+// toOperationRequest reads the operation of a grpc request, and validates it.
+func toOperationRequest(opService *operation_service.OperationService, opType, memo string, entries []*proto.Entries, metadata map[string]string) (models.OperationRequest, error) {
+	reqEntries, err := opService.ProtoEntriesToEntries(entries)
+	if err != nil {
+		return models.OperationRequest{}, err
+	}
+	metadataInterface := map[string]interface{}{}
+	for key, value := range metadata {
+		metadataInterface[key] = value
+	}
+	op := models.OperationRequest{
+		Type:     opType,
+		Memo:     memo,
+		Entries:  reqEntries,
+		Metadata: metadataInterface,
+	}
+	return op, op.Validate()
+}
+
+// toProtoOperation converts the operation map returned by the operation service to its proto counterpart.
+func toProtoOperation(opService *operation_service.OperationService, foundOp map[string]interface{}) (*proto.Operation, error) {
 	protoEntries, err2 := opService.EntryInterfaceToProtoEntries(foundOp["entries"])
 	if err2 != nil {
 		logger.Logger.Errorf("converting to proto entries failed, op: %+v, err: %+v", foundOp, err2)
-		protoEntries = nil // it's nil in case of error so response can be sent.
 		return nil, e.GrpcInternalError("opService.GetOperation", err2, nil)
 	}
 
 	metadata, err3 := util.InterfaceToMapOfString(foundOp["metadata"])
 	if err3 != nil {
-		logger.Logger.Errorf("converting metadata to interface failed, op: %+v, err: %+v", foundOp, err2)
+		logger.Logger.Errorf("converting metadata to interface failed, op: %+v, err: %+v", foundOp, err3)
 	}
 
-	operation := &proto.Operation{
+	return &proto.Operation{
 		Memo:            foundOp["memo"].(string),
 		Id:              decimal.NewFromFloat(foundOp["id"].(float64)).IntPart(),
 		CreatedAt:       foundOp["createdAt"].(string),
@@ -197,9 +485,8 @@ func (*Grpc) CreateOperation(_ context.Context, req *proto.CreateOperationReq) (
 		Status:          foundOp["status"].(string),
 		RejectionReason: foundOp["rejectionReason"].(string),
 		Metadata:        metadata,
-	}
-
-	return &proto.CreateOperationRes{
-		Operation: operation,
+		// note, postman, for some reason, doesn't show
+		// metadata (empty object in pm), but it's shown
+		// if made request from a raw cli based grpc client.
 	}, nil
 }
@@ -0,0 +1,72 @@
+package grpc
+
+import (
+	"testing"
+
+	asrt "github.com/stretchr/testify/assert"
+
+	proto "general_ledger_golang/api/proto/code/go"
+)
+
+func TestToProtoBalances(t *testing.T) {
+	assert := asrt.New(t)
+
+	balances, err := toProtoBalances(map[string]interface{}{
+		"inr": map[string]interface{}{"bookId": "4", "assetId": "inr", "operationType": "OVERALL", "balance": "100"},
+		"btc": map[string]interface{}{"bookId": "4", "assetId": "btc", "operationType": "OVERALL", "balance": "0.00000001"},
+	})
+	if assert.NoError(err) && assert.Len(balances, 2) {
+		assert.Equal("btc", balances[0].AssetId)
+		assert.Equal("0.00000001", balances[0].Balance)
+		assert.Equal("OVERALL", balances[0].OperationType)
+		assert.Equal("inr", balances[1].AssetId)
+	}
+
+	balances, err = toProtoBalances(map[string]interface{}{})
+	assert.NoError(err)
+	assert.Len(balances, 0)
+}
+
+func TestToProtoHold(t *testing.T) {
+	assert := asrt.New(t)
+
+	hold := toProtoHold(map[string]interface{}{
+		"memo":           "hold-1",
+		"bookId":         "4",
+		"assetId":        "btc",
+		"amount":         "1.5",
+		"capturedAmount": "0.5",
+		"releasedAmount": "0",
+		"status":         "PARTIALLY_CAPTURED",
+		"expiresAt":      nil,
+		"metadata":       map[string]interface{}{"orderId": "42"},
+	})
+	assert.Equal("hold-1", hold.Memo)
+	assert.Equal("1.5", hold.Amount)
+	assert.Equal("PARTIALLY_CAPTURED", hold.Status)
+	assert.Equal("", hold.ExpiresAt)
+	assert.Equal(map[string]string{"orderId": "42"}, hold.Metadata)
+}
+
+func TestOperationFilterOf(t *testing.T) {
+	assert := asrt.New(t)
+
+	filter, err := operationFilterOf(&proto.ListOperationsReq{
+		Type: "TRANSFER", Status: "APPLIED", BookId: "4", MetadataKey: "orderId", MetadataValue: "42",
+		From: "2023-10-17T07:41:55Z", Limit: 10, Cursor: "120",
+	})
+	if assert.NoError(err) {
+		assert.Equal("TRANSFER", filter.Type)
+		assert.Equal("4", filter.BookId)
+		assert.Equal("42", filter.MetadataValue)
+		assert.NotNil(filter.From)
+		assert.Nil(filter.To)
+		assert.Equal(10, filter.Limit)
+		assert.Equal(uint64(120), filter.BeforeId)
+	}
+
+	_, err = operationFilterOf(&proto.ListOperationsReq{To: "tomorrow"})
+	assert.Error(err)
+	_, err = operationFilterOf(&proto.ListOperationsReq{Cursor: "abc"})
+	assert.Error(err)
+}
@@ -0,0 +1,95 @@
+package grpc
+
+import (
+	"errors"
+
+	proto "general_ledger_golang/api/proto/code/go"
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
+	"general_ledger_golang/service/posting_service"
+)
+
+// ListPostings streams the postings page by page, until all (or limit) postings are sent.
+func (*Grpc) ListPostings(req *proto.ListPostingsReq, stream proto.LegerService_ListPostingsServer) error {
+	if req.BookId == "" {
+		return e.GrpcFieldNotFound("bookId is required.")
+	}
+	if err := authorizeBook(stream.Context(), auth_service.PostingsRead, req.BookId); err != nil {
+		return err
+	}
+
+	filter := models.PostingFilter{
+		BookId:        req.BookId,
+		AssetId:       req.AssetId,
+		OperationType: req.OperationType,
+	}
+	var err error
+	if filter.From, err = util.ParseOptionalTime(req.From); err != nil {
+		return e.GrpcFieldNotFound("from should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z")
+	}
+	if filter.To, err = util.ParseOptionalTime(req.To); err != nil {
+		return e.GrpcFieldNotFound("to should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z")
+	}
+
+	cursor := req.Cursor
+	remaining := int(req.Limit)
+	postingService := posting_service.PostingService{}
+
+	for {
+		afterId, err := util.ParseCursor(cursor)
+		if err != nil {
+			return e.GrpcFieldNotFound(err.Error())
+		}
+		filter.AfterId = afterId
+		filter.Limit = posting_service.MaxStatementLimit
+		if remaining > 0 && remaining < filter.Limit {
+			filter.Limit = remaining
+		}
+
+		postings, nextCursor, err := postingService.GetStatement(filter)
+		if errors.Is(err, posting_service.ErrInvalidStatementQuery) {
+			return e.GrpcFieldNotFound(err.Error())
+		}
+		if err != nil {
+			return e.GrpcInternalError("postingService.GetStatement", err, map[string]string{"bookId": req.BookId})
+		}
+
+		for _, posting := range postings {
+			if err = stream.Send(toProtoPosting(posting)); err != nil {
+				return err
+			}
+		}
+
+		if req.Limit > 0 {
+			remaining -= len(postings)
+			if remaining <= 0 {
+				return nil
+			}
+		}
+		if nextCursor == "" {
+			return nil
+		}
+		cursor = nextCursor
+	}
+}
+
+func toProtoPosting(posting map[string]interface{}) *proto.Posting {
+	metadata, err := util.InterfaceToMapOfString(posting["metadata"])
+	if err != nil {
+		logger.Logger.Errorf("converting metadata to map of string failed, posting: %+v, err: %+v", posting, err)
+	}
+
+	return &proto.Posting{
+		Id:             uint64(posting["id"].(float64)),
+		OperationId:    posting["operationId"].(string),
+		BookId:         posting["bookId"].(string),
+		AssetId:        posting["assetId"].(string),
+		Value:          posting["value"].(string),
+		RunningBalance: posting["runningBalance"].(string),
+		Metadata:       metadata,
+		CreatedAt:      posting["createdAt"].(string),
+	}
+}
@@ -0,0 +1,105 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	proto "general_ledger_golang/api/proto/code/go"
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
+	"general_ledger_golang/service/report_service"
+)
+
+// GetTrialBalance returns every book's debit and credit totals per asset, as of asOf (now if not given),
+// optionally for a single assetId, and whether those net to zero.
+func (*Grpc) GetTrialBalance(ctx context.Context, req *proto.GetTrialBalanceReq) (*proto.GetTrialBalanceRes, error) {
+	if err := authorizeAllBooks(ctx, auth_service.ReportsRead); err != nil {
+		return nil, err
+	}
+	asOf, err := util.ParseOptionalTime(req.AsOf)
+	if err != nil {
+		return nil, e.GrpcFieldNotFound("asOf should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z")
+	}
+
+	reportService := report_service.ReportService{}
+	report, err := reportService.GetTrialBalance(asOf, req.AssetId)
+	if err != nil {
+		logger.Logger.Errorf("Trial balance failed, error: %+v", err)
+		return nil, e.GrpcInternalError("reportService.GetTrialBalance", err, nil)
+	}
+
+	res := &proto.GetTrialBalanceRes{
+		AsOf:     report.AsOf.Format(time.RFC3339Nano),
+		Balanced: report.Balanced,
+	}
+	for _, asset := range report.Assets {
+		protoAsset := &proto.AssetTrialBalance{
+			AssetId:     asset.AssetId,
+			TotalDebit:  asset.TotalDebit.String(),
+			TotalCredit: asset.TotalCredit.String(),
+			Balanced:    asset.Balanced,
+		}
+		for _, row := range asset.Rows {
+			protoAsset.Rows = append(protoAsset.Rows, &proto.TrialBalanceRow{
+				BookId:      row.BookId,
+				Name:        row.Name,
+				AccountType: row.AccountType,
+				NormalSide:  row.NormalSide,
+				Debit:       row.Debit.String(),
+				Credit:      row.Credit.String(),
+				Balance:     row.Balance.String(),
+				BalanceSide: row.BalanceSide,
+			})
+		}
+		res.Assets = append(res.Assets, protoAsset)
+	}
+	return res, nil
+}
+
+// GetBalanceSheet returns the books' totals grouped by account type, or by a metadata key (groupBy metadata.<key>),
+// per asset, as of asOf (now if not given), optionally for a single assetId.
+func (*Grpc) GetBalanceSheet(ctx context.Context, req *proto.GetBalanceSheetReq) (*proto.GetBalanceSheetRes, error) {
+	if err := authorizeAllBooks(ctx, auth_service.ReportsRead); err != nil {
+		return nil, err
+	}
+	asOf, err := util.ParseOptionalTime(req.AsOf)
+	if err != nil {
+		return nil, e.GrpcFieldNotFound("asOf should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z")
+	}
+
+	reportService := report_service.ReportService{}
+	report, err := reportService.GetBalanceSheet(asOf, req.AssetId, req.GroupBy)
+	if errors.Is(err, report_service.ErrInvalidReportQuery) {
+		return nil, e.GrpcFieldNotFound(err.Error())
+	}
+	if err != nil {
+		logger.Logger.Errorf("Balance sheet failed, error: %+v", err)
+		return nil, e.GrpcInternalError("reportService.GetBalanceSheet", err, nil)
+	}
+
+	res := &proto.GetBalanceSheetRes{
+		AsOf:     report.AsOf.Format(time.RFC3339Nano),
+		GroupBy:  report.GroupBy,
+		Balanced: report.Balanced,
+	}
+	for _, asset := range report.Assets {
+		protoAsset := &proto.AssetBalanceSheet{
+			AssetId:  asset.AssetId,
+			Balanced: asset.Balanced,
+		}
+		for _, group := range asset.Groups {
+			protoAsset.Groups = append(protoAsset.Groups, &proto.BalanceSheetGroup{
+				Group:   group.Group,
+				Books:   int32(group.Books),
+				Debit:   group.Debit.String(),
+				Credit:  group.Credit.String(),
+				Balance: group.Balance.String(),
+			})
+		}
+		res.Assets = append(res.Assets, protoAsset)
+	}
+	return res, nil
+}
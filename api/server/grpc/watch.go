@@ -0,0 +1,45 @@
+package grpc
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	proto "general_ledger_golang/api/proto/code/go"
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/service/auth_service"
+	"general_ledger_golang/service/outbox_service"
+)
+
+// WatchBalances streams the balance changes of the requested books, as those are committed,
+// until the client cancels the stream.
+func (*Grpc) WatchBalances(req *proto.WatchBalancesReq, stream proto.LegerService_WatchBalancesServer) error {
+	for _, bookId := range req.BookIds {
+		if err := authorizeBook(stream.Context(), auth_service.BalancesRead, bookId); err != nil {
+			return err
+		}
+	}
+
+	watcher := outbox_service.BalanceWatcher{}
+	err := watcher.Watch(stream.Context(), req.BookIds, req.AssetIds, req.FromSequence, func(update outbox_service.BalanceUpdate) error {
+		return stream.Send(&proto.BalanceChange{
+			Sequence:      update.Sequence,
+			BookId:        update.BookId,
+			AssetId:       update.AssetId,
+			OperationType: update.OperationType,
+			Change:        update.Change,
+			Balance:       update.Balance,
+			Source:        update.Source,
+			Memo:          update.Memo,
+			CreatedAt:     update.CreatedAt.UTC().Format(time.RFC3339Nano),
+		})
+	})
+
+	if errors.Is(err, outbox_service.ErrInvalidWatch) {
+		return e.GrpcFieldNotFound(err.Error())
+	}
+	if err != nil && stream.Context().Err() == nil {
+		return e.GrpcInternalError("BalanceWatcher.Watch", err, map[string]string{"bookIds": strings.Join(req.BookIds, ",")})
+	}
+	return nil
+}
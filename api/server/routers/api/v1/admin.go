@@ -0,0 +1,56 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"general_ledger_golang/pkg/app"
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/service/posting_service"
+	"general_ledger_golang/service/reconcile_service"
+)
+
+// GetReconciliation recomputes the balances from postings and reports the drifts, without changing anything.
+func GetReconciliation(c *gin.Context) {
+	reconcile(c, false)
+}
+
+// FixReconciliation recomputes the balances from postings and rewrites the drifted ones.
+func FixReconciliation(c *gin.Context) {
+	reconcile(c, true)
+}
+
+func reconcile(c *gin.Context, fix bool) {
+	appGin := app.Gin{C: c}
+
+	reconcileService := reconcile_service.ReconcileService{}
+	report, err := reconcileService.Reconcile(fix)
+
+	if err != nil {
+		logger.Logger.Errorf("Reconciliation failed, fix: %v, error: %+v", fix, err)
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"report": report})
+	return
+}
+
+// VerifyPostingChain walks the hash chain of the postings of bookId (every book, if not given),
+// and reports the first broken link, if any.
+func VerifyPostingChain(c *gin.Context) {
+	appGin := app.Gin{C: c}
+	bookId := c.Query("bookId")
+
+	postingService := posting_service.PostingService{}
+	report, err := postingService.VerifyChain(bookId)
+
+	if err != nil {
+		logger.Logger.Errorf("Chain verification failed, bookId: %s, error: %+v", bookId, err)
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"report": report})
+	return
+}
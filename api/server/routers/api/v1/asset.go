@@ -0,0 +1,114 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/app"
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/service/asset_service"
+)
+
+func CreateOrUpdateAsset(c *gin.Context) {
+	appGin := app.Gin{C: c}
+	reqBody := struct {
+		Code              string              `json:"code"`
+		Name              string              `json:"name"`
+		Scale             int32               `json:"scale"`
+		MinTransferAmount decimal.NullDecimal `json:"minTransferAmount"`
+		MaxTransferAmount decimal.NullDecimal `json:"maxTransferAmount"`
+	}{}
+
+	if err := json.Unmarshal(c.MustGet("requestBodyBytes").([]byte), &reqBody); err != nil {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": "Missing request body or not a valid json!"})
+		return
+	}
+
+	assetService := asset_service.AssetService{}
+	asset, operation, err := assetService.CreateOrUpdateAsset(&models.Asset{
+		Code:              reqBody.Code,
+		Name:              reqBody.Name,
+		Scale:             reqBody.Scale,
+		MinTransferAmount: reqBody.MinTransferAmount,
+		MaxTransferAmount: reqBody.MaxTransferAmount,
+	})
+
+	if errors.Is(err, asset_service.ErrInvalidAsset) {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Logger.Errorf("Asset creation failed: %+v", err)
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{
+		"asset":   asset,
+		"message": fmt.Sprintf("%v successful", operation),
+	})
+	return
+}
+
+func GetAsset(c *gin.Context) {
+	appGin := app.Gin{C: c}
+	code := c.Param("code")
+
+	assetService := asset_service.AssetService{}
+	asset, err := assetService.GetAsset(code)
+
+	if err != nil {
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if asset == nil {
+		appGin.Response(http.StatusNotFound, e.NOT_EXIST, map[string]interface{}{"asset": asset})
+		return
+	}
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"asset": asset})
+	return
+}
+
+func GetAssets(c *gin.Context) {
+	appGin := app.Gin{C: c}
+
+	assetService := asset_service.AssetService{}
+	assets, err := assetService.GetAssets()
+
+	if err != nil {
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"assets": assets})
+	return
+}
+
+func DeleteAsset(c *gin.Context) {
+	appGin := app.Gin{C: c}
+	code := c.Param("code")
+
+	assetService := asset_service.AssetService{}
+	err := assetService.DeleteAsset(code)
+
+	if errors.Is(err, asset_service.ErrAssetNotFound) {
+		appGin.Response(http.StatusNotFound, e.NOT_EXIST, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, asset_service.ErrAssetInUse) {
+		appGin.Response(http.StatusConflict, e.CONFLICT, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"message": "delete successful"})
+	return
+}
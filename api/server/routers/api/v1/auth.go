@@ -0,0 +1,40 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"general_ledger_golang/pkg/app"
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/service/auth_service"
+)
+
+// serviceName returns the calling service, authenticated by the ServiceAuth middleware.
+func serviceName(c *gin.Context) string {
+	return c.GetHeader(auth_service.ServiceNameHeader)
+}
+
+// authorizeBook checks the permission on bookId against the calling service's scope,
+// responds with 403 and returns false if it's out of scope.
+func authorizeBook(c *gin.Context, permission auth_service.Permission, bookId string) bool {
+	appGin := app.Gin{C: c}
+	auth := auth_service.Auth{ServiceName: serviceName(c)}
+	if err := auth.AuthorizeBook(permission, bookId); err != nil {
+		appGin.Response(http.StatusForbidden, e.FORBIDDEN, map[string]interface{}{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// authorizeAllBooks checks the permission across all the books against the calling service's scope,
+// responds with 403 and returns false if the service is limited to some books.
+func authorizeAllBooks(c *gin.Context, permission auth_service.Permission) bool {
+	appGin := app.Gin{C: c}
+	auth := auth_service.Auth{ServiceName: serviceName(c)}
+	if err := auth.AuthorizeAllBooks(permission); err != nil {
+		appGin.Response(http.StatusForbidden, e.FORBIDDEN, map[string]interface{}{"error": err.Error()})
+		return false
+	}
+	return true
+}
@@ -2,11 +2,14 @@ package v1
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 	"gorm.io/datatypes"
 
 	"general_ledger_golang/models"
@@ -14,6 +17,7 @@ import (
 	"general_ledger_golang/pkg/e"
 	"general_ledger_golang/pkg/logger"
 	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
 	"general_ledger_golang/service/book_service"
 )
 
@@ -27,6 +31,13 @@ func GetBook(c *gin.Context) {
 		logger.Logger.Errorf("Parsing of `balance` failed, error: %+v", err)
 	}
 
+	if !authorizeBook(c, auth_service.BooksRead, bookId) {
+		return
+	}
+	if balanceFetch && !authorizeBook(c, auth_service.BalancesRead, bookId) {
+		return
+	}
+
 	bookService := book_service.BookService{}
 	result, err := bookService.GetBook(bookId, balanceFetch)
 
@@ -42,6 +53,45 @@ func GetBook(c *gin.Context) {
 	return
 }
 
+// GetBookByName returns the book with the name query param, along with its balance if balance=true.
+func GetBookByName(c *gin.Context) {
+	appGin := app.Gin{C: c}
+	name := c.Query("name")
+	if name == "" {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": "name is required"})
+		return
+	}
+	balanceFetch, _ := strconv.ParseBool(c.Query("balance"))
+
+	bookService := book_service.BookService{}
+	result, err := bookService.GetBookByName(name, balanceFetch)
+
+	if err != nil {
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if result == nil {
+		// a service limited to some books is denied, same as for a book out of its scope, so that it can't
+		// tell which names exist.
+		if !authorizeAllBooks(c, auth_service.BooksRead) {
+			return
+		}
+		appGin.Response(http.StatusNotFound, e.NOT_EXIST, map[string]interface{}{"book": result})
+		return
+	}
+
+	// the scope is checked once the id of the book is known.
+	bookId := decimal.NewFromFloat(result["id"].(float64)).String()
+	if !authorizeBook(c, auth_service.BooksRead, bookId) {
+		return
+	}
+	if balanceFetch && !authorizeBook(c, auth_service.BalancesRead, bookId) {
+		return
+	}
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"book": result})
+	return
+}
+
 func GetBookBalance(c *gin.Context) {
 	appGin := app.Gin{C: c}
 	bookId := c.Param("bookId")
@@ -49,9 +99,43 @@ func GetBookBalance(c *gin.Context) {
 	assetId := c.Query("assetId")
 	operationType := c.Query("operationType")
 
+	if !authorizeBook(c, auth_service.BalancesRead, bookId) {
+		return
+	}
+
 	bookService := book_service.BookService{}
 
-	result, err := bookService.GetBalance(bookId, assetId, operationType, nil)
+	var result map[string]interface{}
+	var err error
+
+	// asOf (RFC3339) and/or afterOperationId compute the balance from postings, at that point in time.
+	if c.Query("asOf") != "" || c.Query("afterOperationId") != "" {
+		var asOf *time.Time
+		var afterOperationId uint64
+
+		if c.Query("asOf") != "" {
+			t, er := time.Parse(time.RFC3339Nano, c.Query("asOf"))
+			if er != nil {
+				appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": "asOf should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z"})
+				return
+			}
+			asOf = &t
+		}
+		if c.Query("afterOperationId") != "" {
+			afterOperationId, err = strconv.ParseUint(c.Query("afterOperationId"), 10, 64)
+			if err != nil || afterOperationId == 0 {
+				appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": "afterOperationId should be a positive integer"})
+				return
+			}
+		}
+
+		result, err = bookService.GetBalanceAsOf(bookId, assetId, operationType, asOf, afterOperationId, nil)
+	} else if rollup, _ := strconv.ParseBool(c.Query("rollup")); rollup {
+		// aggregated across the book and its descendants in the chart of accounts.
+		result, err = bookService.GetRollupBalance(bookId, assetId, operationType, nil)
+	} else {
+		result, err = bookService.GetBalance(bookId, assetId, operationType, nil)
+	}
 
 	if err != nil {
 		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{"error": err.Error()})
@@ -71,12 +155,32 @@ func CreateOrUpdateBook(c *gin.Context) {
 		return
 	}
 
-	name := reqBody["name"].(string)
+	name, _ := reqBody["name"].(string)
 	metadataBytes, _ := json.Marshal(reqBody["metadata"])
 	book := models.Book{Name: name, Metadata: datatypes.JSON(metadataBytes)}
-	result, operation := book.CreateOrUpdateBook(&book)
-	err := result.Error
+	book.AccountType, _ = reqBody["accountType"].(string)
+	book.NormalSide, _ = reqBody["normalSide"].(string)
+	book.BalancePolicy, _ = reqBody["balancePolicy"].(string)
+	if limits, ok := reqBody["overdraftLimits"]; ok && limits != nil {
+		limitsBytes, _ := json.Marshal(limits)
+		book.OverdraftLimits = datatypes.JSON(limitsBytes)
+	}
+	if parentId, ok := reqBody["parentId"]; ok && parentId != nil {
+		// parentId can be sent as a number as well.
+		book.ParentId = fmt.Sprint(parentId)
+	}
+
+	bookService := book_service.BookService{ServiceName: serviceName(c)}
+	operation, err := bookService.CreateOrUpdateBook(&book)
 
+	if errors.Is(err, auth_service.ErrForbidden) {
+		appGin.Response(http.StatusForbidden, e.FORBIDDEN, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, book_service.ErrInvalidBook) {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		fmt.Printf("Book creation failed: %+v", err)
 		appGin.Response(http.StatusInternalServerError, e.INVALID_PARAMS, map[string]interface{}{"error": err.Error()})
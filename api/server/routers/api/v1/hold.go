@@ -0,0 +1,138 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/app"
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/service/auth_service"
+	"general_ledger_golang/service/hold_service"
+	"general_ledger_golang/service/operation_service"
+)
+
+func CreateHold(c *gin.Context) {
+	appGin := app.Gin{C: c}
+	reqBody := struct {
+		Memo      string                 `json:"memo"`
+		BookId    string                 `json:"bookId"`
+		AssetId   string                 `json:"assetId"`
+		Amount    decimal.Decimal        `json:"amount"`
+		ExpiresAt *time.Time             `json:"expiresAt"`
+		Metadata  map[string]interface{} `json:"metadata"`
+	}{}
+
+	if err := json.Unmarshal(c.MustGet("requestBodyBytes").([]byte), &reqBody); err != nil {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": "Missing request body or not a valid json!"})
+		return
+	}
+
+	holdService := hold_service.HoldService{ServiceName: serviceName(c)}
+	hold, err := holdService.CreateHold(reqBody.Memo, reqBody.BookId, reqBody.AssetId, reqBody.Amount, reqBody.ExpiresAt, reqBody.Metadata)
+
+	if err != nil {
+		respondHoldError(appGin, err, reqBody.Memo)
+		return
+	}
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"hold": hold})
+	return
+}
+
+func GetHold(c *gin.Context) {
+	appGin := app.Gin{C: c}
+	memo := c.Param("memo")
+
+	holdService := hold_service.HoldService{ServiceName: serviceName(c)}
+	hold, err := holdService.GetHold(memo)
+
+	if errors.Is(err, auth_service.ErrForbidden) {
+		appGin.Response(http.StatusForbidden, e.FORBIDDEN, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if hold == nil {
+		appGin.Response(http.StatusNotFound, e.NOT_EXIST, map[string]interface{}{"hold": hold})
+		return
+	}
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"hold": hold})
+	return
+}
+
+// CaptureHold captures the hold into an operation, amount is optional, the remaining held amount is captured by default.
+func CaptureHold(c *gin.Context) {
+	appGin := app.Gin{C: c}
+	memo := c.Param("memo")
+	reqBody := struct {
+		Amount        decimal.NullDecimal    `json:"amount"`
+		OperationMemo string                 `json:"operationMemo"`
+		ToBookId      string                 `json:"toBookId"`
+		Type          string                 `json:"type"`
+		Metadata      map[string]interface{} `json:"metadata"`
+	}{}
+
+	if err := json.Unmarshal(c.MustGet("requestBodyBytes").([]byte), &reqBody); err != nil {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": "Missing request body or not a valid json!"})
+		return
+	}
+	if reqBody.OperationMemo == "" || reqBody.ToBookId == "" || reqBody.Type == "" {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": "operationMemo, toBookId and type are required!"})
+		return
+	}
+
+	holdService := hold_service.HoldService{ServiceName: serviceName(c)}
+	hold, operation, err := holdService.CaptureHold(memo, reqBody.Amount, reqBody.OperationMemo, reqBody.ToBookId, reqBody.Type, reqBody.Metadata)
+
+	if err != nil {
+		respondHoldError(appGin, err, memo)
+		return
+	}
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"hold": hold, "operation": operation})
+	return
+}
+
+func ReleaseHold(c *gin.Context) {
+	appGin := app.Gin{C: c}
+	memo := c.Param("memo")
+
+	holdService := hold_service.HoldService{ServiceName: serviceName(c)}
+	hold, err := holdService.ReleaseHold(memo)
+
+	if err != nil {
+		respondHoldError(appGin, err, memo)
+		return
+	}
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"hold": hold})
+	return
+}
+
+func respondHoldError(appGin app.Gin, err error, memo string) {
+	switch {
+	case errors.Is(err, auth_service.ErrForbidden):
+		appGin.Response(http.StatusForbidden, e.FORBIDDEN, map[string]interface{}{"error": err.Error()})
+	case errors.Is(err, hold_service.ErrInvalidHold), errors.Is(err, models.ErrInvalidOperation):
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": err.Error()})
+	case errors.Is(err, hold_service.ErrHoldNotFound):
+		appGin.Response(http.StatusNotFound, e.NOT_EXIST, map[string]interface{}{"error": err.Error()})
+	case errors.Is(err, hold_service.ErrHoldNotActive), errors.Is(err, hold_service.ErrHoldExpired), errors.Is(err, hold_service.ErrCaptureExceedsHold),
+		errors.Is(err, operation_service.ErrIdempotencyConflict):
+		appGin.Response(http.StatusConflict, e.CONFLICT, map[string]interface{}{"error": err.Error()})
+	case errors.Is(err, hold_service.ErrInsufficientFunds):
+		appGin.Response(http.StatusUnprocessableEntity, e.INSUFFICIENT_FUNDS, map[string]interface{}{"error": err.Error()})
+	case errors.Is(err, hold_service.ErrCaptureRejected):
+		appGin.Response(http.StatusUnprocessableEntity, e.INVALID_PARAMS, map[string]interface{}{"error": err.Error()})
+	default:
+		logger.Logger.WithFields(logrus.Fields{"memo": memo}).Errorf("Hold request failed, error: %+v", err)
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{"error": err.Error()})
+	}
+}
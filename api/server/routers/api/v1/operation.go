@@ -1,15 +1,20 @@
 package v1
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 
+	"general_ledger_golang/models"
 	"general_ledger_golang/pkg/app"
 	"general_ledger_golang/pkg/e"
 	"general_ledger_golang/pkg/logger"
 	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
 	"general_ledger_golang/service/operation_service"
 )
 
@@ -17,28 +22,41 @@ func PostOperation(c *gin.Context) {
 	appGin := app.Gin{C: c}
 	reqBody := util.GetReqBodyFromCtx(c)
 
-	opType := reqBody["type"]
-	memo := reqBody["memo"]
-	entries := reqBody["entries"]
-	metadata := reqBody["metadata"]
-
-	opMap := map[string]interface{}{
-		"type":     opType,
-		"memo":     memo,
-		"entries":  entries,
-		"metadata": metadata,
+	op, err := models.NewOperationRequest(reqBody)
+	if err != nil {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": err.Error()})
+		return
 	}
 
 	log := logger.Logger.WithFields(logrus.Fields{
-		"memo": memo,
-		"op":   opMap,
+		"memo": op.Memo,
+		"op":   op,
 	})
 
 	log.Infof("Request Received")
 
-	opService := &operation_service.OperationService{}
-	foundOp, err := opService.PostOperation(opMap)
+	opService := &operation_service.OperationService{ServiceName: serviceName(c)}
+	foundOp, err := opService.PostOperation(op)
+
+	if errors.Is(err, auth_service.ErrForbidden) {
+		log.Infof("Operation Denied, error: %+v", err)
+		appGin.Response(http.StatusForbidden, e.FORBIDDEN, map[string]interface{}{"error": err.Error()})
+		return
+	}
 
+	if errors.Is(err, models.ErrInvalidOperation) {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, operation_service.ErrIdempotencyConflict) {
+		log.Infof("Idempotency Conflict, error: %+v", err)
+		appGin.Response(http.StatusConflict, e.CONFLICT, map[string]interface{}{
+			"message": "Memo is already used with a different payload!",
+			"error":   err.Error(),
+		})
+		return
+	}
 	if err != nil || foundOp == nil {
 		log.Errorf("Creating Operation Failed, error: %+v", err)
 		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{
@@ -48,11 +66,155 @@ func PostOperation(c *gin.Context) {
 		return
 	}
 
+	if operation_service.IsInsufficientFunds(foundOp) {
+		appGin.Response(http.StatusUnprocessableEntity, e.INSUFFICIENT_FUNDS, map[string]interface{}{
+			"message":   "Operation is rejected, not enough balance!",
+			"operation": foundOp,
+		})
+		return
+	}
+
 	// return the operation
 	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"operation": foundOp})
 	return
 }
 
+// PostOperationBatch applies the operations in a single transaction, all-or-nothing unless continueOnError is set.
+func PostOperationBatch(c *gin.Context) {
+	appGin := app.Gin{C: c}
+	reqBody := util.GetReqBodyFromCtx(c)
+
+	continueOnError, _ := reqBody["continueOnError"].(bool)
+	operations, _ := reqBody["operations"].([]interface{})
+	var ops []models.OperationRequest
+	for i, operation := range operations {
+		opMap, _ := operation.(map[string]interface{})
+		op, err := models.NewOperationRequest(opMap)
+		if err != nil {
+			appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": fmt.Sprintf("operations[%d]: %v", i, err)})
+			return
+		}
+		ops = append(ops, op)
+	}
+
+	log := logger.Logger.WithFields(logrus.Fields{
+		"operations":      len(ops),
+		"continueOnError": continueOnError,
+	})
+
+	log.Infof("Batch Request Received")
+
+	opService := &operation_service.OperationService{ServiceName: serviceName(c)}
+	results, err := opService.ApplyOperationBatch(ops, continueOnError)
+
+	if errors.Is(err, auth_service.ErrForbidden) {
+		log.Infof("Operation Denied, error: %+v", err)
+		appGin.Response(http.StatusForbidden, e.FORBIDDEN, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, operation_service.ErrInvalidBatch) || errors.Is(err, models.ErrInvalidOperation) {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, operation_service.ErrBatchRolledBack) {
+		log.Infof("Batch Rolled Back, error: %+v", err)
+		appGin.Response(http.StatusUnprocessableEntity, e.INVALID_PARAMS, map[string]interface{}{
+			"message": "Batch is rolled back, none of the operations is applied!",
+			"error":   err.Error(),
+			"results": results,
+		})
+		return
+	}
+	if err != nil {
+		log.Errorf("Applying Batch Failed, error: %+v", err)
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{
+			"message": "Applying batch resulted in error!",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"results": results})
+	return
+}
+
+// GetOperations returns the operation with the given memo if memo is provided, else lists the operations.
+func GetOperations(c *gin.Context) {
+	if c.Query("memo") != "" {
+		GetOperationByMemo(c)
+		return
+	}
+	ListOperations(c)
+}
+
+// ListOperations lists operations newest first, filtered on type, status, bookId, metadataKey/metadataValue
+// and from/to (RFC3339). Paginated with limit and cursor (nextCursor of the previous page).
+func ListOperations(c *gin.Context) {
+	appGin := app.Gin{C: c}
+
+	filter, err := operationFilterOf(c)
+	if err != nil {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	opService := &operation_service.OperationService{ServiceName: serviceName(c)}
+	operations, nextCursor, err := opService.ListOperations(filter)
+
+	if errors.Is(err, auth_service.ErrForbidden) {
+		appGin.Response(http.StatusForbidden, e.FORBIDDEN, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, operation_service.ErrInvalidOperationQuery) {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Logger.Errorf("Listing Operations Failed, error: %+v", err)
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{
+			"message": "Listing operations resulted in error!",
+		})
+		return
+	}
+
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{
+		"operations": operations,
+		"nextCursor": nextCursor,
+	})
+	return
+}
+
+// operationFilterOf reads the ListOperations filter from the query params, the error is meant for the client.
+func operationFilterOf(c *gin.Context) (models.OperationFilter, error) {
+	filter := models.OperationFilter{
+		Type:          c.Query("type"),
+		Status:        c.Query("status"),
+		BookId:        c.Query("bookId"),
+		MetadataKey:   c.Query("metadataKey"),
+		MetadataValue: c.Query("metadataValue"),
+	}
+
+	var err error
+	if filter.From, err = util.ParseOptionalTime(c.Query("from")); err != nil {
+		return filter, errors.New("from should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z")
+	}
+	if filter.To, err = util.ParseOptionalTime(c.Query("to")); err != nil {
+		return filter, errors.New("to should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z")
+	}
+	if c.Query("limit") != "" {
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || limit < 1 {
+			return filter, errors.New("limit should be a positive integer")
+		}
+		filter.Limit = limit
+	}
+	if filter.BeforeId, err = util.ParseCursor(c.Query("cursor")); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
 func GetOperationByMemo(c *gin.Context) {
 	appGin := app.Gin{C: c}
 
@@ -65,7 +227,7 @@ func GetOperationByMemo(c *gin.Context) {
 		return
 	}
 
-	opService := &operation_service.OperationService{}
+	opService := &operation_service.OperationService{ServiceName: serviceName(c)}
 	foundOp, err := opService.GetOperation(memo, nil)
 
 	if err != nil {
@@ -80,10 +242,74 @@ func GetOperationByMemo(c *gin.Context) {
 	httpStatus := http.StatusOK
 
 	if foundOp == nil {
+		// a service limited to some books is denied, same as for an operation out of its scope, so that it can't
+		// tell which memos exist.
+		if !authorizeAllBooks(c, auth_service.OperationsRead) {
+			return
+		}
 		status = e.NOT_EXIST
 		httpStatus = http.StatusNotFound
+	} else if err = opService.AuthorizeRead(foundOp); err != nil {
+		appGin.Response(http.StatusForbidden, e.FORBIDDEN, map[string]interface{}{"error": err.Error()})
+		return
 	}
 	// return the operation
 	appGin.Response(httpStatus, status, map[string]interface{}{"operation": foundOp})
 	return
 }
+
+func ReverseOperation(c *gin.Context) {
+	appGin := app.Gin{C: c}
+	memo := c.Param("memo")
+	reqBody := util.GetReqBodyFromCtx(c)
+
+	reason, _ := reqBody["reason"].(string)
+	if reason == "" {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{
+			"message": "Reason for the reversal is not provided!",
+		})
+		return
+	}
+
+	log := logger.Logger.WithFields(logrus.Fields{
+		"memo":   memo,
+		"reason": reason,
+	})
+
+	log.Infof("Reversal Request Received")
+
+	opService := &operation_service.OperationService{ServiceName: serviceName(c)}
+	reversalOp, err := opService.ReverseOperation(memo, reason)
+
+	if errors.Is(err, auth_service.ErrForbidden) {
+		log.Infof("Operation Denied, error: %+v", err)
+		appGin.Response(http.StatusForbidden, e.FORBIDDEN, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, operation_service.ErrOperationNotFound) {
+		appGin.Response(http.StatusNotFound, e.NOT_EXIST, map[string]interface{}{
+			"message": "Operation is not found!",
+		})
+		return
+	}
+	if errors.Is(err, operation_service.ErrOperationAlreadyReversed) || errors.Is(err, operation_service.ErrOperationNotApplied) {
+		appGin.Response(http.StatusConflict, e.CONFLICT, map[string]interface{}{
+			"message": "Operation can't be reversed!",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		log.Errorf("Reversing Operation Failed, error: %+v", err)
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{
+			"message": "Reversing operation resulted in error!",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// return the compensating operation
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"operation": reversalOp})
+	return
+}
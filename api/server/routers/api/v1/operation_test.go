@@ -0,0 +1,79 @@
+package v1
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	asrt "github.com/stretchr/testify/assert"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/util"
+)
+
+func contextOf(url string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", url, nil)
+	return c
+}
+
+func TestOperationFilterOf(t *testing.T) {
+	assert := asrt.New(t)
+
+	filter, err := operationFilterOf(contextOf("/api/v1/operations?type=TRANSFER&status=APPLIED&bookId=4" +
+		"&metadataKey=orderId&metadataValue=42&from=2023-10-17T07:41:55Z&to=2023-10-18T00:00:00Z&limit=10&cursor=120"))
+	if assert.NoError(err) {
+		assert.Equal("TRANSFER", filter.Type)
+		assert.Equal("APPLIED", filter.Status)
+		assert.Equal("4", filter.BookId)
+		assert.Equal("orderId", filter.MetadataKey)
+		assert.Equal("42", filter.MetadataValue)
+		assert.Equal("2023-10-17T07:41:55Z", filter.From.Format("2006-01-02T15:04:05Z07:00"))
+		assert.Equal(18, filter.To.Day())
+		assert.Equal(10, filter.Limit)
+		assert.Equal(uint64(120), filter.BeforeId)
+	}
+
+	filter, err = operationFilterOf(contextOf("/api/v1/operations"))
+	if assert.NoError(err) {
+		assert.Nil(filter.From)
+		assert.Equal(0, filter.Limit, "service default applies")
+		assert.Equal(uint64(0), filter.BeforeId, "first page")
+	}
+
+	for _, query := range []string{"from=yesterday", "to=2023-10-18", "limit=0", "limit=ten", "cursor=abc", "cursor=-1"} {
+		_, err = operationFilterOf(contextOf("/api/v1/operations?" + query))
+		assert.Error(err, query)
+	}
+	_, err = operationFilterOf(contextOf("/api/v1/operations?cursor=abc"))
+	assert.ErrorIs(err, util.ErrInvalidCursor)
+}
+
+func TestOperationRequestOfBodyKeepsDigits(t *testing.T) {
+	assert := asrt.New(t)
+
+	c := contextOf("/api/v1/operations/batch")
+	// 12345678901234567 is past 2^53, a float64 would make it 12345678901234568.
+	c.Set("requestBodyBytes", []byte(`{"continueOnError": true, "operations": [{"type": "TRANSFER", "memo": "big-ids",
+		"entries": [{"bookId": 12345678901234567, "assetId": "btc", "value": -1234567890.123456789},
+			{"bookId": "3", "assetId": "btc", "value": 1234567890.123456789}],
+		"metadata": {"operation": "TRANSFER", "orderId": 12345678901234567}}]}`))
+
+	reqBody := util.GetReqBodyFromCtx(c)
+	assert.Equal(true, reqBody["continueOnError"])
+	operations, _ := reqBody["operations"].([]interface{})
+	if !assert.Len(operations, 1) {
+		return
+	}
+	op, err := models.NewOperationRequest(operations[0].(map[string]interface{}))
+	if assert.NoError(err) {
+		assert.Equal("12345678901234567", op.Entries[0].BookId)
+		assert.Equal("-1234567890.123456789", op.Entries[0].Value.String())
+		assert.Equal("1234567890.123456789", op.Entries[1].Value.String())
+		assert.Equal("12345678901234567", fmt.Sprint(op.Metadata["orderId"]))
+	}
+
+	c.Set("requestBodyBytes", []byte(`{"memo": "trailing"} {}`))
+	assert.Nil(util.GetReqBodyFromCtx(c))
+}
@@ -0,0 +1,76 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/app"
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
+	"general_ledger_golang/service/posting_service"
+)
+
+// GetBookPostings returns the statement of a book, its postings with a running balance, oldest first.
+// Supports assetId, operationType, from/to (RFC3339) filters and cursor based pagination (cursor, limit).
+func GetBookPostings(c *gin.Context) {
+	appGin := app.Gin{C: c}
+
+	filter := models.PostingFilter{
+		BookId:        c.Param("bookId"),
+		AssetId:       c.Query("assetId"),
+		OperationType: c.Query("operationType"),
+	}
+
+	if !authorizeBook(c, auth_service.PostingsRead, filter.BookId) {
+		return
+	}
+
+	var err error
+	if filter.From, err = util.ParseOptionalTime(c.Query("from")); err != nil {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": "from should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z"})
+		return
+	}
+	if filter.To, err = util.ParseOptionalTime(c.Query("to")); err != nil {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": "to should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z"})
+		return
+	}
+
+	if c.Query("limit") != "" {
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || limit < 1 {
+			appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": "limit should be a positive integer"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	afterId, err := util.ParseCursor(c.Query("cursor"))
+	if err != nil {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	filter.AfterId = afterId
+
+	postingService := posting_service.PostingService{}
+	postings, nextCursor, err := postingService.GetStatement(filter)
+
+	if errors.Is(err, posting_service.ErrInvalidStatementQuery) {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{
+		"postings":   postings,
+		"nextCursor": nextCursor,
+	})
+	return
+}
@@ -0,0 +1,71 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"general_ledger_golang/pkg/app"
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
+	"general_ledger_golang/service/report_service"
+)
+
+// GetTrialBalance returns every book's debit and credit totals per asset, as of asOf (RFC3339, now if not given),
+// optionally for a single assetId, and whether those net to zero.
+func GetTrialBalance(c *gin.Context) {
+	appGin := app.Gin{C: c}
+	if !authorizeAllBooks(c, auth_service.ReportsRead) {
+		return
+	}
+
+	asOf, err := util.ParseOptionalTime(c.Query("asOf"))
+	if err != nil {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": "asOf should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z"})
+		return
+	}
+
+	reportService := report_service.ReportService{}
+	report, err := reportService.GetTrialBalance(asOf, c.Query("assetId"))
+
+	if err != nil {
+		logger.Logger.Errorf("Trial balance failed, error: %+v", err)
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"trialBalance": report})
+	return
+}
+
+// GetBalanceSheet returns the books' totals grouped by account type, or by a metadata key
+// (groupBy=metadata.<key>), per asset, as of asOf (RFC3339, now if not given), optionally for a single assetId.
+func GetBalanceSheet(c *gin.Context) {
+	appGin := app.Gin{C: c}
+	if !authorizeAllBooks(c, auth_service.ReportsRead) {
+		return
+	}
+
+	asOf, err := util.ParseOptionalTime(c.Query("asOf"))
+	if err != nil {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": "asOf should be a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z"})
+		return
+	}
+
+	reportService := report_service.ReportService{}
+	report, err := reportService.GetBalanceSheet(asOf, c.Query("assetId"), c.Query("groupBy"))
+
+	if errors.Is(err, report_service.ErrInvalidReportQuery) {
+		appGin.Response(http.StatusBadRequest, e.INVALID_PARAMS, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Logger.Errorf("Balance sheet failed, error: %+v", err)
+		appGin.Response(http.StatusInternalServerError, e.ERROR, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	appGin.Response(http.StatusOK, e.SUCCESS, map[string]interface{}{"balanceSheet": report})
+	return
+}
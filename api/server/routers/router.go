@@ -1,9 +1,12 @@
 package routers
 
 import (
+	"expvar"
+
 	v1 "general_ledger_golang/api/server/routers/api/v1"
 	"general_ledger_golang/middleware"
 	"general_ledger_golang/models"
+	"general_ledger_golang/service/auth_service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,22 +22,57 @@ func InitRouter() *gin.Engine {
 	r.Use(middleware.CORS())
 	r.Use(gin.CustomRecovery(middleware.ErrorHandler))
 
+	// metrics (expvar), ex: db transaction retries, Jwt protected like the admin routes.
+	r.GET("/debug/vars", middleware.JWT(), gin.WrapH(expvar.Handler()))
+
 	// apiV1 groups
 	apiV1 := r.Group("/api/v1")
 
 	// Jwt unprotected routes
 	apiV1.GET("/test", v1.TestAppStatus)
 
+	// Service token protected routes, read routes need a read (or write) token, others need a write token,
+	// the service's scope should have the route's permission.
 	// Books route
 	apiV1BooksGroup := apiV1.Group("/books")
-	apiV1BooksGroup.POST("/", middleware.UseRequestBody(), v1.CreateOrUpdateBook)
-	apiV1BooksGroup.GET("/:bookId", v1.GetBook)
-	apiV1BooksGroup.GET("/:bookId/balance", v1.GetBookBalance)
+	apiV1BooksGroup.POST("/", middleware.ServiceAuth(auth_service.BooksWrite), middleware.UseRequestBody(), v1.CreateOrUpdateBook)
+	apiV1BooksGroup.GET("/", middleware.ServiceAuth(auth_service.BooksRead), v1.GetBookByName)
+	apiV1BooksGroup.GET("/:bookId", middleware.ServiceAuth(auth_service.BooksRead), v1.GetBook)
+	apiV1BooksGroup.GET("/:bookId/balance", middleware.ServiceAuth(auth_service.BalancesRead), v1.GetBookBalance)
+	apiV1BooksGroup.GET("/:bookId/postings", middleware.ServiceAuth(auth_service.PostingsRead), v1.GetBookPostings)
+
+	// Assets route
+	apiV1AssetsGroup := apiV1.Group("/assets")
+	apiV1AssetsGroup.POST("/", middleware.ServiceAuth(auth_service.AssetsWrite), middleware.UseRequestBody(), v1.CreateOrUpdateAsset)
+	apiV1AssetsGroup.GET("/", middleware.ServiceAuth(auth_service.AssetsRead), v1.GetAssets)
+	apiV1AssetsGroup.GET("/:code", middleware.ServiceAuth(auth_service.AssetsRead), v1.GetAsset)
+	apiV1AssetsGroup.DELETE("/:code", middleware.ServiceAuth(auth_service.AssetsWrite), v1.DeleteAsset)
 
 	// Operations route
 	apiV1OperationsGroup := apiV1.Group("/operations")
-	apiV1OperationsGroup.POST("/", middleware.UseRequestBody(), middleware.ReqBodySanitizer(models.ValidatePostOperation), v1.PostOperation)
-	apiV1OperationsGroup.GET("/", v1.GetOperationByMemo)
+	apiV1OperationsGroup.POST("/", middleware.ServiceAuth(auth_service.OperationsWrite), middleware.UseRequestBody(), middleware.ReqBodySanitizer(models.ValidatePostOperation), v1.PostOperation)
+	apiV1OperationsGroup.POST("/batch", middleware.ServiceAuth(auth_service.OperationsWrite), middleware.UseRequestBody(), middleware.ReqBodySanitizer(models.ValidatePostOperationBatch), v1.PostOperationBatch)
+	apiV1OperationsGroup.GET("/", middleware.ServiceAuth(auth_service.OperationsRead), v1.GetOperations)
+	apiV1OperationsGroup.POST("/:memo/reverse", middleware.ServiceAuth(auth_service.OperationsWrite), middleware.UseRequestBody(), v1.ReverseOperation)
+
+	// Holds route
+	apiV1HoldsGroup := apiV1.Group("/holds")
+	apiV1HoldsGroup.POST("/", middleware.ServiceAuth(auth_service.HoldsWrite), middleware.UseRequestBody(), v1.CreateHold)
+	apiV1HoldsGroup.GET("/:memo", middleware.ServiceAuth(auth_service.HoldsRead), v1.GetHold)
+	apiV1HoldsGroup.POST("/:memo/capture", middleware.ServiceAuth(auth_service.HoldsWrite), middleware.UseRequestBody(), v1.CaptureHold)
+	apiV1HoldsGroup.POST("/:memo/release", middleware.ServiceAuth(auth_service.HoldsWrite), v1.ReleaseHold)
+
+	// Reports route
+	apiV1ReportsGroup := apiV1.Group("/reports")
+	apiV1ReportsGroup.GET("/trial-balance", middleware.ServiceAuth(auth_service.ReportsRead), v1.GetTrialBalance)
+	apiV1ReportsGroup.GET("/balance-sheet", middleware.ServiceAuth(auth_service.ReportsRead), v1.GetBalanceSheet)
+
+	// Admin routes, Jwt protected
+	apiV1AdminGroup := apiV1.Group("/admin", middleware.JWT())
+	apiV1AdminGroup.GET("/reconcile", v1.GetReconciliation)
+	apiV1AdminGroup.POST("/reconcile/fix", v1.FixReconciliation)
+	apiV1AdminGroup.GET("/verify-chain", v1.VerifyPostingChain)
+
 	// Jwt protected routes
 
 	apiV1.GET("/secured/test", middleware.JWT(), v1.TestAppStatus)
@@ -18,6 +18,9 @@ import (
 	"general_ledger_golang/pkg/database/migrations/auto"
 	"general_ledger_golang/pkg/logger"
 	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
+	"general_ledger_golang/service/hold_service"
+	"general_ledger_golang/service/outbox_service"
 )
 
 func init() {
@@ -41,6 +44,7 @@ func init() {
 
 	logger.Setup()
 	util.Setup()
+	auth_service.LogPolicy()
 }
 
 // In case, http and grpc both are required, start this.
@@ -50,6 +54,15 @@ func main() {
 
 	go grpcserver.RegisterGrpcServer(conf.ServerSetting.GrpcPort)
 
+	holdService := hold_service.HoldService{}
+	go holdService.StartExpirySweeper(config.GetLedgerSetting().HoldExpirySweepInterval)
+
+	sequencer := outbox_service.EventSequencer{}
+	go sequencer.Start(config.GetLedgerSetting().WatchPollInterval)
+
+	dispatcher := outbox_service.NewDispatcher(config.GetWebhookSetting())
+	go dispatcher.Start(config.GetWebhookSetting().PollInterval)
+
 	router := routers.InitRouter()
 	readTimeout := conf.ServerSetting.ReadTimeout
 	writeTimeout := conf.ServerSetting.WriteTimeout
@@ -14,6 +14,9 @@ import (
 	"general_ledger_golang/pkg/database/migrations/auto"
 	"general_ledger_golang/pkg/logger"
 	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
+	"general_ledger_golang/service/hold_service"
+	"general_ledger_golang/service/outbox_service"
 )
 
 func init() {
@@ -37,12 +40,22 @@ func init() {
 
 	logger.Setup()
 	util.Setup()
+	auth_service.LogPolicy()
 }
 
 // In-case, only grpc server is needed, http is not required, start this.
 func main() {
 	conf := config.GetConfig()
 
+	holdService := hold_service.HoldService{}
+	go holdService.StartExpirySweeper(config.GetLedgerSetting().HoldExpirySweepInterval)
+
+	sequencer := outbox_service.EventSequencer{}
+	go sequencer.Start(config.GetLedgerSetting().WatchPollInterval)
+
+	dispatcher := outbox_service.NewDispatcher(config.GetWebhookSetting())
+	go dispatcher.Start(config.GetWebhookSetting().PollInterval)
+
 	grpcserver.RegisterGrpcServer(conf.ServerSetting.GrpcPort)
 
 	logger.Logger.Infof("Actual pid is %d", syscall.Getpid())
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/thoas/go-funk"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/config"
+	"general_ledger_golang/pkg/database"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/service/reconcile_service"
+)
+
+func init() {
+	// use dotenv if explicitly marked enabled, else use dotenv only in local.
+	if os.Getenv("DOT_ENV") == "enable" || funk.ContainsString([]string{"local", "localhost"}, os.Getenv("APP_ENV")) {
+		err := godotenv.Load()
+		logger.Logger.Info(".env Loaded")
+		if err != nil {
+			logger.Logger.Fatalf("Couldn't load .env, error: %+v", err)
+		}
+	}
+	config.Setup("./pkg/config/")
+	database.Setup()
+	models.Setup()
+	logger.Setup()
+}
+
+// Recomputes every balance from postings and reports the drifts as json, on stdout.
+// With --fix, the drifted balances are rewritten. Exits with 1 if drifts are found and not fixed,
+// so that it can be used as a nightly check.
+func main() {
+	fix := flag.Bool("fix", false, "rewrite the drifted balances with the ones computed from postings")
+	flag.Parse()
+
+	reconcileService := reconcile_service.ReconcileService{}
+	report, err := reconcileService.Reconcile(*fix)
+	if err != nil {
+		logger.Logger.Fatalf("Reconciliation failed, error: %+v", err)
+	}
+
+	reportBytes, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(reportBytes))
+
+	logger.Logger.Infof("Reconciliation done, checked: %d, drifts: %d, fixed: %v", report.Checked, len(report.Drifts), report.Fixed)
+	if len(report.Drifts) > 0 && !report.Fixed {
+		os.Exit(1)
+	}
+}
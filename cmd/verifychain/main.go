@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/thoas/go-funk"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/config"
+	"general_ledger_golang/pkg/database"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/service/posting_service"
+)
+
+func init() {
+	// use dotenv if explicitly marked enabled, else use dotenv only in local.
+	if os.Getenv("DOT_ENV") == "enable" || funk.ContainsString([]string{"local", "localhost"}, os.Getenv("APP_ENV")) {
+		err := godotenv.Load()
+		logger.Logger.Info(".env Loaded")
+		if err != nil {
+			logger.Logger.Fatalf("Couldn't load .env, error: %+v", err)
+		}
+	}
+	config.Setup("./pkg/config/")
+	database.Setup()
+	models.Setup()
+	logger.Setup()
+}
+
+// Walks the hash chain of the postings of a book (every book, without --book) and prints the report as json,
+// on stdout. Exits with 1 if a broken link is found.
+func main() {
+	bookId := flag.String("book", "", "bookId whose chain is verified, every book if empty")
+	flag.Parse()
+
+	postingService := posting_service.PostingService{}
+	report, err := postingService.VerifyChain(*bookId)
+	if err != nil {
+		logger.Logger.Fatalf("Chain verification failed, bookId: %s, error: %+v", *bookId, err)
+	}
+
+	reportBytes, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(reportBytes))
+
+	logger.Logger.Infof("Chain verification done, bookId: %s, checked: %d, valid: %v", *bookId, report.Checked, report.Valid)
+	if !report.Valid {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"general_ledger_golang/pkg/e"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/service/auth_service"
+)
+
+// ServiceAuth is the service token middleware, the calling service sends its name and token in the
+// X-Service-Name and X-Service-Token headers, the token should be its read (or write) token for read permissions,
+// its write token otherwise. The service's scope should have the permission as well.
+func ServiceAuth(permission auth_service.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code := e.SUCCESS
+		checkType := permission.CheckType()
+		serviceName := c.GetHeader(auth_service.ServiceNameHeader)
+		token := c.GetHeader(auth_service.ServiceTokenHeader)
+
+		auth := auth_service.Auth{ServiceName: serviceName, ServiceToken: token}
+		if serviceName == "" || token == "" {
+			code = e.MISSING_AUTH_HEADER
+		} else if !auth.Check(token, checkType, serviceName) {
+			code = e.ERROR_AUTH_TOKEN
+		}
+
+		if code != e.SUCCESS {
+			logger.Logger.Warnf("Service %q is not authorized to %s %s %s", serviceName, checkType, c.Request.Method, c.FullPath())
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code": code,
+				"msg":  e.GetMsg(code),
+				"data": nil,
+			})
+
+			c.Abort()
+			return
+		}
+
+		if err := auth.Authorize(permission); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code": e.FORBIDDEN,
+				"msg":  e.GetMsg(e.FORBIDDEN),
+				"data": map[string]interface{}{"error": err.Error()},
+			})
+
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
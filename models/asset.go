@@ -0,0 +1,175 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+	"github.com/thoas/go-funk"
+	"gorm.io/gorm"
+)
+
+// MaxAssetScale is the max decimal places an asset can have, as book_balances.balance is numeric(32,8).
+const MaxAssetScale = 8
+
+// Asset is a registered asset, entries can only move registered assets.
+//
+// Code is what entries refer to as assetId, it's matched exactly (case-sensitive), so `INR` and `inr` are
+// different assets. Scale is the max decimal places an entry value of this asset can have.
+// Min/Max transfer amounts are checked against the absolute value of each entry, null means no limit.
+type Asset struct {
+	Model
+	Code              string              `gorm:"index;unique" json:"code"`
+	Name              string              `json:"name"`
+	Scale             int32               `json:"scale"`
+	MinTransferAmount decimal.NullDecimal `gorm:"type:numeric(32,8);column:minTransferAmount" json:"minTransferAmount"`
+	MaxTransferAmount decimal.NullDecimal `gorm:"type:numeric(32,8);column:maxTransferAmount" json:"maxTransferAmount"`
+}
+
+// CreateOrUpdateAsset updates the asset with the same code, or creates it. Returns "create" or "update".
+func (a *Asset) CreateOrUpdateAsset(asset *Asset) (string, error) {
+	// select the columns explicitly, otherwise zero values (ex: scale 0, no min amount) are skipped on update.
+	updateResult := db.Model(&Asset{}).
+		Select("name", "scale", "minTransferAmount", "maxTransferAmount", "updatedAt").
+		Where("code = ?", asset.Code).
+		Updates(asset)
+	if updateResult.Error == nil && updateResult.RowsAffected == 0 {
+		return "create", db.Create(asset).Error
+	}
+	return "update", updateResult.Error
+}
+
+func (a *Asset) GetAsset(code string, tx *gorm.DB) (*Asset, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+	asset := Asset{}
+	res := d.Model(&a).Where("code = ?", code).Limit(1).Find(&asset)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &asset, nil
+}
+
+// GetAssets returns the assets with the given codes, all assets if no code is given.
+func (a *Asset) GetAssets(codes []string, tx *gorm.DB) (*[]Asset, error) {
+	var assets []Asset
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+	q := d.Model(&a)
+	if len(codes) > 0 {
+		q = q.Where("code IN ?", funk.UniqString(codes))
+	}
+
+	res := q.Order("code").Find(&assets)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &assets, nil
+}
+
+func (a *Asset) DeleteAsset(code string, tx *gorm.DB) (int64, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+	res := d.Where("code = ?", code).Delete(&Asset{})
+	return res.RowsAffected, res.Error
+}
+
+// IsAssetInUse checks if any posting has moved the asset.
+func (a *Asset) IsAssetInUse(code string, tx *gorm.DB) (bool, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+	var count int64
+	res := d.Model(&Posting{}).Where(`"assetId" = ?`, code).Count(&count)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return count > 0, nil
+}
+
+// ValidateEntries checks every entry against the registered assets, and returns the problems found.
+// Unknown assetIds, values with more decimals than the asset's scale and values outside the
+// min/max transfer amounts are reported. Returned error is only for db/unexpected failures.
+func (a *Asset) ValidateEntries(entries []Entry, tx *gorm.DB) ([]string, error) {
+	return ValidateEntries(a, entries, tx)
+}
+
+// ValidateEntries works like Asset.ValidateEntries, with the assets of the given repository.
+func ValidateEntries(repository AssetRepository, entries []Entry, tx *gorm.DB) ([]string, error) {
+	var codes []string
+	for _, entry := range entries {
+		codes = append(codes, entry.AssetId)
+	}
+	if len(codes) < 1 {
+		return []string{"entries are empty"}, nil
+	}
+
+	assets, err := repository.GetAssets(codes, tx)
+	if err != nil {
+		return nil, err
+	}
+	assetsByCode := map[string]Asset{}
+	if assets != nil {
+		for _, asset := range *assets {
+			assetsByCode[asset.Code] = asset
+		}
+	}
+
+	var problems []string
+	for _, entry := range entries {
+		asset, ok := assetsByCode[entry.AssetId]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("assetId %s is not registered", entry.AssetId))
+			continue
+		}
+		if problem := asset.ValidateValue(entry.Value); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	return problems, nil
+}
+
+// ValidateValue checks a single entry value against the asset's scale and transfer limits,
+// returns the problem, empty string if the value is fine.
+func (a *Asset) ValidateValue(value decimal.Decimal) string {
+	if !value.Round(a.Scale).Equal(value) {
+		return fmt.Sprintf("value %s of %s has more than %d decimal places", value.String(), a.Code, a.Scale)
+	}
+	amount := value.Abs()
+	if a.MinTransferAmount.Valid && amount.LessThan(a.MinTransferAmount.Decimal) {
+		return fmt.Sprintf("value %s of %s is below the min transfer amount %s", value.String(), a.Code, a.MinTransferAmount.Decimal.String())
+	}
+	if a.MaxTransferAmount.Valid && amount.GreaterThan(a.MaxTransferAmount.Decimal) {
+		return fmt.Sprintf("value %s of %s is above the max transfer amount %s", value.String(), a.Code, a.MaxTransferAmount.Decimal.String())
+	}
+	return ""
+}
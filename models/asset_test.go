@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestAssetValidateValue(t *testing.T) {
+	inr := Asset{
+		Code:              "inr",
+		Scale:             2,
+		MinTransferAmount: decimal.NullDecimal{Decimal: decimal.RequireFromString("1"), Valid: true},
+		MaxTransferAmount: decimal.NullDecimal{Decimal: decimal.RequireFromString("100000"), Valid: true},
+	}
+
+	cases := map[string]bool{
+		"10":       true,
+		"-10.25":   true,
+		"10.50":    true,
+		"10.001":   false,
+		"0.5":      false,
+		"-0.5":     false,
+		"100000":   true,
+		"100000.1": false,
+	}
+
+	for value, valid := range cases {
+		problem := inr.ValidateValue(decimal.RequireFromString(value))
+		if valid && problem != "" {
+			t.Errorf("%s should be valid, got: %s", value, problem)
+		}
+		if !valid && problem == "" {
+			t.Errorf("%s should be invalid", value)
+		}
+	}
+
+	// no limits, only scale is checked.
+	btc := Asset{Code: "btc", Scale: 8}
+	if problem := btc.ValidateValue(decimal.RequireFromString("0.00000001")); problem != "" {
+		t.Errorf("0.00000001 btc should be valid, got: %s", problem)
+	}
+	if problem := btc.ValidateValue(decimal.RequireFromString("0.000000001")); problem == "" {
+		t.Errorf("0.000000001 btc should be invalid")
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BalanceTrackingPolicy decides which books have their balances kept in the book_balances table.
+// Books are matched by exact id, the zero value tracks every book.
+type BalanceTrackingPolicy struct {
+	excluded map[string]bool
+}
+
+// balanceTrackingPolicy is the policy in use, set by Setup from the ledger config.
+var balanceTrackingPolicy BalanceTrackingPolicy
+
+// NewBalanceTrackingPolicy returns a policy which tracks every book except excludedBookIds.
+// Ids are trimmed, empty ones are ignored, and every id should be an integer, ex: ["1", "-1", "0"].
+func NewBalanceTrackingPolicy(excludedBookIds []string) (BalanceTrackingPolicy, error) {
+	policy := BalanceTrackingPolicy{excluded: map[string]bool{}}
+	for _, bookId := range excludedBookIds {
+		bookId = strings.TrimSpace(bookId)
+		if bookId == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(bookId, 10, 64)
+		if err != nil {
+			return BalanceTrackingPolicy{}, fmt.Errorf("excluded balance bookId %q is not an integer", bookId)
+		}
+		// canonical form, so that "01" excludes book 1.
+		policy.excluded[strconv.FormatInt(id, 10)] = true
+	}
+	return policy, nil
+}
+
+// IsTracked tells if the balances of bookId are kept in the book_balances table.
+func (p BalanceTrackingPolicy) IsTracked(bookId string) bool {
+	return !p.excluded[canonicalBookId(bookId)]
+}
+
+// canonicalBookId trims bookId, and drops the leading zeros and plus sign of an integer, ex: " 01" is "1".
+// Anything else is returned trimmed.
+func canonicalBookId(bookId string) string {
+	bookId = strings.TrimSpace(bookId)
+	if id, err := strconv.ParseInt(bookId, 10, 64); err == nil {
+		return strconv.FormatInt(id, 10)
+	}
+	return bookId
+}
+
+// String describes the policy, ex: "every book except 1, 2".
+func (p BalanceTrackingPolicy) String() string {
+	if len(p.excluded) == 0 {
+		return "every book"
+	}
+	var bookIds []string
+	for bookId := range p.excluded {
+		bookIds = append(bookIds, bookId)
+	}
+	sort.Strings(bookIds)
+	return "every book except " + strings.Join(bookIds, ", ")
+}
+
+// SetBalanceTrackingPolicy replaces the policy in use.
+func SetBalanceTrackingPolicy(policy BalanceTrackingPolicy) {
+	balanceTrackingPolicy = policy
+}
+
+// IsBalanceTracked tells if the balances of the book are kept in the book_balances table, as per the policy in use.
+func IsBalanceTracked(bookId string) bool {
+	return balanceTrackingPolicy.IsTracked(bookId)
+}
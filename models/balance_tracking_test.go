@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+
+	asrt "github.com/stretchr/testify/assert"
+)
+
+func TestBalanceTrackingPolicy(t *testing.T) {
+	assert := asrt.New(t)
+
+	policy, err := NewBalanceTrackingPolicy([]string{"1", " 2", "", "-1"})
+	assert.NoError(err)
+	assert.False(policy.IsTracked("1"))
+	assert.False(policy.IsTracked("2"))
+	assert.False(policy.IsTracked("-1"))
+	// exact ids, not substrings.
+	assert.True(policy.IsTracked("11"))
+	assert.True(policy.IsTracked("12"))
+	assert.True(policy.IsTracked("21"))
+	assert.True(policy.IsTracked("100"))
+	assert.Equal("every book except -1, 1, 2", policy.String())
+
+	policy, err = NewBalanceTrackingPolicy([]string{"01"})
+	assert.NoError(err)
+	assert.False(policy.IsTracked("1"))
+	assert.False(policy.IsTracked("001"))
+	assert.False(policy.IsTracked(" +1"))
+	assert.True(policy.IsTracked("1a"))
+
+	_, err = NewBalanceTrackingPolicy([]string{"1;2"})
+	assert.Error(err)
+
+	policy, err = NewBalanceTrackingPolicy(nil)
+	assert.NoError(err)
+	assert.True(policy.IsTracked("1"))
+	assert.Equal("every book", policy.String())
+	assert.True(BalanceTrackingPolicy{}.IsTracked("1"))
+}
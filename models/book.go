@@ -1,32 +1,95 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
 
+	"github.com/shopspring/decimal"
 	"github.com/thoas/go-funk"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+type AccountType string
+
+const (
+	AccountAsset     AccountType = "ASSET"
+	AccountLiability AccountType = "LIABILITY"
+	AccountEquity    AccountType = "EQUITY"
+	AccountRevenue   AccountType = "REVENUE"
+	AccountExpense   AccountType = "EXPENSE"
+)
+
+// AccountTypes are the account types in the order of a chart of accounts.
+var AccountTypes = []AccountType{AccountAsset, AccountLiability, AccountEquity, AccountRevenue, AccountExpense}
+
+type NormalSide string
+
+const (
+	NormalDebit  NormalSide = "DEBIT"
+	NormalCredit NormalSide = "CREDIT"
+)
+
+// DefaultNormalSide is the side on which balances of the account type increase:
+// assets and expenses are debit normal, liabilities, equity and revenue are credit normal.
+func DefaultNormalSide(accountType AccountType) NormalSide {
+	if accountType == AccountAsset || accountType == AccountExpense {
+		return NormalDebit
+	}
+	return NormalCredit
+}
+
+type BalancePolicy string
+
+const (
+	// BalanceStrict doesn't let the OVERALL balance of the book go below zero, it's the default.
+	BalanceStrict BalancePolicy = "STRICT"
+	// BalanceAllowNegative lets the OVERALL balance go negative without a limit, ex: the company's cash book.
+	BalanceAllowNegative BalancePolicy = "ALLOW_NEGATIVE"
+	// BalanceOverdraft lets the OVERALL balance of an asset go negative up to the book's overdraft limit of the asset,
+	// ex: margin accounts. Assets without a limit can't go negative.
+	BalanceOverdraft BalancePolicy = "OVERDRAFT"
+)
+
+// BalancePolicies are the valid balance policies.
+var BalancePolicies = []BalancePolicy{BalanceStrict, BalanceAllowNegative, BalanceOverdraft}
+
+// Book is an account of the ledger. AccountType, ParentId and NormalSide place it in the chart of accounts,
+// those are empty for untyped books. A parent's balance can be rolled up across its descendants.
 type Book struct {
 	Model
-	Name     string         `gorm:"index;unique" json:"name"`
-	Metadata datatypes.JSON `json:"metadata"`
+	Name        string         `gorm:"index;unique" json:"name"`
+	Metadata    datatypes.JSON `json:"metadata"`
+	AccountType string         `gorm:"index;column:accountType" json:"accountType"`
+	ParentId    string         `gorm:"index;column:parentId" json:"parentId"`
+	NormalSide  string         `gorm:"column:normalSide" json:"normalSide"`
+	// BalancePolicy tells how far the OVERALL balance can go below zero, OverdraftLimits are
+	// the limits (positive amounts) per assetId, for the OVERDRAFT policy, ex: {"btc": "0.5"}.
+	BalancePolicy   string         `gorm:"column:balancePolicy;default:STRICT" json:"balancePolicy"`
+	OverdraftLimits datatypes.JSON `gorm:"column:overdraftLimits" json:"overdraftLimits"`
 }
 
-func (b *Book) CreateOrUpdateBook(book *Book) (*gorm.DB, string) {
+// bookColumns are the columns selected while fetching books.
+var bookColumns = []string{"id", "name", "metadata", "accountType", "parentId", "normalSide", "balancePolicy", "overdraftLimits", `createdAt`, `updatedAt`}
+
+// CreateOrUpdateBook updates the book with the same name, or creates it if there's none.
+// Returns "create" or "update", and the book has its id set.
+func (b *Book) CreateOrUpdateBook(book *Book) (string, error) {
 	var updateResult *gorm.DB
 	if updateResult = db.Model(&book).Where("name = ?", book.Name).Updates(&book); updateResult.RowsAffected == 0 {
-		return db.Create(&book), "create"
+		return "create", db.Create(&book).Error
 	}
-	return updateResult, "update"
+	return "update", updateResult.Error
 }
 
 func (b *Book) GetBook(bookId string) (*Book, error) {
 	book := Book{}
 	q := db.Model(&b).Where("id = ?", bookId)
 
-	res := q.Select("id", "name", "metadata", `createdAt`, `updatedAt`).Find(&book)
+	res := q.Select(bookColumns).Find(&book)
 	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -51,7 +114,7 @@ func (b *Book) GetBooks(bookIds []string, tx *gorm.DB) (*[]Book, error) {
 	bookIdsUnique := funk.UniqString(bookIds)
 	q := d.Model(&b).Where("id IN ?", bookIdsUnique)
 
-	res := q.Select("id", "name", "metadata", `createdAt`, `updatedAt`).Find(&books)
+	res := q.Select(bookColumns).Find(&books)
 	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -63,3 +126,102 @@ func (b *Book) GetBooks(bookIds []string, tx *gorm.DB) (*[]Book, error) {
 	}
 	return &books, nil
 }
+
+// GetBookByName returns the book with the name, nil if there's none.
+func (b *Book) GetBookByName(name string, tx *gorm.DB) (*Book, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+
+	book := Book{}
+	res := d.Model(&Book{}).Where("name = ?", name).Select(bookColumns).Limit(1).Find(&book)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &book, nil
+}
+
+// GetAncestorIds returns the ids of the ancestors of bookId, nearest first. It stops at a cycle, if there's any.
+func (b *Book) GetAncestorIds(bookId string, tx *gorm.DB) ([]string, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+
+	var ancestorIds []string
+	res := d.Raw(`WITH RECURSIVE ancestors(id, depth) AS (
+			SELECT "parentId", 1 FROM books WHERE id::text = ? AND "parentId" != ''
+			UNION
+			SELECT b."parentId", a.depth + 1 FROM books b JOIN ancestors a ON b.id::text = a.id
+			WHERE b."parentId" != '' AND a.depth < 1000
+		)
+		SELECT id FROM ancestors GROUP BY id ORDER BY MIN(depth)`, bookId).Scan(&ancestorIds)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return ancestorIds, nil
+}
+
+// BalanceLimit returns the lowest OVERALL balance the book can have for assetId, nil if there's no limit.
+func (b *Book) BalanceLimit(assetId string) (*decimal.Decimal, error) {
+	switch BalancePolicy(b.BalancePolicy) {
+	case BalanceAllowNegative:
+		return nil, nil
+	case BalanceOverdraft:
+		limits := map[string]decimal.Decimal{}
+		if len(b.OverdraftLimits) > 0 {
+			if err := json.Unmarshal(b.OverdraftLimits, &limits); err != nil {
+				return nil, fmt.Errorf("overdraftLimits of book %d are malformed: %w", b.Id, err)
+			}
+		}
+		lowest := limits[assetId].Abs().Neg()
+		return &lowest, nil
+	default:
+		// STRICT, books created before the policies have it empty.
+		lowest := decimal.Zero
+		return &lowest, nil
+	}
+}
+
+// LockBooks row locks the books until tx ends, in id order. Whatever changes balances (operations, holds) locks
+// the books first, and the balance rows after, so that concurrent transactions on the same books don't deadlock.
+func (b *Book) LockBooks(bookIds []string, tx *gorm.DB) error {
+	if tx == nil {
+		return errors.New("LockBooks requires a transaction")
+	}
+	var lockedIds []uint64
+	return tx.Model(&Book{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", funk.UniqString(bookIds)).Order("id").Pluck("id", &lockedIds).Error
+}
+
+// GetBooksForPolicy returns the books (only the balance policy columns) by id.
+func (b *Book) GetBooksForPolicy(bookIds []string, tx *gorm.DB) (map[string]Book, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+
+	var books []Book
+	res := d.Model(&Book{}).Where("id IN ?", funk.UniqString(bookIds)).Select("id", "balancePolicy", "overdraftLimits").Find(&books)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	result := map[string]Book{}
+	for _, book := range books {
+		result[strconv.FormatUint(book.Id, 10)] = book
+	}
+	return result, nil
+}
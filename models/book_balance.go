@@ -3,85 +3,193 @@ package models
 import (
 	"errors"
 	"fmt"
-	"os"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
 	"general_ledger_golang/pkg/logger"
-	"general_ledger_golang/pkg/util"
 )
 
+// BookBalance is the running balance of a book for an asset and an operation type.
+//
+// Balance is kept as decimal.Decimal (never float64) so that amounts with 8 decimal places
+// (ex: crypto) round trip without any loss, it's rendered as a canonical string in JSON.
 type BookBalance struct {
 	Model
-	BookId        string  `gorm:"primaryKey;index;column:bookId" json:"bookId"`
-	AssetId       string  `gorm:"primaryKey;index;column:assetId" json:"assetId"`
-	OperationType string  `gorm:"primaryKey;index;column:operationType" json:"operationType"`
-	Balance       float64 `gorm:"type:numeric(32,8);check:non_negative_balance,balance >= 0 OR \"operationType\" != 'OVERALL' OR \"bookId\" = '1'" json:"balance"`
+	BookId        string          `gorm:"primaryKey;index;column:bookId" json:"bookId"`
+	AssetId       string          `gorm:"primaryKey;index;column:assetId" json:"assetId"`
+	OperationType string          `gorm:"primaryKey;index;column:operationType" json:"operationType"`
+	Balance       decimal.Decimal `gorm:"type:numeric(32,8)" json:"balance"`
 }
 
 const (
 	OverallOperation string = "OVERALL"
+	// HeldOperation balance is the amount reserved by active holds, it's already taken out of OVERALL.
+	HeldOperation string = "HELD"
 )
 
-func (bB *BookBalance) ModifyBalance(operation map[string]interface{}, db *gorm.DB) error {
+// BalanceChange is a change to the balance of a single operationType.
+type BalanceChange struct {
+	OperationType string
+	Value         decimal.Decimal
+}
+
+var errNoOperationType = errors.New("operation type is not present, creation of book balance depends on metadata[\"operation\"], please send metadata with operation")
+
+// InsufficientBalanceError is returned when a balance change takes the OVERALL balance of a book below the lowest
+// balance its balance policy allows (Limit, zero for STRICT books).
+type InsufficientBalanceError struct {
+	BookId  string
+	AssetId string
+	Policy  string
+	Balance decimal.Decimal
+	Limit   decimal.Decimal
+}
+
+func (e *InsufficientBalanceError) Error() string {
+	return e.Reason()
+}
+
+// Reason tells which limit of the book is breached, ex: book 5 btc balance would be -12, below its OVERDRAFT limit of -10.
+func (e *InsufficientBalanceError) Reason() string {
+	policy := e.Policy
+	if policy == "" {
+		policy = string(BalanceStrict)
+	}
+	return fmt.Sprintf("book %s %s balance would be %s, below its %s limit of %s", e.BookId, e.AssetId, e.Balance.String(), policy, e.Limit.String())
+}
+
+// ModifyBalance adds the entry values of the operation to the OVERALL balances of the books.
+func (bB *BookBalance) ModifyBalance(operation OperationRequest, db *gorm.DB) error {
 	log := logger.Logger.WithFields(logrus.Fields{
-		"memo": operation["memo"],
+		"memo": operation.Memo,
 		"op":   operation,
 	})
-	// commenting genericOp based validations to reduce updated rows on db
-	// genericOp := util.DeepCopyMap(operation)
-
-	overallOp := util.DeepCopyMap(operation)
-	if _, ok := overallOp["metadata"]; !ok {
+	// balances of the operation's own type (metadata["operation"]) are not kept, to reduce updated rows on db,
+	// so OVERALL is the only operation type an operation changes.
+	if operation.Metadata == nil {
 		return errors.New("metadata is not present, creation of book balance depends on metadata[\"operation\"], please send metadata with operation")
 	}
-	overallOp["metadata"].(map[string]interface{})["operation"] = OverallOperation
 
-	operations := []map[string]interface{}{
-		// genericOp,
-		overallOp,
+	// sort a copy of the entries, so that balances are always locked in the same order, and the operation is left as is.
+	entries := append([]Entry(nil), operation.Entries...)
+	sortEntries(entries)
+
+	// create the queries by looping over the entries
+	// note: Bulk upsert won't work here. for book_balance, there can be one bookId already present in book_balance
+	// but the other one is not, so both will need to change. for one, it's insert and the other one it's update.
+	queryList, params, err := GenerateUpsertCteQuery(entries, OverallOperation)
+	if err != nil {
+		return err
 	}
 
-	// sort the operation entries in place, everything is reference type, so sorting in-place works fine
-	for _, op := range operations {
-		entries := op["entries"].([]interface{})
-		metadata := op["metadata"].(map[string]interface{})
-		bB.sortEntries(entries)
+	return execBalanceQueries(queryList, params, db, log)
+}
 
-		// create the queries by looping over the entries
-		// note: Bulk upsert won't work here. for book_balance, there can be one bookId already present in book_balance
-		// but the other one is not, so both will need to change. for one, it's insert and the other one it's update.
-		queryList, params, err := GenerateUpsertCteQuery(entries, metadata)
+// AdjustBalances applies the changes, in the given order, to the balances of bookId and assetId.
+// It's meant for balance movements that are not operations (ex: holds), so no postings are involved.
+func (bB *BookBalance) AdjustBalances(bookId, assetId string, changes []BalanceChange, db *gorm.DB) error {
+	log := logger.Logger.WithFields(logrus.Fields{
+		"bookId":  bookId,
+		"assetId": assetId,
+		"changes": changes,
+	})
+
+	for _, change := range changes {
+		entries := []Entry{{BookId: bookId, AssetId: assetId, Value: change.Value}}
+		queryList, params, err := GenerateUpsertCteQuery(entries, change.OperationType)
 		if err != nil {
 			return err
 		}
 
-		log.Infof("Executing -> quries: %+v, params: %+v", queryList, params)
-
-		// execute the queries one by one, if any query errors out, roll back
-		for i, query := range queryList {
-			t := db.Debug().Exec(query, params[i]...)
-			if t.Error != nil {
-				log.WithFields(map[string]interface{}{
-					"q": map[string]interface{}{
-						"query": strings.ReplaceAll(strings.ReplaceAll(query, "\t", " "), "\n", " "),
-						"vars":  params[i],
-					},
-				}).Errorf("DB error, %+v", t.Error)
-
-				return errors.New(t.Error.Error())
-			}
+		err = execBalanceQueries(queryList, params, db, log)
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+// execBalanceQueries executes the upsert queries (GenerateUpsertCteQuery) one by one, if any query errors out,
+// the error is returned to roll back. The returned error wraps the db error, so the postgres error code can still
+// be checked by the callers. An OVERALL balance decreased below what the book's balance policy allows
+// returns an InsufficientBalanceError.
+func execBalanceQueries(queryList []string, params [][]interface{}, db *gorm.DB, log *logrus.Entry) error {
+	log.Infof("Executing -> quries: %+v, params: %+v", queryList, params)
+
+	// params of an upsert query are: balance expr, assetId, bookId, operationType, bookId, assetId, operationType, value
+	var bookIds []string
+	for _, p := range params {
+		if p[3] == OverallOperation {
+			bookIds = append(bookIds, fmt.Sprint(p[2]))
+		}
+	}
+	books := map[string]Book{}
+	if len(bookIds) > 0 {
+		var err error
+		if books, err = (&Book{}).GetBooksForPolicy(bookIds, db); err != nil {
+			return err
+		}
+	}
+
+	for i, query := range queryList {
+		var balances []BookBalance
+		t := db.Debug().Raw(query, params[i]...).Scan(&balances)
+		if t.Error != nil {
+			log.WithFields(map[string]interface{}{
+				"q": map[string]interface{}{
+					"query": strings.ReplaceAll(strings.ReplaceAll(query, "\t", " "), "\n", " "),
+					"vars":  params[i],
+				},
+			}).Errorf("DB error, %+v", t.Error)
+			return fmt.Errorf("%w", t.Error)
+		}
+
+		if params[i][3] != OverallOperation || len(balances) == 0 {
+			continue
+		}
+		value, err := decimal.NewFromString(fmt.Sprint(params[i][7]))
+		if err != nil {
+			return err
+		}
+		bookId := fmt.Sprint(params[i][2])
+		if err = CheckBalancePolicy(books[bookId], bookId, fmt.Sprint(params[i][1]), balances[0].Balance, value); err != nil {
+			log.Infof("Balance policy breached, %s", err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckBalancePolicy checks the new OVERALL balance of the book against its balance policy. Only decreases are
+// checked, so that a balance which is already below the limit (ex: the limit got lowered) can still be topped up.
+func CheckBalancePolicy(book Book, bookId, assetId string, balance, change decimal.Decimal) error {
+	if !change.IsNegative() {
+		return nil
+	}
+	limit, err := book.BalanceLimit(assetId)
+	if err != nil {
+		return err
+	}
+	if limit == nil || !balance.LessThan(*limit) {
+		return nil
+	}
+	return &InsufficientBalanceError{
+		BookId:  bookId,
+		AssetId: assetId,
+		Policy:  book.BalancePolicy,
+		Balance: balance,
+		Limit:   *limit,
+	}
+}
+
 // GenerateBulkUpsertQuery will generate a single bulkUpsert query
-func GenerateBulkUpsertQuery(entries []interface{}, metadata map[string]interface{}) (query string, params []interface{}, errs error) {
+func GenerateBulkUpsertQuery(entries []Entry, operationType string) (query string, params []interface{}, errs error) {
 	var bookIds []string
 	var assetIds []string
 	var operationTypes []string
@@ -128,32 +236,18 @@ func GenerateBulkUpsertQuery(entries []interface{}, metadata map[string]interfac
 				SELECT * FROM upsert
 			);
 			`, updateQ, bulkInsertQ)
-	var errList []string
-	for _, entry2 := range entries {
-		entry := entry2.(map[string]interface{})
-
-		if util.Includes(entry["bookId"], []interface{}{1, -1, "1", "-1"}) {
+	if operationType == "" {
+		return "", nil, errNoOperationType
+	}
+	for _, entry := range entries {
+		if !IsBalanceTracked(entry.BookId) {
 			continue
 		}
 
-		operationType := metadata["operation"]
-
-		if operationType == nil {
-			return "", nil, errors.New("operation is not present inside metadata, creation of book balance depends on metadata[\"operation\"], please send metadata with operation")
-		}
-		//valueAsF64, parseFloatErr := strconv.ParseFloat(entry["value"].(string), 64)
-		//
-		//if parseFloatErr != nil {
-		//	errList = append(errList, parseFloatErr.Error())
-		//}
-
-		bookIds = append(bookIds, entry["bookId"].(string))
-		assetIds = append(assetIds, entry["assetId"].(string))
-		values = append(values, entry["value"].(string))
-		operationTypes = append(operationTypes, operationType.(string))
-	}
-	if len(errList) > 0 {
-		return "", nil, errors.New(strings.Join(errList, ""))
+		bookIds = append(bookIds, entry.BookId)
+		assetIds = append(assetIds, entry.AssetId)
+		values = append(values, entry.Value.String())
+		operationTypes = append(operationTypes, operationType)
 	}
 	params = append(params,
 		strings.Join(assetIds, ","),
@@ -169,20 +263,16 @@ func GenerateBulkUpsertQuery(entries []interface{}, metadata map[string]interfac
 }
 
 // GenerateUpsertCteQuery will generate multiple upsert queries
-func GenerateUpsertCteQuery(entries []interface{}, metadata map[string]interface{}) (queryList []string, params [][]interface{}, err error) {
-	for _, entry2 := range entries {
-		entry := entry2.(map[string]interface{})
+func GenerateUpsertCteQuery(entries []Entry, operationType string) (queryList []string, params [][]interface{}, err error) {
+	if operationType == "" {
+		return nil, nil, errNoOperationType
+	}
+	for _, entry := range entries {
 		var paramsSlice []interface{}
-		// Uses environment variable to decide which accounts should be tracked inside the book balance table.
-		// EXCLUDED_BALANCE_BOOK_IDS if not provided, will store every bookId in the balances table.
-		if strings.Contains(os.Getenv("EXCLUDED_BALANCE_BOOK_IDS"), entry["bookId"].(string)) {
+		if !IsBalanceTracked(entry.BookId) {
 			continue
 		}
-		operationType := metadata["operation"]
-
-		if operationType == nil {
-			return nil, nil, errors.New("operation is not present inside metadata, creation of book balance depends on metadata[\"operation\"], please send metadata with operation")
-		}
+		value := entry.Value.String()
 
 		updateQ := `
 				UPDATE book_balances
@@ -195,7 +285,7 @@ func GenerateUpsertCteQuery(entries []interface{}, metadata map[string]interface
 					AND "operationType" = ?
 				RETURNING *
 			`
-		paramsSlice = append(paramsSlice, gorm.Expr("book_balances.balance + ?::numeric ", entry["value"]), entry["assetId"], entry["bookId"], operationType)
+		paramsSlice = append(paramsSlice, gorm.Expr("book_balances.balance + ?::numeric ", value), entry.AssetId, entry.BookId, operationType)
 
 		insertQ := `INSERT
 			INTO book_balances
@@ -217,19 +307,23 @@ func GenerateUpsertCteQuery(entries []interface{}, metadata map[string]interface
 
 		paramsSlice = append(
 			paramsSlice,
-			entry["bookId"],
-			entry["assetId"],
+			entry.BookId,
+			entry.AssetId,
 			operationType,
-			entry["value"])
+			value)
 
+		// returns the balance after the upsert, to check it against the book's balance policy.
 		cteQ := fmt.Sprintf(`
 			WITH upsert AS (
                         %s
-                    	)
+                    	), inserted AS (
 			%s
 			WHERE NOT EXISTS(
 				SELECT * FROM upsert
-			);
+			)
+			RETURNING balance
+			)
+			SELECT balance FROM upsert UNION ALL SELECT balance FROM inserted;
 			`, updateQ, insertQ)
 
 		queryList = append(queryList, cteQ)
@@ -238,22 +332,6 @@ func GenerateUpsertCteQuery(entries []interface{}, metadata map[string]interface
 	return queryList, params, nil
 }
 
-func (bB *BookBalance) sortEntries(entries []interface{}) {
-	sort.SliceStable(entries, func(i, j int) bool {
-		iEntry := entries[i].(map[string]interface{})
-		jEntry := entries[j].(map[string]interface{})
-		// i < j means smallest first, largest last
-		sortByBookId := iEntry["bookId"].(string) < jEntry["bookId"].(string)
-		// first sort by bookId, if bookIds are matching, then sort by assetId, to guarantee order.
-		if iEntry["bookId"] == jEntry["bookId"] {
-			sortByAssetId := iEntry["assetId"].(string) < jEntry["assetId"].(string)
-			return sortByAssetId
-		}
-		return sortByBookId
-	})
-}
-
-// GetBalance fetches the balance
 func (bB *BookBalance) GetBalance(bookId, assetId, operationType string, tx *gorm.DB) (*[]BookBalance, error) {
 	var d *gorm.DB
 	if bookId == "" {
@@ -286,3 +364,227 @@ func (bB *BookBalance) GetBalance(bookId, assetId, operationType string, tx *gor
 
 	return &balance, nil
 }
+
+// GetBalanceAsOf computes the balance of a book from its postings and holds, as it was at asOf and/or right after
+// the operation with id afterOperationId was applied. Nil asOf and 0 afterOperationId mean no bound.
+//
+// Like GetBalance, the OVERALL balance is returned if operationType is empty. OVERALL is the postings less the
+// amounts held at that time, HELD is the amounts held, and other operation types only sum the postings of
+// operations with that metadata["operation"]. So with no bound (or asOf now), it matches the live balance, except
+// for untracked books, which have no live balance. Holds aren't operations, with afterOperationId they are bound
+// by the time the operations up to it were created.
+func (bB *BookBalance) GetBalanceAsOf(bookId, assetId, operationType string, asOf *time.Time, afterOperationId uint64, tx *gorm.DB) (*[]BookBalance, error) {
+	var d *gorm.DB
+	if bookId == "" {
+		return nil, errors.New("BookId is missing")
+	}
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+	if operationType == "" {
+		operationType = OverallOperation
+	}
+
+	var posted, held []BookBalance
+	if operationType != HeldOperation {
+		query := d.Model(&Posting{}).Where(`"bookId" = ?`, bookId)
+		if assetId != "" {
+			query = query.Where(`"assetId" = ?`, assetId)
+		}
+		if operationType != OverallOperation {
+			query = query.Where(`metadata->>'operation' = ?`, operationType)
+		}
+		query = postedBy(query, asOf, afterOperationId)
+
+		t := query.
+			Select(`"bookId", "assetId", SUM(value::numeric) AS balance`).
+			Group(`"bookId", "assetId"`).
+			Scan(&posted)
+		if t.Error != nil {
+			return nil, t.Error
+		}
+	}
+
+	if operationType == OverallOperation || operationType == HeldOperation {
+		// the captured part of a hold is the negative leg of its capture operations on the hold's book.
+		captured := postedBy(d.Model(&Posting{}), asOf, afterOperationId).
+			Select(`metadata->>'holdMemo' AS memo, -SUM(value::numeric) AS amount`).
+			Where(`"bookId" = ? AND metadata->>'holdMemo' IS NOT NULL AND value::numeric < 0`, bookId).
+			Group(`metadata->>'holdMemo'`)
+
+		// released (or expired) holds aren't updated after that, so updatedAt is when they were released.
+		releasedBound, releasedArgs := holdBound(`h."updatedAt"`, asOf, afterOperationId)
+		createdBound, createdArgs := holdBound(`h."createdAt"`, asOf, afterOperationId)
+		sumArgs := append([]interface{}{[]string{string(HoldReleased), string(HoldExpired)}}, releasedArgs...)
+
+		query := d.Table("holds AS h").
+			Joins(`LEFT JOIN (?) AS c ON c.memo = h.memo`, captured).
+			Where(`h."bookId" = ?`, bookId).
+			Where(createdBound, createdArgs...)
+		if assetId != "" {
+			query = query.Where(`h."assetId" = ?`, assetId)
+		}
+
+		t := query.
+			Select(`h."bookId", h."assetId", SUM(h.amount - COALESCE(c.amount, 0) - CASE WHEN h.status IN ? AND `+releasedBound+` THEN h."releasedAmount" ELSE 0 END) AS balance`, sumArgs...).
+			Group(`h."bookId", h."assetId"`).
+			Scan(&held)
+		if t.Error != nil {
+			return nil, t.Error
+		}
+	}
+
+	return BalancesAsOf(operationType, posted, held), nil
+}
+
+// postedBy bounds a postings query to the postings created at or before asOf, of the operations up to afterOperationId.
+func postedBy(query *gorm.DB, asOf *time.Time, afterOperationId uint64) *gorm.DB {
+	if asOf != nil {
+		query = query.Where(`"createdAt" <= ?`, *asOf)
+	}
+	if afterOperationId > 0 {
+		// operationId is stored as a string on postings.
+		query = query.Where(`"operationId"::bigint <= ?`, afterOperationId)
+	}
+	return query
+}
+
+// holdBound is the condition for a timestamp column of holds to be at or before asOf, and before the operations
+// up to afterOperationId were created.
+func holdBound(column string, asOf *time.Time, afterOperationId uint64) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if asOf != nil {
+		conditions = append(conditions, column+" <= ?")
+		args = append(args, *asOf)
+	}
+	if afterOperationId > 0 {
+		conditions = append(conditions, column+` <= (SELECT MAX("createdAt") FROM operations WHERE id <= ?)`)
+		args = append(args, afterOperationId)
+	}
+	if len(conditions) == 0 {
+		return "TRUE", nil
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// BalancesAsOf puts the posted and held sums (per bookId, assetId) together into the operationType balances,
+// sorted by assetId, nil if there's none. OVERALL is posted less held.
+func BalancesAsOf(operationType string, posted, held []BookBalance) *[]BookBalance {
+	sums := map[[2]string]decimal.Decimal{}
+	for _, balance := range posted {
+		key := [2]string{balance.BookId, balance.AssetId}
+		sums[key] = sums[key].Add(balance.Balance)
+	}
+	for _, balance := range held {
+		key := [2]string{balance.BookId, balance.AssetId}
+		if operationType == HeldOperation {
+			sums[key] = sums[key].Add(balance.Balance)
+		} else {
+			sums[key] = sums[key].Sub(balance.Balance)
+		}
+	}
+	if len(sums) == 0 {
+		return nil
+	}
+
+	balances := make([]BookBalance, 0, len(sums))
+	for key, sum := range sums {
+		balances = append(balances, BookBalance{BookId: key[0], AssetId: key[1], OperationType: operationType, Balance: sum})
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].AssetId < balances[j].AssetId })
+	return &balances
+}
+
+// GetRollupBalance returns the balance of bookId aggregated across the book and all its descendants
+// (books whose parent chain leads to it), per asset, reported under bookId. Like GetBalance, OVERALL is returned
+// if operationType is empty. Descendants whose balances are not tracked don't contribute.
+func (bB *BookBalance) GetRollupBalance(bookId, assetId, operationType string, tx *gorm.DB) (*[]BookBalance, error) {
+	var d *gorm.DB
+	if bookId == "" {
+		return nil, errors.New("BookId is missing")
+	}
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+	if operationType == "" {
+		operationType = OverallOperation
+	}
+
+	// UNION (not UNION ALL) stops at cycles, if the parent chain ever has one.
+	tree := d.Raw(`WITH RECURSIVE tree(id) AS (
+			SELECT ?::text
+			UNION
+			SELECT b.id::text FROM books b JOIN tree t ON b."parentId" = t.id
+		)
+		SELECT id FROM tree`, bookId)
+
+	query := d.Model(&BookBalance{}).Where(`"bookId" IN (?) AND "operationType" = ?`, tree, operationType)
+	if assetId != "" {
+		query = query.Where(`"assetId" = ?`, assetId)
+	}
+
+	var balance []BookBalance
+	t := query.
+		Select(`? AS "bookId", "assetId", "operationType", SUM(balance) AS balance`, bookId).
+		Group(`"assetId", "operationType"`).
+		Order(`"assetId"`).
+		Scan(&balance)
+
+	if t.Error != nil {
+		return nil, t.Error
+	}
+	if t.RowsAffected < 1 {
+		return nil, nil
+	}
+
+	return &balance, nil
+}
+
+// GetAllBalances returns every balance row, of every book.
+func (bB *BookBalance) GetAllBalances(tx *gorm.DB) ([]BookBalance, error) {
+	var d *gorm.DB
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+
+	var balances []BookBalance
+	res := d.Model(&BookBalance{}).Select("bookId", "assetId", "operationType", "balance").Find(&balances)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return balances, nil
+}
+
+// SetBalance overwrites a balance with the given value, the row is created if it doesn't exist.
+// It's meant for repairs (ex: reconciliation), regular balance changes go through ModifyBalance/AdjustBalances.
+func (bB *BookBalance) SetBalance(balance BookBalance, tx *gorm.DB) error {
+	var d *gorm.DB
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+
+	res := d.Model(&BookBalance{}).
+		Where(`"bookId" = ? AND "assetId" = ? AND "operationType" = ?`, balance.BookId, balance.AssetId, balance.OperationType).
+		Updates(map[string]interface{}{"balance": balance.Balance, "updatedAt": time.Now()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+	return d.Create(&BookBalance{
+		BookId:        balance.BookId,
+		AssetId:       balance.AssetId,
+		OperationType: balance.OperationType,
+		Balance:       balance.Balance,
+	}).Error
+}
@@ -1,27 +1,22 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 func TestMain(t *testing.T) {
 	// GenerateUpsertCteQuery will generate multiple upsert queries
 
-	queries, params, err := GenerateUpsertCteQuery([]interface{}{
-		map[string]interface{}{
-			"assetId": "btc",
-			"bookId":  "3",
-			"value":   "-1",
-		},
-		map[string]interface{}{
-			"assetId": "btc",
-			"bookId":  "4",
-			"value":   "1",
-		},
-	}, map[string]interface{}{
-		"operation": "BLOCK",
-	})
+	queries, params, err := GenerateUpsertCteQuery([]Entry{
+		{AssetId: "btc", BookId: "3", Value: decimal.RequireFromString("-1")},
+		{AssetId: "btc", BookId: "4", Value: decimal.RequireFromString("1")},
+	}, "BLOCK")
 
 	if len(queries) != 2 {
 		t.Fatalf("Queries should have 2 elements")
@@ -37,3 +32,87 @@ func TestMain(t *testing.T) {
 
 	t.Log(strings.Join(queries, "\n"), params, err)
 }
+
+func TestBalanceJSON(t *testing.T) {
+	// numeric(32,8) comes back from postgres with all the 8 decimal places.
+	balance, err := decimal.NewFromString("0.30000001")
+	if err != nil {
+		t.Fatalf("Err should be nil")
+	}
+	balance = balance.Add(decimal.RequireFromString("0.00000002"))
+
+	bytes, err := json.Marshal(BookBalance{BookId: "4", AssetId: "btc", OperationType: OverallOperation, Balance: balance})
+	if err != nil {
+		t.Fatalf("Err should be nil")
+	}
+
+	m := map[string]interface{}{}
+	_ = json.Unmarshal(bytes, &m)
+	if m["balance"] != "0.30000003" {
+		t.Fatalf("Balance should be rendered as exact decimal string, got: %+v", m["balance"])
+	}
+}
+
+func TestGetBalanceAsOf(t *testing.T) {
+	r := useRecorder(t)
+	r.respond = func(query string) ([]string, [][]driver.Value) {
+		columns := []string{"bookId", "assetId", "balance"}
+		if strings.Contains(query, "FROM holds AS h") {
+			return columns, [][]driver.Value{{"4", "btc", "0.5"}}
+		}
+		return columns, [][]driver.Value{{"4", "btc", "2"}, {"4", "eth", "1"}}
+	}
+	asOf := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	balances, err := (&BookBalance{}).GetBalanceAsOf("4", "", "", &asOf, 42, nil)
+	if err != nil {
+		t.Fatalf("Err should be nil, got: %v", err)
+	}
+	// held amounts are taken out of OVERALL.
+	if len(*balances) != 2 || (*balances)[0].Balance.String() != "1.5" || (*balances)[1].Balance.String() != "1" {
+		t.Fatalf("OVERALL should be postings less holds, got: %+v", *balances)
+	}
+
+	postings := r.find(`FROM "postings"`, `"createdAt" <= $2`, `"operationId"::bigint <= $3`)
+	if len(postings) != 1 || postings[0].Args[2] != int64(42) {
+		t.Fatalf("Postings should be bound by asOf and afterOperationId, got: %+v", r.queries)
+	}
+	holds := r.find("FROM holds AS h", `LEFT JOIN (SELECT metadata->>'holdMemo'`, `h."createdAt" <= (SELECT MAX("createdAt") FROM operations WHERE id <=`)
+	if len(holds) != 1 || !strings.Contains(holds[0].SQL, `h.status IN ($1,$2)`) {
+		t.Fatalf("Holds should be bound by asOf and afterOperationId, got: %+v", r.queries)
+	}
+
+	r.queries = nil
+	balances, err = (&BookBalance{}).GetBalanceAsOf("4", "btc", HeldOperation, nil, 0, nil)
+	if err != nil {
+		t.Fatalf("Err should be nil, got: %v", err)
+	}
+	if len(*balances) != 1 || (*balances)[0].Balance.String() != "0.5" || (*balances)[0].OperationType != HeldOperation {
+		t.Fatalf("HELD should be the held amount, got: %+v", *balances)
+	}
+	if len(r.find(`FROM "postings"`, `"operationId"::bigint`)) != 0 || len(r.find("FROM holds AS h")) != 1 {
+		t.Fatalf("HELD should only query holds, without bounds, got: %+v", r.queries)
+	}
+}
+
+func TestBalancesAsOf(t *testing.T) {
+	posted := []BookBalance{{BookId: "4", AssetId: "inr", Balance: decimal.RequireFromString("10")}}
+	held := []BookBalance{
+		{BookId: "4", AssetId: "inr", Balance: decimal.RequireFromString("4")},
+		{BookId: "4", AssetId: "btc", Balance: decimal.RequireFromString("1")},
+	}
+
+	overall := *BalancesAsOf(OverallOperation, posted, held)
+	if len(overall) != 2 || overall[0].AssetId != "btc" || overall[0].Balance.String() != "-1" || overall[1].Balance.String() != "6" {
+		t.Fatalf("OVERALL should be posted less held, sorted by assetId, got: %+v", overall)
+	}
+
+	deposits := *BalancesAsOf("DEPOSIT", posted, nil)
+	if len(deposits) != 1 || deposits[0].OperationType != "DEPOSIT" || deposits[0].Balance.String() != "10" {
+		t.Fatalf("Operation types other than OVERALL should be the postings, got: %+v", deposits)
+	}
+
+	if BalancesAsOf(OverallOperation, nil, nil) != nil {
+		t.Fatalf("Balances should be nil without postings or holds")
+	}
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	asrt "github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+)
+
+func TestCheckBalancePolicy(t *testing.T) {
+	assert := asrt.New(t)
+	d := decimal.RequireFromString
+
+	strict := Book{BalancePolicy: string(BalanceStrict)}
+	assert.NoError(CheckBalancePolicy(strict, "4", "btc", d("0"), d("-1")))
+	err := CheckBalancePolicy(strict, "4", "btc", d("-0.1"), d("-1"))
+	var insufficient *InsufficientBalanceError
+	if assert.ErrorAs(err, &insufficient) {
+		assert.Equal("book 4 btc balance would be -0.1, below its STRICT limit of 0", insufficient.Reason())
+	}
+	// books created before the policies are strict.
+	assert.Error(CheckBalancePolicy(Book{}, "4", "btc", d("-0.1"), d("-1")))
+	// credits are never rejected, even if the balance is still below the limit.
+	assert.NoError(CheckBalancePolicy(strict, "4", "btc", d("-5"), d("1")))
+
+	assert.NoError(CheckBalancePolicy(Book{BalancePolicy: string(BalanceAllowNegative)}, "1", "btc", d("-1000000"), d("-1")))
+
+	overdraft := Book{BalancePolicy: string(BalanceOverdraft), OverdraftLimits: datatypes.JSON(`{"btc": "10"}`)}
+	assert.NoError(CheckBalancePolicy(overdraft, "5", "btc", d("-10"), d("-1")))
+	err = CheckBalancePolicy(overdraft, "5", "btc", d("-12"), d("-3"))
+	if assert.ErrorAs(err, &insufficient) {
+		assert.Equal("book 5 btc balance would be -12, below its OVERDRAFT limit of -10", insufficient.Reason())
+	}
+	// assets without a limit can't go negative.
+	assert.Error(CheckBalancePolicy(overdraft, "5", "inr", d("-1"), d("-1")))
+}
+
+func TestLockBooks(t *testing.T) {
+	if err := (&Book{}).LockBooks([]string{"4"}, nil); err == nil {
+		t.Fatalf("LockBooks should need a transaction")
+	}
+
+	r := useRecorder(t)
+	tx := db.Begin()
+	defer tx.Rollback()
+	if err := (&Book{}).LockBooks([]string{"4", "12", "4"}, tx); err != nil {
+		t.Fatalf("Err should be nil, got: %v", err)
+	}
+	locks := r.find(`FROM "books" WHERE id IN ($1,$2)`, "ORDER BY id FOR UPDATE")
+	if len(locks) != 1 {
+		t.Fatalf("Books should be locked once each, in id order, got: %+v", r.queries)
+	}
+}
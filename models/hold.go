@@ -0,0 +1,160 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type HoldStatus string
+
+const (
+	HoldHeld              HoldStatus = "HELD"
+	HoldPartiallyCaptured HoldStatus = "PARTIALLY_CAPTURED"
+	HoldCaptured          HoldStatus = "CAPTURED"
+	HoldReleased          HoldStatus = "RELEASED"
+	HoldExpired           HoldStatus = "EXPIRED"
+)
+
+// Hold reserves an amount of an asset on a book, until it's captured into an operation or released.
+//
+// While the hold is active, the remaining amount (amount - capturedAmount - releasedAmount) is kept
+// in the HELD operationType balance of the book and is taken out of the OVERALL balance,
+// so it can't be spent by any other operation. Holds don't create postings, only the capture does.
+type Hold struct {
+	Model
+	Memo           string          `gorm:"index;unique" json:"memo"`
+	BookId         string          `gorm:"index;column:bookId" json:"bookId"`
+	AssetId        string          `gorm:"index;column:assetId" json:"assetId"`
+	Amount         decimal.Decimal `gorm:"type:numeric(32,8)" json:"amount"`
+	CapturedAmount decimal.Decimal `gorm:"type:numeric(32,8);column:capturedAmount" json:"capturedAmount"`
+	ReleasedAmount decimal.Decimal `gorm:"type:numeric(32,8);column:releasedAmount" json:"releasedAmount"`
+	Status         string          `gorm:"index" json:"status"`
+	ExpiresAt      *time.Time      `gorm:"index;column:expiresAt" json:"expiresAt"`
+	Metadata       datatypes.JSON  `json:"metadata"`
+}
+
+// Remaining is the amount that's still held.
+func (h *Hold) Remaining() decimal.Decimal {
+	return h.Amount.Sub(h.CapturedAmount).Sub(h.ReleasedAmount)
+}
+
+// IsActive tells if the hold can still be captured or released.
+func (h *Hold) IsActive() bool {
+	return h.Status == string(HoldHeld) || h.Status == string(HoldPartiallyCaptured)
+}
+
+// IsExpired tells if the hold has an expiry, and it's already past it.
+func (h *Hold) IsExpired(now time.Time) bool {
+	return h.ExpiresAt != nil && !h.ExpiresAt.After(now)
+}
+
+func (h *Hold) CreateHold(hold *Hold, tx *gorm.DB) error {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+	return d.Create(hold).Error
+}
+
+func (h *Hold) GetHold(memo string, tx *gorm.DB) (*Hold, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+	hold := Hold{}
+	res := d.Model(&h).Where("memo = ?", memo).Last(&hold)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return &hold, nil
+}
+
+// GetHoldForUpdate works like GetHold, but row locks the hold until tx commits or rolls back.
+func (h *Hold) GetHoldForUpdate(memo string, tx *gorm.DB) (*Hold, error) {
+	if tx == nil {
+		return nil, errors.New("GetHoldForUpdate requires a transaction")
+	}
+	hold := Hold{}
+	res := tx.Model(&h).Clauses(clause.Locking{Strength: "UPDATE"}).Where("memo = ?", memo).Last(&hold)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return &hold, nil
+}
+
+// UpdateHold persists the amounts and the status of the hold.
+func (h *Hold) UpdateHold(hold *Hold, tx *gorm.DB) error {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+	return d.Model(hold).
+		Select("capturedAmount", "releasedAmount", "status", "updatedAt").
+		Updates(hold).Error
+}
+
+// GetExpiredHoldMemos returns memos of the active holds which are past their expiry, oldest expiry first.
+func (h *Hold) GetExpiredHoldMemos(now time.Time, limit int, tx *gorm.DB) ([]string, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+	var memos []string
+	res := d.Model(&h).
+		Where("status IN ?", []string{string(HoldHeld), string(HoldPartiallyCaptured)}).
+		Where(`"expiresAt" <= ?`, now).
+		Order(`"expiresAt"`).
+		Limit(limit).
+		Pluck("memo", &memos)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return memos, nil
+}
+
+// SumHeld returns the remaining amount of the active holds, per bookId and assetId, as HELD balances.
+func (h *Hold) SumHeld(tx *gorm.DB) ([]BookBalance, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+
+	var sums []BookBalance
+	res := d.Model(&Hold{}).
+		Select(`"bookId", "assetId", ? AS "operationType", SUM(amount - "capturedAmount" - "releasedAmount") AS balance`, HeldOperation).
+		Where("status IN ?", []string{string(HoldHeld), string(HoldPartiallyCaptured)}).
+		Group(`"bookId", "assetId"`).
+		Scan(&sums)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return sums, nil
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestHoldRemaining(t *testing.T) {
+	expiresAt := time.Date(2023, 10, 17, 8, 0, 0, 0, time.UTC)
+	hold := Hold{
+		Amount:         decimal.RequireFromString("1.5"),
+		CapturedAmount: decimal.RequireFromString("0.2"),
+		Status:         string(HoldPartiallyCaptured),
+		ExpiresAt:      &expiresAt,
+	}
+
+	if !hold.Remaining().Equal(decimal.RequireFromString("1.3")) {
+		t.Errorf("expected remaining 1.3, got %s", hold.Remaining().String())
+	}
+	if !hold.IsActive() {
+		t.Errorf("expected %s hold to be active", hold.Status)
+	}
+	if hold.IsExpired(expiresAt.Add(-time.Second)) {
+		t.Errorf("expected hold to not be expired before expiresAt")
+	}
+	if !hold.IsExpired(expiresAt) {
+		t.Errorf("expected hold to be expired at expiresAt")
+	}
+
+	hold.ReleasedAmount = hold.Remaining()
+	hold.Status = string(HoldReleased)
+	if !hold.Remaining().IsZero() || hold.IsActive() {
+		t.Errorf("expected released hold to have nothing remaining and be inactive")
+	}
+}
@@ -0,0 +1,927 @@
+// Package memory is an in-memory implementation of the repositories of models, for fast tests of the services.
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/thoas/go-funk"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"general_ledger_golang/models"
+)
+
+var ErrDuplicateMemo = errors.New("duplicate key value violates unique constraint on memo")
+
+// Store keeps books, balances, operations, postings, assets, holds and outbox events in memory, with the same
+// semantics as the Postgres repositories: memos are unique (CreateOperation returns the existing operation only if
+// it's the same), balance policies are enforced by ModifyBalance and AdjustBalances, postings are hash chained, and
+// balances of untracked books are not kept.
+//
+// Transaction snapshots the store, and restores it if fn fails, savepoints included. Transactions are not isolated
+// from each other, a Store is meant to be used by one test at a time. The zero value is not usable, use New.
+type Store struct {
+	mu     sync.Mutex
+	data   data
+	lastId map[string]uint64
+}
+
+type balanceKey struct {
+	bookId, assetId, operationType string
+}
+
+type data struct {
+	books      []models.Book
+	balances   map[balanceKey]models.BookBalance
+	operations []models.Operation
+	postings   []models.Posting
+	assets     map[string]models.Asset
+	holds      []models.Hold
+	events     []models.OutboxEvent
+}
+
+func New() *Store {
+	return &Store{
+		data:   data{balances: map[balanceKey]models.BookBalance{}, assets: map[string]models.Asset{}},
+		lastId: map[string]uint64{},
+	}
+}
+
+var (
+	_ models.BookRepository      = &Store{}
+	_ models.BalanceRepository   = &Store{}
+	_ models.OperationRepository = &Store{}
+	_ models.PostingRepository   = &Store{}
+	_ models.AssetRepository     = &Store{}
+	_ models.HoldRepository      = &Store{}
+	_ models.OutboxRepository    = &Store{}
+	_ models.Transactor          = &Store{}
+)
+
+// nextId returns the next id of the table, like a sequence, ids are not reused after a rollback.
+func (s *Store) nextId(table string) uint64 {
+	s.lastId[table]++
+	return s.lastId[table]
+}
+
+func (d data) copy() data {
+	c := data{
+		books:      append([]models.Book(nil), d.books...),
+		balances:   make(map[balanceKey]models.BookBalance, len(d.balances)),
+		operations: append([]models.Operation(nil), d.operations...),
+		postings:   append([]models.Posting(nil), d.postings...),
+		assets:     make(map[string]models.Asset, len(d.assets)),
+		holds:      append([]models.Hold(nil), d.holds...),
+		events:     append([]models.OutboxEvent(nil), d.events...),
+	}
+	for k, v := range d.balances {
+		c.balances[k] = v
+	}
+	for k, v := range d.assets {
+		c.assets[k] = v
+	}
+	return c
+}
+
+// Transaction runs fn, and restores the store to how it was before, if fn returns an error or panics.
+// fn gets a nil tx, the repositories of the store don't need one.
+func (s *Store) Transaction(_ *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	s.mu.Lock()
+	snapshot := s.data.copy()
+	s.mu.Unlock()
+
+	restore := func() {
+		s.mu.Lock()
+		s.data = snapshot
+		s.mu.Unlock()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			restore()
+			panic(r)
+		}
+	}()
+
+	if err = fn(nil); err != nil {
+		restore()
+	}
+	return err
+}
+
+// Books
+
+func (s *Store) CreateOrUpdateBook(book *models.Book) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for i := range s.data.books {
+		existing := &s.data.books[i]
+		if existing.Name != book.Name {
+			continue
+		}
+		// like gorm's Updates with a struct, only the non-zero fields are updated.
+		if len(book.Metadata) > 0 {
+			existing.Metadata = book.Metadata
+		}
+		if book.AccountType != "" {
+			existing.AccountType = book.AccountType
+		}
+		if book.ParentId != "" {
+			existing.ParentId = book.ParentId
+		}
+		if book.NormalSide != "" {
+			existing.NormalSide = book.NormalSide
+		}
+		if book.BalancePolicy != "" {
+			existing.BalancePolicy = book.BalancePolicy
+		}
+		if len(book.OverdraftLimits) > 0 {
+			existing.OverdraftLimits = book.OverdraftLimits
+		}
+		existing.UpdatedAt = now
+		return "update", nil
+	}
+
+	book.Id = s.nextId("books")
+	book.CreatedAt, book.UpdatedAt = now, now
+	if book.BalancePolicy == "" {
+		book.BalancePolicy = string(models.BalanceStrict)
+	}
+	s.data.books = append(s.data.books, *book)
+	return "create", nil
+}
+
+// book returns the book with the id, nil if there's none. Caller should hold the lock.
+func (s *Store) book(bookId string) *models.Book {
+	id, err := strconv.ParseUint(bookId, 10, 64)
+	if err != nil {
+		return nil
+	}
+	for i := range s.data.books {
+		if s.data.books[i].Id == id {
+			book := s.data.books[i]
+			return &book
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetBook(bookId string) (*models.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.book(bookId), nil
+}
+
+func (s *Store) GetBooks(bookIds []string, _ *gorm.DB) (*[]models.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var books []models.Book
+	for _, bookId := range funk.UniqString(bookIds) {
+		if book := s.book(bookId); book != nil {
+			books = append(books, *book)
+		}
+	}
+	if len(books) == 0 {
+		return nil, nil
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].Id < books[j].Id })
+	return &books, nil
+}
+
+func (s *Store) GetBookByName(name string, _ *gorm.DB) (*models.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, book := range s.data.books {
+		if book.Name == name {
+			return &book, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Store) GetAncestorIds(bookId string, _ *gorm.DB) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ancestorIds []string
+	seen := map[string]bool{bookId: true}
+	for book := s.book(bookId); book != nil && book.ParentId != "" && !seen[book.ParentId]; book = s.book(book.ParentId) {
+		seen[book.ParentId] = true
+		ancestorIds = append(ancestorIds, book.ParentId)
+	}
+	return ancestorIds, nil
+}
+
+// LockBooks does nothing, transactions of the store are not isolated from each other anyway.
+func (s *Store) LockBooks(_ []string, _ *gorm.DB) error {
+	return nil
+}
+
+// Balances
+
+// ModifyBalance adds the entry values to the OVERALL balances, in bookId, assetId order, and checks the balance
+// policy of every book whose balance decreases, like BookBalance.ModifyBalance.
+func (s *Store) ModifyBalance(operation models.OperationRequest, _ *gorm.DB) error {
+	if operation.Metadata == nil {
+		return errors.New("metadata is not present, creation of book balance depends on metadata[\"operation\"], please send metadata with operation")
+	}
+	entries := append([]models.Entry(nil), operation.Entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].BookId == entries[j].BookId {
+			return entries[i].AssetId < entries[j].AssetId
+		}
+		return entries[i].BookId < entries[j].BookId
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range entries {
+		if !models.IsBalanceTracked(entry.BookId) {
+			continue
+		}
+		balance := s.addBalance(entry.BookId, entry.AssetId, models.OverallOperation, entry.Value)
+
+		book := models.Book{}
+		if b := s.book(entry.BookId); b != nil {
+			book = *b
+		}
+		if err := models.CheckBalancePolicy(book, entry.BookId, entry.AssetId, balance, entry.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AdjustBalances applies the changes, in the given order, to the balances of bookId and assetId, and checks the
+// balance policy of the book if its OVERALL balance decreases, like BookBalance.AdjustBalances.
+func (s *Store) AdjustBalances(bookId, assetId string, changes []models.BalanceChange, _ *gorm.DB) error {
+	if !models.IsBalanceTracked(bookId) {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, change := range changes {
+		balance := s.addBalance(bookId, assetId, change.OperationType, change.Value)
+		if change.OperationType != models.OverallOperation {
+			continue
+		}
+		book := models.Book{}
+		if b := s.book(bookId); b != nil {
+			book = *b
+		}
+		if err := models.CheckBalancePolicy(book, bookId, assetId, balance, change.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addBalance adds value to the balance, creating it if there's none, and returns the new balance.
+// Caller should hold the lock.
+func (s *Store) addBalance(bookId, assetId, operationType string, value decimal.Decimal) decimal.Decimal {
+	key := balanceKey{bookId, assetId, operationType}
+	balance, ok := s.data.balances[key]
+	now := time.Now()
+	if !ok {
+		balance = models.BookBalance{BookId: bookId, AssetId: assetId, OperationType: operationType}
+		balance.Id = s.nextId("book_balances")
+		balance.CreatedAt = now
+	}
+	balance.Balance = balance.Balance.Add(value)
+	balance.UpdatedAt = now
+	s.data.balances[key] = balance
+	return balance.Balance
+}
+
+func (s *Store) GetBalance(bookId, assetId, operationType string, _ *gorm.DB) (*[]models.BookBalance, error) {
+	if bookId == "" {
+		return nil, errors.New("BookId is missing")
+	}
+	if operationType == "" {
+		operationType = models.OverallOperation
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var balances []models.BookBalance
+	for key, balance := range s.data.balances {
+		if key.bookId == bookId && key.operationType == operationType && (assetId == "" || key.assetId == assetId) {
+			balances = append(balances, balance)
+		}
+	}
+	return sortedBalances(balances), nil
+}
+
+func (s *Store) GetRollupBalance(bookId, assetId, operationType string, _ *gorm.DB) (*[]models.BookBalance, error) {
+	if bookId == "" {
+		return nil, errors.New("BookId is missing")
+	}
+	if operationType == "" {
+		operationType = models.OverallOperation
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the book and its descendants, a cycle in the parent chain is visited once.
+	tree := map[string]bool{bookId: true}
+	for grown := true; grown; {
+		grown = false
+		for _, book := range s.data.books {
+			id := strconv.FormatUint(book.Id, 10)
+			if tree[book.ParentId] && !tree[id] {
+				tree[id] = true
+				grown = true
+			}
+		}
+	}
+
+	sums := map[string]decimal.Decimal{}
+	for key, balance := range s.data.balances {
+		if tree[key.bookId] && key.operationType == operationType && (assetId == "" || key.assetId == assetId) {
+			sums[key.assetId] = sums[key.assetId].Add(balance.Balance)
+		}
+	}
+	var balances []models.BookBalance
+	for asset, sum := range sums {
+		balances = append(balances, models.BookBalance{BookId: bookId, AssetId: asset, OperationType: operationType, Balance: sum})
+	}
+	return sortedBalances(balances), nil
+}
+
+// GetBalanceAsOf sums the postings (and the holds) of the book up to asOf and afterOperationId, like
+// BookBalance.GetBalanceAsOf: OVERALL is the postings less the amounts held at that time, HELD is those amounts.
+func (s *Store) GetBalanceAsOf(bookId, assetId, operationType string, asOf *time.Time, afterOperationId uint64, _ *gorm.DB) (*[]models.BookBalance, error) {
+	if bookId == "" {
+		return nil, errors.New("BookId is missing")
+	}
+	if operationType == "" {
+		operationType = models.OverallOperation
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var posted, held []models.BookBalance
+	if operationType != models.HeldOperation {
+		for _, posting := range s.data.postings {
+			if posting.BookId != bookId || (assetId != "" && posting.AssetId != assetId) || !postedBy(posting, asOf, afterOperationId) {
+				continue
+			}
+			if operationType != models.OverallOperation && metadataValue(posting.Metadata, "operation") != operationType {
+				continue
+			}
+			value, err := decimal.NewFromString(posting.Value)
+			if err != nil {
+				return nil, err
+			}
+			posted = append(posted, models.BookBalance{BookId: bookId, AssetId: posting.AssetId, Balance: value})
+		}
+	}
+
+	if operationType == models.OverallOperation || operationType == models.HeldOperation {
+		// the captured part of a hold is the negative leg of its capture operations on the hold's book.
+		captured := map[string]decimal.Decimal{}
+		for _, posting := range s.data.postings {
+			holdMemo := metadataValue(posting.Metadata, "holdMemo")
+			if posting.BookId != bookId || holdMemo == "" || !postedBy(posting, asOf, afterOperationId) {
+				continue
+			}
+			value, err := decimal.NewFromString(posting.Value)
+			if err != nil {
+				return nil, err
+			}
+			if value.IsNegative() {
+				captured[holdMemo] = captured[holdMemo].Sub(value)
+			}
+		}
+
+		for _, hold := range s.data.holds {
+			if hold.BookId != bookId || (assetId != "" && hold.AssetId != assetId) || !s.holdBy(hold.CreatedAt, asOf, afterOperationId) {
+				continue
+			}
+			amount := hold.Amount.Sub(captured[hold.Memo])
+			// released (or expired) holds aren't updated after that, so updatedAt is when they were released.
+			released := hold.Status == string(models.HoldReleased) || hold.Status == string(models.HoldExpired)
+			if released && s.holdBy(hold.UpdatedAt, asOf, afterOperationId) {
+				amount = amount.Sub(hold.ReleasedAmount)
+			}
+			held = append(held, models.BookBalance{BookId: bookId, AssetId: hold.AssetId, Balance: amount})
+		}
+	}
+
+	return models.BalancesAsOf(operationType, posted, held), nil
+}
+
+// postedBy tells if the posting was created at or before asOf, by an operation up to afterOperationId.
+func postedBy(posting models.Posting, asOf *time.Time, afterOperationId uint64) bool {
+	if asOf != nil && posting.CreatedAt.After(*asOf) {
+		return false
+	}
+	operationId, _ := strconv.ParseUint(posting.OperationId, 10, 64)
+	return afterOperationId == 0 || operationId <= afterOperationId
+}
+
+// holdBy tells if a timestamp of a hold is at or before asOf, and before the operations up to afterOperationId
+// were created. Caller should hold the lock.
+func (s *Store) holdBy(at time.Time, asOf *time.Time, afterOperationId uint64) bool {
+	if asOf != nil && at.After(*asOf) {
+		return false
+	}
+	if afterOperationId == 0 {
+		return true
+	}
+	var last *time.Time
+	for i := range s.data.operations {
+		operation := &s.data.operations[i]
+		if operation.Id <= afterOperationId && (last == nil || operation.CreatedAt.After(*last)) {
+			last = &operation.CreatedAt
+		}
+	}
+	return last != nil && !at.After(*last)
+}
+
+// sortedBalances sorts the balances by assetId, nil if there's none, like the Postgres queries.
+func sortedBalances(balances []models.BookBalance) *[]models.BookBalance {
+	if len(balances) == 0 {
+		return nil
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].AssetId < balances[j].AssetId })
+	return &balances
+}
+
+// Operations
+
+func (s *Store) GetOperation(memo string, _ *gorm.DB) (*models.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.data.operations) - 1; i >= 0; i-- {
+		if s.data.operations[i].Memo == memo {
+			operation := s.data.operations[i]
+			return &operation, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetOperationForUpdate is GetOperation, as the store's transactions are not concurrent, there's nothing to lock.
+func (s *Store) GetOperationForUpdate(memo string, tx *gorm.DB) (*models.Operation, error) {
+	return s.GetOperation(memo, tx)
+}
+
+func (s *Store) GetOperations(filter models.OperationFilter, _ *gorm.DB) ([]models.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var operations []models.Operation
+	for i := len(s.data.operations) - 1; i >= 0; i-- {
+		operation := s.data.operations[i]
+		if filter.Type != "" && operation.Type != filter.Type {
+			continue
+		}
+		if filter.Status != "" && operation.Status != filter.Status {
+			continue
+		}
+		if filter.BookId != "" && !hasEntryOn(operation, filter.BookId) {
+			continue
+		}
+		if filter.MetadataKey != "" && metadataValue(operation.Metadata, filter.MetadataKey) != filter.MetadataValue {
+			continue
+		}
+		if filter.From != nil && operation.CreatedAt.Before(*filter.From) {
+			continue
+		}
+		if filter.To != nil && !operation.CreatedAt.Before(*filter.To) {
+			continue
+		}
+		if filter.BeforeId > 0 && operation.Id >= filter.BeforeId {
+			continue
+		}
+		operations = append(operations, operation)
+		if filter.Limit > 0 && len(operations) == filter.Limit {
+			break
+		}
+	}
+	return operations, nil
+}
+
+// CreateOperation creates the operation, or returns the existing one with the same memo, if all the fields are
+// the same. A different operation with the same memo is an ErrDuplicateMemo, as memos are unique.
+func (s *Store) CreateOperation(operation models.Operation, _ *gorm.DB) (*models.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.data.operations {
+		if existing.Memo != operation.Memo {
+			continue
+		}
+		if existing.Type == operation.Type && string(existing.Entries) == string(operation.Entries) &&
+			existing.Status == operation.Status && existing.Fingerprint == operation.Fingerprint {
+			return &existing, nil
+		}
+		return nil, fmt.Errorf("%w, memo: %s", ErrDuplicateMemo, operation.Memo)
+	}
+
+	now := time.Now()
+	operation.Id = s.nextId("operations")
+	operation.CreatedAt, operation.UpdatedAt = now, now
+	s.data.operations = append(s.data.operations, operation)
+	return &operation, nil
+}
+
+func (s *Store) UpdateOperation(operation *models.Operation, _ *gorm.DB) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.operations {
+		if s.data.operations[i].Memo == operation.Memo {
+			s.data.operations[i].Status = operation.Status
+			s.data.operations[i].RejectionReason = operation.RejectionReason
+			s.data.operations[i].Metadata = operation.Metadata
+			s.data.operations[i].UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func hasEntryOn(operation models.Operation, bookId string) bool {
+	var entries []models.Entry
+	if err := json.Unmarshal(operation.Entries, &entries); err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.BookId == bookId {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataValue is metadata->>key, the value as text, empty if it's missing.
+func metadataValue(metadata datatypes.JSON, key string) string {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(metadata, &m); err != nil {
+		return ""
+	}
+	switch value := m[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		bytes, _ := json.Marshal(value)
+		return string(bytes)
+	}
+}
+
+// Postings
+
+// BulkCreatePosting creates a posting for every entry, continuing the hash chain of each book.
+func (s *Store) BulkCreatePosting(entries []models.Entry, _ *gorm.DB, operationId uint64, metadata datatypes.JSON) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lastHash := map[string]string{}
+	for _, posting := range s.data.postings {
+		lastHash[posting.BookId] = posting.Hash
+	}
+
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	for _, entry := range entries {
+		posting := models.Posting{
+			Model:       models.Model{Id: s.nextId("postings"), CreatedAt: createdAt, UpdatedAt: createdAt},
+			OperationId: strconv.FormatUint(operationId, 10),
+			BookId:      entry.BookId,
+			Value:       entry.Value.String(),
+			Metadata:    metadata,
+			AssetId:     entry.AssetId,
+			PrevHash:    lastHash[entry.BookId],
+		}
+		posting.Hash = models.PostingHash(posting)
+		lastHash[entry.BookId] = posting.Hash
+		s.data.postings = append(s.data.postings, posting)
+	}
+	return nil
+}
+
+// Postings returns the postings of the book (all books, if bookId is empty), in id order.
+func (s *Store) Postings(bookId string) []models.Posting {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var postings []models.Posting
+	for _, posting := range s.data.postings {
+		if bookId == "" || posting.BookId == bookId {
+			postings = append(postings, posting)
+		}
+	}
+	return postings
+}
+
+// Assets
+
+// SetAsset registers the asset, replacing the one with the same code.
+func (s *Store) SetAsset(asset models.Asset) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.data.assets[asset.Code]; ok {
+		asset.Id = existing.Id
+	} else {
+		asset.Id = s.nextId("assets")
+	}
+	s.data.assets[asset.Code] = asset
+}
+
+// CreateOrUpdateAsset updates the asset with the same code (every column, like Asset.CreateOrUpdateAsset),
+// or creates it.
+func (s *Store) CreateOrUpdateAsset(asset *models.Asset) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := s.data.assets[asset.Code]; ok {
+		existing.Name = asset.Name
+		existing.Scale = asset.Scale
+		existing.MinTransferAmount = asset.MinTransferAmount
+		existing.MaxTransferAmount = asset.MaxTransferAmount
+		existing.UpdatedAt = now
+		s.data.assets[asset.Code] = existing
+		return "update", nil
+	}
+	asset.Id = s.nextId("assets")
+	asset.CreatedAt, asset.UpdatedAt = now, now
+	s.data.assets[asset.Code] = *asset
+	return "create", nil
+}
+
+func (s *Store) GetAsset(code string, _ *gorm.DB) (*models.Asset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	asset, ok := s.data.assets[code]
+	if !ok {
+		return nil, nil
+	}
+	return &asset, nil
+}
+
+func (s *Store) GetAssets(codes []string, _ *gorm.DB) (*[]models.Asset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var assets []models.Asset
+	for code, asset := range s.data.assets {
+		if len(codes) == 0 || funk.ContainsString(codes, code) {
+			assets = append(assets, asset)
+		}
+	}
+	if len(assets) == 0 {
+		return nil, nil
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Code < assets[j].Code })
+	return &assets, nil
+}
+
+func (s *Store) DeleteAsset(code string, _ *gorm.DB) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.assets[code]; !ok {
+		return 0, nil
+	}
+	delete(s.data.assets, code)
+	return 1, nil
+}
+
+// IsAssetInUse checks if any posting has moved the asset.
+func (s *Store) IsAssetInUse(code string, _ *gorm.DB) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, posting := range s.data.postings {
+		if posting.AssetId == code {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Holds
+
+func (s *Store) CreateHold(hold *models.Hold, _ *gorm.DB) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.data.holds {
+		if existing.Memo == hold.Memo {
+			return fmt.Errorf("%w: %s", ErrDuplicateMemo, hold.Memo)
+		}
+	}
+	now := time.Now()
+	hold.Id = s.nextId("holds")
+	hold.CreatedAt, hold.UpdatedAt = now, now
+	s.data.holds = append(s.data.holds, *hold)
+	return nil
+}
+
+func (s *Store) GetHold(memo string, _ *gorm.DB) (*models.Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, hold := range s.data.holds {
+		if hold.Memo == memo {
+			return &hold, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetHoldForUpdate is GetHold, there's nothing to lock.
+func (s *Store) GetHoldForUpdate(memo string, tx *gorm.DB) (*models.Hold, error) {
+	return s.GetHold(memo, tx)
+}
+
+// UpdateHold persists the amounts and the status of the hold.
+func (s *Store) UpdateHold(hold *models.Hold, _ *gorm.DB) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.holds {
+		existing := &s.data.holds[i]
+		if existing.Id != hold.Id {
+			continue
+		}
+		hold.UpdatedAt = time.Now()
+		existing.CapturedAmount = hold.CapturedAmount
+		existing.ReleasedAmount = hold.ReleasedAmount
+		existing.Status = hold.Status
+		existing.UpdatedAt = hold.UpdatedAt
+		return nil
+	}
+	return nil
+}
+
+// GetExpiredHoldMemos returns memos of the active holds which are past their expiry, oldest expiry first.
+func (s *Store) GetExpiredHoldMemos(now time.Time, limit int, _ *gorm.DB) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []models.Hold
+	for _, hold := range s.data.holds {
+		if hold.IsActive() && hold.IsExpired(now) {
+			expired = append(expired, hold)
+		}
+	}
+	sort.SliceStable(expired, func(i, j int) bool { return expired[i].ExpiresAt.Before(*expired[j].ExpiresAt) })
+
+	var memos []string
+	for i := 0; i < len(expired) && i < limit; i++ {
+		memos = append(memos, expired[i].Memo)
+	}
+	return memos, nil
+}
+
+// Outbox
+
+func (s *Store) CreateEvents(events []models.OutboxEvent, _ *gorm.DB) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, event := range events {
+		event.Id = s.nextId("outbox_events")
+		event.CreatedAt, event.UpdatedAt = now, now
+		s.data.events = append(s.data.events, event)
+	}
+	return nil
+}
+
+// Events returns the outbox events, in id order.
+func (s *Store) Events() []models.OutboxEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.OutboxEvent(nil), s.data.events...)
+}
+
+// ClaimDueEvents returns up to limit pending events which are due, oldest first, and pushes their NextAttemptAt
+// by lease.
+func (s *Store) ClaimDueEvents(now time.Time, lease time.Duration, limit int, _ *gorm.DB) ([]models.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []models.OutboxEvent
+	for i := range s.data.events {
+		event := &s.data.events[i]
+		if len(events) == limit {
+			break
+		}
+		if event.Status != string(models.OutboxPending) || event.NextAttemptAt.After(now) {
+			continue
+		}
+		event.NextAttemptAt = now.Add(lease)
+		events = append(events, *event)
+	}
+	return events, nil
+}
+
+// UpdateDelivery persists the delivery state (status, attempts, nextAttemptAt, lastError, deliveredAt) of the event.
+func (s *Store) UpdateDelivery(event *models.OutboxEvent, _ *gorm.DB) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.events {
+		existing := &s.data.events[i]
+		if existing.Id != event.Id {
+			continue
+		}
+		existing.Status = event.Status
+		existing.Attempts = event.Attempts
+		existing.NextAttemptAt = event.NextAttemptAt
+		existing.LastError = event.LastError
+		existing.DeliveredAt = event.DeliveredAt
+		existing.UpdatedAt = time.Now()
+		return nil
+	}
+	return nil
+}
+
+// SequenceEvents sets the sequence of (up to limit of) the events which have none, in id order, after the greatest
+// sequence so far. Events are committed as they're created here, so every one of them can be sequenced.
+func (s *Store) SequenceEvents(limit int, _ *gorm.DB) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last := s.lastSequence()
+	sequenced := 0
+	for i := range s.data.events {
+		if sequenced == limit {
+			break
+		}
+		if s.data.events[i].Sequence != nil {
+			continue
+		}
+		last++
+		sequence := last
+		s.data.events[i].Sequence = &sequence
+		sequenced++
+	}
+	return sequenced, nil
+}
+
+// GetBalanceEventsAfter returns up to limit balance.changed events of bookIds (and assetIds, if not empty)
+// with a sequence greater than afterSequence, in sequence order.
+func (s *Store) GetBalanceEventsAfter(bookIds, assetIds []string, afterSequence uint64, limit int, _ *gorm.DB) ([]models.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []models.OutboxEvent
+	for _, event := range s.data.events {
+		if event.EventType != models.EventBalanceChanged || !funk.ContainsString(bookIds, event.AggregateId) ||
+			event.Sequence == nil || *event.Sequence <= afterSequence {
+			continue
+		}
+		if len(assetIds) > 0 && !funk.ContainsString(assetIds, metadataValue(event.Payload, "assetId")) {
+			continue
+		}
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool { return *events[i].Sequence < *events[j].Sequence })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// GetLastSequence returns the greatest sequence of the events, 0 if there's none.
+func (s *Store) GetLastSequence(_ *gorm.DB) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSequence(), nil
+}
+
+// lastSequence returns the greatest sequence of the events. Caller should hold the lock.
+func (s *Store) lastSequence() uint64 {
+	var last uint64
+	for _, event := range s.data.events {
+		if event.Sequence != nil && *event.Sequence > last {
+			last = *event.Sequence
+		}
+	}
+	return last
+}
@@ -0,0 +1,18 @@
+package memory
+
+import (
+	"testing"
+
+	"general_ledger_golang/models/repositorytest"
+)
+
+func TestBalanceAsOf(t *testing.T) {
+	store := New()
+	repositorytest.BalanceAsOf(t, repositorytest.Repositories{
+		Balances:   store,
+		Operations: store,
+		Postings:   store,
+		Holds:      store,
+		Transactor: store,
+	}, "2", "1", "memory")
+}
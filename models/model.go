@@ -6,6 +6,7 @@ import (
 
 	"gorm.io/gorm"
 
+	"general_ledger_golang/pkg/config"
 	"general_ledger_golang/pkg/database"
 	"general_ledger_golang/pkg/logger"
 )
@@ -19,9 +20,17 @@ type Model struct {
 	UpdatedAt time.Time `gorm:"autoUpdateTime;column:updatedAt" json:"updatedAt"`
 }
 
-// Setup pulls in the created connection in to the models directory for future use
+// Setup pulls in the created connection in to the models directory for future use,
+// and sets the balance tracking policy from the ledger config.
 func Setup() {
 	db, sqlDB = database.GetDB()
+
+	policy, err := NewBalanceTrackingPolicy(config.GetLedgerSetting().ExcludedBalanceBookIds)
+	if err != nil {
+		logger.Logger.Fatalf("Invalid ExcludedBalanceBookIds in ledger config, error: %+v", err)
+	}
+	SetBalanceTrackingPolicy(policy)
+	logger.Logger.Infof("Balance tracking policy: %s", policy)
 }
 
 func GetDB() (*gorm.DB, *sql.DB) {
@@ -4,13 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"reflect"
+	"time"
 
-	"github.com/go-playground/validator/v10"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
-	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/pkg/logger"
 )
 
 type Status string
@@ -19,6 +19,7 @@ const (
 	OperationInit     Status = "INIT"
 	OperationApplied  Status = "APPLIED"
 	OperationRejected Status = "REJECTED"
+	OperationReversed Status = "REVERSED"
 )
 
 type Operation struct {
@@ -29,68 +30,118 @@ type Operation struct {
 	Status          string         `json:"status"`
 	RejectionReason string         `gorm:"index;column:rejectionReason" json:"rejectionReason"`
 	Metadata        datatypes.JSON `json:"metadata"`
+	// Fingerprint is the hash of the client provided payload (type, entries, metadata), a repeat of
+	// the memo with a different fingerprint is an idempotency conflict. Empty for operations created before it.
+	Fingerprint string `json:"fingerprint"`
 }
 
+// OperationFilter narrows down the operations to list, empty/nil fields are not filtered on.
+// BookId matches operations with an entry on that book (rejected ones too, as it's matched on entries).
+// BeforeId is the cursor, only operations with a smaller id are returned, as operations are listed newest first.
+type OperationFilter struct {
+	Type          string
+	Status        string
+	BookId        string
+	MetadataKey   string
+	MetadataValue string
+	From          *time.Time
+	To            *time.Time
+	BeforeId      uint64
+	Limit         int
+}
+
+// ValidatePostOperation reads the operation with NewOperationRequest, and checks its entries against the registered assets.
 func ValidatePostOperation(data map[string]interface{}) {
-	var myMapSlice []map[string]interface{}
-	entryRule := map[string]interface{}{
-		"bookId":  "required,min=1",
-		"assetId": "required,min=1",
-		"value":   "required,min=1",
+	errs := map[string]interface{}{}
+
+	op, err := NewOperationRequest(data)
+	if err != nil {
+		errs["operation"] = err.Error()
+	} else {
+		// entries are well-formed, check those against the registered assets.
+		asset := Asset{}
+		problems, err := asset.ValidateEntries(op.Entries, nil)
+		if err != nil {
+			// not a client error, ApplyOperation validates assets again, so let it through.
+			logger.Logger.Errorf("Asset validation failed, error: %v", err)
+		} else if len(problems) > 0 {
+			errs["assets"] = problems
+		}
 	}
-	myMapSlice = append(myMapSlice, entryRule)
 
-	rules := map[string]interface{}{
-		"type": "required,min=3,max=20",
-		"memo": "required,min=3",
-		//"entries":  entryRule,
-		"metadata": map[string]interface{}{},
+	if len(errs) < 1 {
+		return
 	}
+	data["valid"] = false
+	data["errors"] = errs
 
-	v := validator.New()
-	errs := v.ValidateMap(data, rules)
-	resultErr := map[string]interface{}{}
+	bs, _ := json.Marshal(errs)
+	fmt.Println("Final Errors String: ", string(bs))
+
+	return
+}
+
+// ValidatePostOperationBatch validates a batch request, {operations: [...], continueOnError: bool},
+// each operation is validated with ValidatePostOperation, errors are keyed by the index of the operation.
+func ValidatePostOperationBatch(data map[string]interface{}) {
+	errs := map[string]interface{}{}
 
-	for k, err := range errs {
-		resultErr[k] = err
-		fmt.Println("Error is: ", err)
+	operations, ok := data["operations"].([]interface{})
+	if !ok || len(operations) < 1 {
+		errs["operations"] = "operations should be a non empty list"
+	}
+	if _, ok = data["continueOnError"].(bool); data["continueOnError"] != nil && !ok {
+		errs["continueOnError"] = "continueOnError should be a boolean"
+	}
+
+	for i, operation := range operations {
+		op, ok := operation.(map[string]interface{})
+		if !ok || op["entries"] == nil {
+			errs[fmt.Sprintf("operations[%d]", i)] = "operation should be an object with entries"
+			continue
+		}
+		ValidatePostOperation(op)
+		if op["valid"] == false {
+			errs[fmt.Sprintf("operations[%d]", i)] = op["errors"]
+		}
 	}
 
 	if len(errs) > 0 {
 		data["valid"] = false
-		data["errors"] = resultErr
-		return
+		data["errors"] = errs
 	}
+}
 
-	entries := data["entries"]
+func (o *Operation) GetOperation(memo string, tx *gorm.DB) (*Operation, error) {
+	var d *gorm.DB
 
-	if reflect.TypeOf(entries).Kind() == reflect.Slice {
-		if reflect.TypeOf(entries).Elem().Kind() == reflect.Interface {
-			for _, entry := range entries.([]interface{}) {
-				e := v.ValidateMap(entry.(map[string]interface{}), entryRule)
-				util.Copy(errs, e, false)
-			}
-		}
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
 	}
+	op := Operation{}
+	res := d.Model(&o).Where("memo = ?", memo).Last(&op)
 
-	if len(errs) < 1 {
-		return
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
 	}
-	data["valid"] = false
-	data["errors"] = errs
 
-	bs, _ := json.Marshal(errs)
-	fmt.Println("Final Errors String: ", string(bs))
+	if res.Error != nil {
+		return nil, res.Error
+	}
 
-	return
+	return &op, nil
 }
 
-func (o *Operation) GetOperation(memo string, tx *gorm.DB) (*Operation, error) {
-	if tx != nil {
-		db = tx
+// GetOperationForUpdate works like GetOperation, but row locks the operation until tx commits or rolls back.
+// It must be called with a transaction.
+func (o *Operation) GetOperationForUpdate(memo string, tx *gorm.DB) (*Operation, error) {
+	if tx == nil {
+		return nil, errors.New("GetOperationForUpdate requires a transaction")
 	}
 	op := Operation{}
-	res := db.Model(&o).Where("memo = ?", memo).Last(&op)
+	res := tx.Model(&o).Clauses(clause.Locking{Strength: "UPDATE"}).Where("memo = ?", memo).Last(&op)
 
 	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
 		return nil, nil
@@ -103,8 +154,8 @@ func (o *Operation) GetOperation(memo string, tx *gorm.DB) (*Operation, error) {
 	return &op, nil
 }
 
-func (o *Operation) CreateOperation(op map[string]interface{}, tx *gorm.DB) (*Operation, error) {
-	// operations are idempotent
+// GetOperations returns the operations matching the filter, newest first.
+func (o *Operation) GetOperations(filter OperationFilter, tx *gorm.DB) ([]Operation, error) {
 	var d *gorm.DB
 
 	if tx != nil {
@@ -113,27 +164,63 @@ func (o *Operation) CreateOperation(op map[string]interface{}, tx *gorm.DB) (*Op
 		d = db
 	}
 
-	operation := Operation{}
+	q := d.Model(&o)
+	if filter.Type != "" {
+		q = q.Where("type = ?", filter.Type)
+	}
+	if filter.Status != "" {
+		q = q.Where("status = ?", filter.Status)
+	}
+	if filter.BookId != "" {
+		entryBytes, _ := json.Marshal([]map[string]string{{"bookId": filter.BookId}})
+		q = q.Where("entries @> ?::jsonb", string(entryBytes))
+	}
+	if filter.MetadataKey != "" {
+		q = q.Where("metadata->>? = ?", filter.MetadataKey, filter.MetadataValue)
+	}
+	if filter.From != nil {
+		q = q.Where(`"createdAt" >= ?`, *filter.From)
+	}
+	if filter.To != nil {
+		q = q.Where(`"createdAt" < ?`, *filter.To)
+	}
+	if filter.BeforeId > 0 {
+		q = q.Where("id < ?", filter.BeforeId)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
 
-	if op["entries"] != nil {
-		entriesBytes, _ := json.Marshal(op["entries"])
-		op["entries"] = datatypes.JSON(entriesBytes)
+	var operations []Operation
+	res := q.Order("id DESC").Find(&operations)
+	if res.Error != nil {
+		return nil, res.Error
 	}
+	return operations, nil
+}
+
+// CreateOperation creates the operation (see OperationRequest.ToOperation), or returns the one matching all of its fields.
+func (o *Operation) CreateOperation(operation Operation, tx *gorm.DB) (*Operation, error) {
+	// operations are idempotent
+	var d *gorm.DB
 
-	if op["metadata"] != nil {
-		metadataBytes, _ := json.Marshal(op["metadata"])
-		op["metadata"] = datatypes.JSON(metadataBytes)
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
 	}
 
-	r := d.Model(&o).FirstOrCreate(&operation, op)
+	created := Operation{}
+
+	r := d.Model(&o).FirstOrCreate(&created, operation)
 	if r.Error != nil {
 		return nil, r.Error
 	}
-	return &operation, nil
+	return &created, nil
 }
 
-func (o *Operation) UpdateOperation(op map[string]interface{}, tx *gorm.DB) error {
-	// operations are idempotent
+// UpdateOperation saves the status, rejection reason and metadata of the operation, found by its memo.
+func (o *Operation) UpdateOperation(operation *Operation, tx *gorm.DB) error {
 	var d *gorm.DB
 
 	if tx != nil {
@@ -142,7 +229,9 @@ func (o *Operation) UpdateOperation(op map[string]interface{}, tx *gorm.DB) erro
 		d = db
 	}
 
-	r := d.Model(&o).Where("memo = ?", op["memo"]).Updates(&op)
+	r := d.Model(&Operation{}).Where("memo = ?", operation.Memo).
+		Select("status", "rejectionReason", "metadata").
+		Updates(Operation{Status: operation.Status, RejectionReason: operation.RejectionReason, Metadata: operation.Metadata})
 	if r.Error != nil {
 		return r.Error
 	}
@@ -0,0 +1,217 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/datatypes"
+
+	"general_ledger_golang/pkg/util"
+)
+
+var ErrInvalidOperation = errors.New("invalid operation")
+
+// Entry is a single leg of an operation, Value is added to the balance of BookId for AssetId.
+// Ids are strings, but integer json numbers are accepted as well (ex: "bookId": 4 is the same as "bookId": "4").
+// Value is a decimal, written as a json string or number, and is always rendered as a canonical string.
+type Entry struct {
+	BookId  string          `json:"bookId"`
+	AssetId string          `json:"assetId"`
+	Value   decimal.Decimal `json:"value"`
+}
+
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		BookId  json.RawMessage `json:"bookId"`
+		AssetId json.RawMessage `json:"assetId"`
+		Value   json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%w: entry %s should be an object", ErrInvalidOperation, string(data))
+	}
+
+	var err error
+	if e.BookId, err = idOf("bookId", raw.BookId); err != nil {
+		return err
+	}
+	// "01" is book 1, same as for the balance tracking policy.
+	e.BookId = canonicalBookId(e.BookId)
+	if e.AssetId, err = idOf("assetId", raw.AssetId); err != nil {
+		return err
+	}
+	if e.Value, err = valueOf(raw.Value); err != nil {
+		return err
+	}
+	return nil
+}
+
+// idOf reads an id, a json string or an integer json number, empty if it's missing or null.
+func idOf(field string, raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id, nil
+	}
+	if number, err := decimal.NewFromString(string(raw)); err == nil && number.Equal(number.Truncate(0)) {
+		return number.String(), nil
+	}
+	return "", fmt.Errorf("%w: %s %s should be a string or an integer", ErrInvalidOperation, field, string(raw))
+}
+
+// valueOf reads an entry value, a json string or number.
+func valueOf(raw json.RawMessage) (decimal.Decimal, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return decimal.Zero, fmt.Errorf("%w: value is required", ErrInvalidOperation)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		value = string(raw)
+	}
+	d, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("%w: value %s is not a number", ErrInvalidOperation, string(raw))
+	}
+	return d, nil
+}
+
+// OperationRequest is the client provided payload of an operation,
+// {"type": "", "memo": "", "entries": [{"bookId": "", "assetId": "", "value": ""}], "metadata": {}}.
+type OperationRequest struct {
+	Type     string                 `json:"type"`
+	Memo     string                 `json:"memo"`
+	Entries  []Entry                `json:"entries"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// NewOperationRequest reads the operation out of a request body (or any map with the same keys), and validates it.
+// Returned error wraps ErrInvalidOperation.
+func NewOperationRequest(data map[string]interface{}) (OperationRequest, error) {
+	var op OperationRequest
+	bytes, err := json.Marshal(map[string]interface{}{
+		"type":     data["type"],
+		"memo":     data["memo"],
+		"entries":  data["entries"],
+		"metadata": data["metadata"],
+	})
+	if err != nil {
+		return op, fmt.Errorf("%w: %v", ErrInvalidOperation, err)
+	}
+	if err = util.UnmarshalUseNumber(bytes, &op); err != nil {
+		if errors.Is(err, ErrInvalidOperation) {
+			return op, err
+		}
+		return op, fmt.Errorf("%w: %v", ErrInvalidOperation, err)
+	}
+	return op, op.Validate()
+}
+
+// OperationRequestOf reads the payload of an already created operation.
+func OperationRequestOf(operation *Operation) (OperationRequest, error) {
+	op := OperationRequest{Type: operation.Type, Memo: operation.Memo, Metadata: map[string]interface{}{}}
+	if len(operation.Entries) > 0 {
+		if err := json.Unmarshal(operation.Entries, &op.Entries); err != nil {
+			return op, fmt.Errorf("entries of operation %s are malformed: %w", operation.Memo, err)
+		}
+	}
+	if len(operation.Metadata) > 0 {
+		if err := util.UnmarshalUseNumber(operation.Metadata, &op.Metadata); err != nil {
+			return op, fmt.Errorf("metadata of operation %s is malformed: %w", operation.Memo, err)
+		}
+	}
+	return op, nil
+}
+
+// Validate checks that the operation is well-formed, entries are checked against the assets by Asset.ValidateEntries.
+func (r OperationRequest) Validate() error {
+	var problems []string
+	if len(r.Type) < 3 || len(r.Type) > 20 {
+		problems = append(problems, "type should be 3 to 20 characters")
+	}
+	if len(r.Memo) < 3 {
+		problems = append(problems, "memo should be at least 3 characters")
+	}
+	if r.Metadata == nil {
+		// balances are kept per metadata["operation"], an operation without metadata can't be applied.
+		problems = append(problems, "metadata should be an object")
+	}
+	if len(r.Entries) < 1 {
+		problems = append(problems, "entries are empty")
+	}
+	for i, entry := range r.Entries {
+		if entry.BookId == "" {
+			problems = append(problems, fmt.Sprintf("entries[%d].bookId is required", i))
+		}
+		if entry.AssetId == "" {
+			problems = append(problems, fmt.Sprintf("entries[%d].assetId is required", i))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidOperation, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// OperationType is metadata["operation"], the operation type balances are kept under, empty if it has none.
+func (r OperationRequest) OperationType() string {
+	operationType, _ := r.Metadata["operation"].(string)
+	return operationType
+}
+
+// BookIds returns the bookIds of the entries, in order.
+func (r OperationRequest) BookIds() []string {
+	bookIds := make([]string, 0, len(r.Entries))
+	for _, entry := range r.Entries {
+		bookIds = append(bookIds, entry.BookId)
+	}
+	return bookIds
+}
+
+// ToOperation returns the operation to be created for the request, entries and metadata as json.
+func (r OperationRequest) ToOperation() (Operation, error) {
+	entries := r.Entries
+	if entries == nil {
+		entries = []Entry{}
+	}
+	entriesBytes, err := json.Marshal(entries)
+	if err != nil {
+		return Operation{}, err
+	}
+	operation := Operation{Type: r.Type, Memo: r.Memo, Entries: datatypes.JSON(entriesBytes)}
+	if r.Metadata != nil {
+		metadataBytes, err := json.Marshal(r.Metadata)
+		if err != nil {
+			return Operation{}, err
+		}
+		operation.Metadata = datatypes.JSON(metadataBytes)
+	}
+	return operation, nil
+}
+
+// Copy returns a copy of the request, which can be modified (ex: sorting the entries) without affecting it.
+func (r OperationRequest) Copy() OperationRequest {
+	c := r
+	c.Entries = append([]Entry(nil), r.Entries...)
+	if r.Metadata != nil {
+		c.Metadata = make(map[string]interface{}, len(r.Metadata))
+		for k, v := range r.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	return c
+}
+
+// sortEntries sorts the entries by bookId, then assetId, so that balances are always locked in the same order.
+func sortEntries(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].BookId == entries[j].BookId {
+			return entries[i].AssetId < entries[j].AssetId
+		}
+		return entries[i].BookId < entries[j].BookId
+	})
+}
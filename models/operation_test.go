@@ -0,0 +1,101 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidatePostOperationBatch(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"operations missing":      {},
+		"operations empty":        {"operations": []interface{}{}},
+		"operation not an object": {"operations": []interface{}{"op"}},
+		"entries missing":         {"operations": []interface{}{map[string]interface{}{"type": "TRANSFER", "memo": "m1"}}},
+		"continueOnError invalid": {"operations": []interface{}{}, "continueOnError": "yes"},
+	}
+
+	for name, data := range cases {
+		ValidatePostOperationBatch(data)
+		if data["valid"] != false {
+			t.Errorf("%s: expected batch to be invalid", name)
+		}
+	}
+}
+
+func TestNewOperationRequest(t *testing.T) {
+	body := map[string]interface{}{
+		"type": "TRANSFER",
+		"memo": "MEMO_1",
+		"entries": []interface{}{
+			// numbers, as decoded from a json body.
+			map[string]interface{}{"bookId": float64(1000000), "assetId": "btc", "value": -1.5},
+			map[string]interface{}{"bookId": "03", "assetId": "btc", "value": "1.50"},
+		},
+		"metadata": map[string]interface{}{"operation": "BLOCK"},
+	}
+
+	op, err := NewOperationRequest(body)
+	if err != nil {
+		t.Fatalf("Err should be nil, got: %v", err)
+	}
+	if op.Entries[0].BookId != "1000000" || op.Entries[0].Value.String() != "-1.5" ||
+		op.Entries[1].BookId != "3" || op.Entries[1].Value.String() != "1.5" {
+		t.Fatalf("Entries are not read as expected, got: %+v", op.Entries)
+	}
+	if op.OperationType() != "BLOCK" {
+		t.Fatalf("Operation type should be BLOCK, got: %s", op.OperationType())
+	}
+
+	invalid := map[string][]interface{}{
+		"fractional bookId":   {map[string]interface{}{"bookId": 4.5, "assetId": "btc", "value": "1"}},
+		"bookId not an id":    {map[string]interface{}{"bookId": true, "assetId": "btc", "value": "1"}},
+		"assetId missing":     {map[string]interface{}{"bookId": "4", "value": "1"}},
+		"value not a number":  {map[string]interface{}{"bookId": "4", "assetId": "btc", "value": "abc"}},
+		"value missing":       {map[string]interface{}{"bookId": "4", "assetId": "btc"}},
+		"entry not an object": {"entry"},
+		"entries empty":       {},
+	}
+	for name, entries := range invalid {
+		body["entries"] = entries
+		if _, err = NewOperationRequest(body); !errors.Is(err, ErrInvalidOperation) {
+			t.Errorf("%s: expected ErrInvalidOperation, got: %v", name, err)
+		}
+	}
+
+	body["entries"] = "entries"
+	if _, err = NewOperationRequest(body); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("entries not a list: expected ErrInvalidOperation, got: %v", err)
+	}
+}
+
+func TestGetOperations(t *testing.T) {
+	r := useRecorder(t)
+	from := time.Date(2023, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	_, err := (&Operation{}).GetOperations(OperationFilter{
+		Type: "TRANSFER", Status: "APPLIED", BookId: "4", MetadataKey: "orderId", MetadataValue: "42",
+		From: &from, BeforeId: 120, Limit: 11,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Err should be nil, got: %v", err)
+	}
+
+	queries := r.find(`FROM "operations"`, "type = $1", "status = $2", "entries @> $3::jsonb", "metadata->>$4 = $5",
+		`"createdAt" >= $6`, "id < $7", "ORDER BY id DESC LIMIT 11")
+	if len(queries) != 1 {
+		t.Fatalf("Operations should be filtered and paginated newest first, got: %+v", r.queries)
+	}
+	args := queries[0].Args
+	if args[2] != `[{"bookId":"4"}]` || args[3] != "orderId" || args[4] != "42" || args[6] != int64(120) {
+		t.Fatalf("Filter args are not as expected, got: %+v", args)
+	}
+
+	r.queries = nil
+	if _, err = (&Operation{}).GetOperations(OperationFilter{}, nil); err != nil {
+		t.Fatalf("Err should be nil, got: %v", err)
+	}
+	if len(r.find("WHERE")) != 0 || len(r.find("LIMIT")) != 0 {
+		t.Fatalf("Empty filter shouldn't filter, got: %+v", r.queries)
+	}
+}
@@ -0,0 +1,235 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxPending   OutboxStatus = "PENDING"
+	OutboxDelivered OutboxStatus = "DELIVERED"
+	// OutboxDead is the dead-letter state, delivery failed MaxAttempts times and is not tried anymore.
+	OutboxDead OutboxStatus = "DEAD"
+)
+
+// Event types of the outbox events.
+const (
+	EventOperationApplied  = "operation.applied"
+	EventOperationRejected = "operation.rejected"
+	EventBalanceChanged    = "balance.changed"
+)
+
+// OutboxEvent is a ledger event, written in the same trx as the change it describes,
+// so an event exists if and only if the change is committed. Those are delivered to webhooks afterwards.
+type OutboxEvent struct {
+	Model
+	EventType string `gorm:"index;column:eventType" json:"eventType"`
+	// AggregateId is the memo for operation events, bookId for balance events.
+	AggregateId   string         `gorm:"index;column:aggregateId" json:"aggregateId"`
+	Payload       datatypes.JSON `json:"payload"`
+	Status        string         `gorm:"index" json:"status"`
+	Attempts      int            `json:"attempts"`
+	NextAttemptAt time.Time      `gorm:"index;column:nextAttemptAt" json:"nextAttemptAt"`
+	LastError     string         `gorm:"column:lastError" json:"lastError,omitempty"`
+	DeliveredAt   *time.Time     `gorm:"column:deliveredAt" json:"deliveredAt,omitempty"`
+	// Sequence is the position of the event in commit order, set by SequenceEvents once the event is committed,
+	// nil until then. Unlike ids, which are taken on insert, it never has a gap that's filled later.
+	Sequence *uint64 `gorm:"index;column:sequence" json:"sequence,omitempty"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox"
+}
+
+// BalanceChangedPayload is the payload of a balance.changed event.
+type BalanceChangedPayload struct {
+	BookId  string `json:"bookId"`
+	AssetId string `json:"assetId"`
+	// Changes are the deltas per operationType balance, ex: {"OVERALL": "-5", "HELD": "5"}.
+	Changes map[string]string `json:"changes"`
+	// Balances are the changed balances right after the change, empty if the balance of the book is not tracked.
+	Balances map[string]string `json:"balances,omitempty"`
+	// Source is what changed the balance, operation or hold, Memo is its memo.
+	Source string `json:"source"`
+	Memo   string `json:"memo"`
+}
+
+// NewOutboxEvent returns a pending event, due right away.
+func NewOutboxEvent(eventType, aggregateId string, payload interface{}) (OutboxEvent, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return OutboxEvent{}, err
+	}
+	return OutboxEvent{
+		EventType:     eventType,
+		AggregateId:   aggregateId,
+		Payload:       datatypes.JSON(payloadBytes),
+		Status:        string(OutboxPending),
+		NextAttemptAt: time.Now(),
+	}, nil
+}
+
+// BalanceChangedEventOf returns the balance.changed event of the given changes, with the given balances
+// (after the changes) of the changed operation types.
+func BalanceChangedEventOf(source, memo, bookId, assetId string, changes []BalanceChange, balances []BookBalance) (OutboxEvent, error) {
+	payload := BalanceChangedPayload{
+		BookId:   bookId,
+		AssetId:  assetId,
+		Changes:  map[string]string{},
+		Balances: map[string]string{},
+		Source:   source,
+		Memo:     memo,
+	}
+	for _, change := range changes {
+		payload.Changes[change.OperationType] = change.Value.String()
+	}
+	for _, balance := range balances {
+		if _, ok := payload.Changes[balance.OperationType]; ok {
+			payload.Balances[balance.OperationType] = balance.Balance.String()
+		}
+	}
+
+	return NewOutboxEvent(EventBalanceChanged, bookId, payload)
+}
+
+func (o *OutboxEvent) CreateEvents(events []OutboxEvent, tx *gorm.DB) error {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return d.Create(&events).Error
+}
+
+// ClaimDueEvents returns up to limit pending events which are due, oldest first, and pushes their NextAttemptAt
+// by lease, so that other dispatchers don't pick those while they're being delivered.
+// Should be called in a trx, rows locked by another dispatcher's trx are skipped.
+func (o *OutboxEvent) ClaimDueEvents(now time.Time, lease time.Duration, limit int, tx *gorm.DB) ([]OutboxEvent, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+
+	var events []OutboxEvent
+	res := d.Model(&OutboxEvent{}).Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where(`status = ? AND "nextAttemptAt" <= ?`, string(OutboxPending), now).
+		Order("id").Limit(limit).Find(&events)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint64, 0, len(events))
+	for i := range events {
+		ids = append(ids, events[i].Id)
+		events[i].NextAttemptAt = now.Add(lease)
+	}
+	res = d.Model(&OutboxEvent{}).Where("id IN ?", ids).Update("nextAttemptAt", now.Add(lease))
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return events, nil
+}
+
+// UpdateDelivery persists the delivery state (status, attempts, nextAttemptAt, lastError, deliveredAt) of the event.
+func (o *OutboxEvent) UpdateDelivery(event *OutboxEvent, tx *gorm.DB) error {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+	return d.Model(event).Select("status", "attempts", "nextAttemptAt", "lastError", "deliveredAt").Updates(event).Error
+}
+
+// SequenceEvents sets the sequence of (up to limit of) the committed events which have none, in id order, after the
+// greatest sequence so far. Returns the number of events sequenced, 0 if another trx is sequencing meanwhile.
+//
+// Events are sequenced one trx at a time (a trx level advisory lock), so sequences are committed in order, and an
+// event that commits late gets a later sequence instead of filling a gap that's been read past.
+func (o *OutboxEvent) SequenceEvents(limit int, tx *gorm.DB) (int, error) {
+	if tx == nil {
+		return 0, errors.New("SequenceEvents requires a transaction")
+	}
+
+	var locked bool
+	res := tx.Raw(`SELECT pg_try_advisory_xact_lock(hashtext('outbox_sequence'))`).Scan(&locked)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	res = tx.Exec(`UPDATE outbox SET sequence = s.sequence
+		FROM (
+			SELECT id, (SELECT COALESCE(MAX(sequence), 0) FROM outbox) + ROW_NUMBER() OVER (ORDER BY id) AS sequence
+			FROM outbox WHERE sequence IS NULL ORDER BY id LIMIT ?
+		) AS s
+		WHERE outbox.id = s.id`, limit)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return int(res.RowsAffected), nil
+}
+
+// GetBalanceEventsAfter returns up to limit balance.changed events of bookIds (and assetIds, if not empty)
+// with a sequence greater than afterSequence, in sequence order.
+func (o *OutboxEvent) GetBalanceEventsAfter(bookIds, assetIds []string, afterSequence uint64, limit int, tx *gorm.DB) ([]OutboxEvent, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+
+	q := d.Model(&OutboxEvent{}).
+		Where(`"eventType" = ? AND "aggregateId" IN ? AND sequence > ?`, EventBalanceChanged, bookIds, afterSequence)
+	if len(assetIds) > 0 {
+		q = q.Where(`payload->>'assetId' IN ?`, assetIds)
+	}
+
+	var events []OutboxEvent
+	res := q.Order("sequence").Limit(limit).Find(&events)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return events, nil
+}
+
+// GetLastSequence returns the greatest sequence of the events, 0 if there's none.
+func (o *OutboxEvent) GetLastSequence(tx *gorm.DB) (uint64, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+
+	var lastSequence uint64
+	res := d.Model(&OutboxEvent{}).Select("COALESCE(MAX(sequence), 0)").Scan(&lastSequence)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return lastSequence, nil
+}
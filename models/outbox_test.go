@@ -0,0 +1,58 @@
+package models
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+func TestSequenceEvents(t *testing.T) {
+	r := useRecorder(t)
+	locked := false
+	r.respond = func(query string) ([]string, [][]driver.Value) {
+		return []string{"pg_try_advisory_xact_lock"}, [][]driver.Value{{locked}}
+	}
+
+	if _, err := (&OutboxEvent{}).SequenceEvents(10, nil); err == nil {
+		t.Fatalf("SequenceEvents should require a transaction")
+	}
+
+	// another trx is sequencing.
+	if sequenced, err := (&OutboxEvent{}).SequenceEvents(10, db); err != nil || sequenced != 0 {
+		t.Fatalf("Nothing should be sequenced without the lock, got: %d, err: %v", sequenced, err)
+	}
+	if len(r.find("UPDATE outbox")) != 0 {
+		t.Fatalf("Events shouldn't be updated without the lock, got: %+v", r.queries)
+	}
+
+	locked = true
+	if _, err := (&OutboxEvent{}).SequenceEvents(10, db); err != nil {
+		t.Fatalf("Err should be nil, got: %v", err)
+	}
+	update := r.find("UPDATE outbox SET sequence", "COALESCE(MAX(sequence), 0)", "ROW_NUMBER() OVER (ORDER BY id)",
+		"WHERE sequence IS NULL ORDER BY id LIMIT $1")
+	if len(update) != 1 || update[0].Args[0] != int64(10) {
+		t.Fatalf("Unsequenced events should be sequenced in id order after the greatest sequence, got: %+v", r.queries)
+	}
+}
+
+func TestGetBalanceEventsAfter(t *testing.T) {
+	r := useRecorder(t)
+
+	_, err := (&OutboxEvent{}).GetBalanceEventsAfter([]string{"3", "4"}, nil, 42, 500, nil)
+	if err != nil {
+		t.Fatalf("Err should be nil, got: %v", err)
+	}
+	query := r.find(`"eventType" = $1 AND "aggregateId" IN ($2,$3) AND sequence > $4`, `ORDER BY sequence LIMIT 500`)
+	if len(query) != 1 || strings.Contains(query[0].SQL, "assetId") || query[0].Args[3] != int64(42) {
+		t.Fatalf("Events should be filtered by book and ordered by sequence, got: %+v", r.queries)
+	}
+
+	_, err = (&OutboxEvent{}).GetBalanceEventsAfter([]string{"3"}, []string{"btc"}, 42, 500, nil)
+	if err != nil {
+		t.Fatalf("Err should be nil, got: %v", err)
+	}
+	if len(r.find(`sequence > $3`, `payload->>'assetId' IN ($4)`)) != 1 {
+		t.Fatalf("Events should be filtered by asset, got: %+v", r.queries)
+	}
+}
@@ -1,8 +1,16 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
 	"strconv"
+	"time"
 
+	"github.com/shopspring/decimal"
+	"github.com/thoas/go-funk"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
@@ -11,14 +19,37 @@ type Posting struct {
 	Model
 	OperationId string         `gorm:"index;column:operationId" json:"operationId"`
 	BookId      string         `gorm:"index;column:bookId" json:"bookId"`
-	Value       string         `json:"status"`
+	Value       string         `json:"value"`
 	Metadata    datatypes.JSON `json:"metadata"`
 	AssetId     string         `gorm:"index;column:assetId" json:"assetId"`
+	// Hash chains the postings of a book: sha256 of PrevHash and the posting's canonical content (PostingHash).
+	// PrevHash is the Hash of the previous posting of the same book, empty for the first one.
+	// Both are empty for postings created before the chain was introduced.
+	Hash     string `gorm:"index" json:"hash"`
+	PrevHash string `gorm:"column:prevHash" json:"prevHash"`
 }
 
-// BulkCreatePosting will create posting entries as a bulk from given slice of maps.
-// Conds will have "operationId" first, then "metadata" added to it. Any other field inside conds is ignored.
-func (p *Posting) BulkCreatePosting(postings []interface{}, tx *gorm.DB, conds ...interface{}) error {
+// PostingFilter narrows down the postings of a book for a statement.
+// Empty/nil fields are not filtered on. AfterId is the cursor, only postings with a greater id are returned.
+type PostingFilter struct {
+	BookId        string
+	AssetId       string
+	OperationType string
+	From          *time.Time
+	To            *time.Time
+	AfterId       uint64
+	Limit         int
+}
+
+// StatementPosting is a posting with the balance of its book and asset (and operation type, if filtered on) right after it.
+type StatementPosting struct {
+	Posting
+	RunningBalance decimal.Decimal `gorm:"column:runningBalance" json:"runningBalance"`
+}
+
+// BulkCreatePosting will create a posting for every entry of the operation, as a bulk.
+// Every posting gets the operationId and metadata of the operation.
+func (p *Posting) BulkCreatePosting(entries []Entry, tx *gorm.DB, operationId uint64, metadata datatypes.JSON) error {
 	// operations are idempotent
 	var d *gorm.DB
 
@@ -28,32 +59,249 @@ func (p *Posting) BulkCreatePosting(postings []interface{}, tx *gorm.DB, conds .
 		d = db
 	}
 	var postingsSlice []Posting
+	// createdAt is part of the hash, so it's set here instead of by the db, truncated to the db's precision.
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
 
-	for i := 0; i < len(postings); i++ {
-		posting := postings[i].(map[string]interface{})
-
-		operationId := posting["operationId"]
-		metadata := posting["metadata"]
-
-		if conds[0] != nil {
-			operationId = conds[0]
-		}
-		if conds[1] != nil {
-			metadata = conds[1]
-		}
-
+	for _, entry := range entries {
 		postingsSlice = append(postingsSlice, Posting{
-			OperationId: strconv.Itoa(int(operationId.(uint64))),
-			BookId:      posting["bookId"].(string),
-			Value:       posting["value"].(string),
-			Metadata:    metadata.(datatypes.JSON),
-			AssetId:     posting["assetId"].(string),
+			Model:       Model{CreatedAt: createdAt},
+			OperationId: strconv.FormatUint(operationId, 10),
+			BookId:      entry.BookId,
+			Value:       entry.Value.String(),
+			Metadata:    metadata,
+			AssetId:     entry.AssetId,
 		})
 	}
 
+	if err := p.chainPostings(postingsSlice, d); err != nil {
+		return err
+	}
+
 	r := d.Model(&p).Create(postingsSlice)
 	if r.Error != nil {
 		return r.Error
 	}
 	return nil
 }
+
+// GetStatement returns the postings matching the filter, oldest first, each with its running balance.
+//
+// The running balance is over the whole history of the book (for the asset and operation type), so it's correct
+// even for the first row of a page or of a date range: the page is seeded with the sum of the postings before it.
+func (p *Posting) GetStatement(filter PostingFilter, tx *gorm.DB) ([]StatementPosting, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+
+	ofBook := func(query *gorm.DB) *gorm.DB {
+		query = query.Where(`"bookId" = ?`, filter.BookId)
+		if filter.AssetId != "" {
+			query = query.Where(`"assetId" = ?`, filter.AssetId)
+		}
+		if filter.OperationType != "" && filter.OperationType != OverallOperation {
+			query = query.Where(`metadata->>'operation' = ?`, filter.OperationType)
+		}
+		return query
+	}
+
+	q := ofBook(d.Model(&Posting{}))
+	if filter.From != nil {
+		q = q.Where(`"createdAt" >= ?`, *filter.From)
+	}
+	if filter.To != nil {
+		q = q.Where(`"createdAt" < ?`, *filter.To)
+	}
+	if filter.AfterId > 0 {
+		q = q.Where("id > ?", filter.AfterId)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+
+	var postings []StatementPosting
+	res := q.Order("id").Scan(&postings)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if len(postings) == 0 {
+		return postings, nil
+	}
+
+	var opening []BookBalance
+	res = ofBook(d.Model(&Posting{})).
+		Select(`"assetId", SUM(value::numeric) AS balance`).
+		Where("id < ?", postings[0].Id).
+		Group(`"assetId"`).
+		Scan(&opening)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	return withRunningBalances(postings, opening)
+}
+
+// withRunningBalances sets the running balance of every posting (in id order), starting from the opening
+// balances (per assetId) of the postings before them.
+func withRunningBalances(postings []StatementPosting, opening []BookBalance) ([]StatementPosting, error) {
+	balances := map[string]decimal.Decimal{}
+	for _, balance := range opening {
+		balances[balance.AssetId] = balance.Balance
+	}
+	for i := range postings {
+		value, err := decimal.NewFromString(postings[i].Value)
+		if err != nil {
+			return nil, fmt.Errorf("value %s of posting %d is not a number: %w", postings[i].Value, postings[i].Id, err)
+		}
+		balances[postings[i].AssetId] = balances[postings[i].AssetId].Add(value)
+		postings[i].RunningBalance = balances[postings[i].AssetId]
+	}
+	return postings, nil
+}
+
+// chainPostings sets Hash and PrevHash of the new postings, continuing the chain of each book.
+// The books are row locked (Book.LockBooks) until tx ends, so that concurrent operations on the same book
+// append to its chain one after the other.
+func (p *Posting) chainPostings(postings []Posting, tx *gorm.DB) error {
+	var bookIds []string
+	for _, posting := range postings {
+		bookIds = append(bookIds, posting.BookId)
+	}
+	bookIds = funk.UniqString(bookIds)
+	sort.Strings(bookIds)
+
+	if err := (&Book{}).LockBooks(bookIds, tx); err != nil {
+		return err
+	}
+
+	lastHash := map[string]string{}
+	for _, bookId := range bookIds {
+		last := Posting{}
+		res := tx.Model(&Posting{}).Select("hash").Where(`"bookId" = ?`, bookId).Order("id DESC").Limit(1).Find(&last)
+		if res.Error != nil {
+			return res.Error
+		}
+		lastHash[bookId] = last.Hash
+	}
+
+	for i := range postings {
+		postings[i].PrevHash = lastHash[postings[i].BookId]
+		postings[i].Hash = PostingHash(postings[i])
+		lastHash[postings[i].BookId] = postings[i].Hash
+	}
+	return nil
+}
+
+// PostingHash is the sha256 (hex) of the posting's PrevHash and canonical content: operationId, bookId, assetId,
+// value, metadata (keys sorted) and createdAt (UTC, microseconds). Id is not part of it, as it's assigned by the db.
+func PostingHash(posting Posting) string {
+	var metadata interface{}
+	_ = json.Unmarshal(posting.Metadata, &metadata)
+
+	content, _ := json.Marshal([]interface{}{
+		posting.PrevHash,
+		posting.OperationId,
+		posting.BookId,
+		posting.AssetId,
+		posting.Value,
+		metadata,
+		posting.CreatedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// GetChainPage returns the postings of the book (all books, if bookId is empty) with id greater than afterId,
+// in id order, for walking the hash chain page by page.
+func (p *Posting) GetChainPage(bookId string, afterId uint64, limit int, tx *gorm.DB) ([]Posting, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+
+	q := d.Model(&Posting{}).Where("id > ?", afterId)
+	if bookId != "" {
+		q = q.Where(`"bookId" = ?`, bookId)
+	}
+
+	var postings []Posting
+	res := q.Order("id").Limit(limit).Find(&postings)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return postings, nil
+}
+
+// SumPostings returns the sum of all the postings, per bookId, assetId and operation type (metadata["operation"]).
+func (p *Posting) SumPostings(tx *gorm.DB) ([]BookBalance, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+
+	var sums []BookBalance
+	res := d.Model(&Posting{}).
+		Select(`"bookId", "assetId", COALESCE(metadata->>'operation', '') AS "operationType", SUM(value::numeric) AS balance`).
+		Group(`"bookId", "assetId", metadata->>'operation'`).
+		Scan(&sums)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return sums, nil
+}
+
+// BookTotal is the debit and credit totals of a book's postings of an asset, along with the book's account details.
+// Credits are the positive posting values, debits the negative ones (as a positive amount).
+type BookTotal struct {
+	BookId      string          `json:"bookId"`
+	Name        string          `json:"name"`
+	AccountType string          `json:"accountType"`
+	NormalSide  string          `json:"normalSide"`
+	Metadata    datatypes.JSON  `json:"metadata"`
+	AssetId     string          `json:"assetId"`
+	Debit       decimal.Decimal `json:"debit"`
+	Credit      decimal.Decimal `json:"credit"`
+}
+
+// SumBookTotals returns the debit and credit totals per book and asset, of the postings created till asOf
+// (all, if nil), of assetId (every asset, if empty). Sorted by assetId, bookId.
+func (p *Posting) SumBookTotals(asOf *time.Time, assetId string, tx *gorm.DB) ([]BookTotal, error) {
+	var d *gorm.DB
+
+	if tx != nil {
+		d = tx
+	} else {
+		d = db
+	}
+
+	q := d.Table("postings AS p").Joins(`LEFT JOIN books AS b ON b.id::text = p."bookId"`)
+	if asOf != nil {
+		q = q.Where(`p."createdAt" <= ?`, *asOf)
+	}
+	if assetId != "" {
+		q = q.Where(`p."assetId" = ?`, assetId)
+	}
+
+	var totals []BookTotal
+	res := q.Select(`p."bookId" AS book_id, COALESCE(b.name, '') AS name, COALESCE(b."accountType", '') AS account_type,
+			COALESCE(b."normalSide", '') AS normal_side, COALESCE(b.metadata, '{}') AS metadata,
+			p."assetId" AS asset_id,
+			COALESCE(SUM(-p.value::numeric) FILTER (WHERE p.value::numeric < 0), 0) AS debit,
+			COALESCE(SUM(p.value::numeric) FILTER (WHERE p.value::numeric > 0), 0) AS credit`).
+		Group(`p."bookId", b.name, b."accountType", b."normalSide", b.metadata, p."assetId"`).
+		Order(`p."assetId", p."bookId"`).
+		Scan(&totals)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return totals, nil
+}
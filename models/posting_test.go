@@ -0,0 +1,57 @@
+package models
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetStatement(t *testing.T) {
+	r := useRecorder(t)
+	r.respond = func(query string) ([]string, [][]driver.Value) {
+		if strings.Contains(query, "SUM(value::numeric)") {
+			return []string{"assetId", "balance"}, [][]driver.Value{{"btc", "10"}}
+		}
+		return []string{"id", "bookId", "assetId", "value"}, [][]driver.Value{
+			{int64(11), "4", "btc", "-2.5"},
+			{int64(12), "4", "inr", "100"},
+			{int64(14), "4", "btc", "1"},
+		}
+	}
+	from := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	postings, err := (&Posting{}).GetStatement(PostingFilter{BookId: "4", OperationType: "DEPOSIT", From: &from, AfterId: 10, Limit: 3}, nil)
+	if err != nil {
+		t.Fatalf("Err should be nil, got: %v", err)
+	}
+	var balances []string
+	for _, posting := range postings {
+		balances = append(balances, posting.RunningBalance.String())
+	}
+	if strings.Join(balances, ",") != "7.5,100,8.5" {
+		t.Fatalf("Running balances should start from the opening balances, got: %v", balances)
+	}
+
+	page := r.find(`FROM "postings"`, `metadata->>'operation' = $2`, `"createdAt" >= $3`, `id > $4`, `ORDER BY id LIMIT 3`)
+	if len(page) != 1 || strings.Contains(page[0].SQL, "OVER") {
+		t.Fatalf("Page should be a plain query of the postings after the cursor, got: %+v", r.queries)
+	}
+	// the opening balance is of the whole history before the page, not bound by from.
+	opening := r.find(`SUM(value::numeric) AS balance`, `metadata->>'operation' = $2`, `id < $3`, `GROUP BY "assetId"`)
+	if len(opening) != 1 || strings.Contains(opening[0].SQL, `"createdAt"`) || opening[0].Args[2] != int64(11) {
+		t.Fatalf("Opening balances should be summed before the first posting of the page, got: %+v", r.queries)
+	}
+}
+
+func TestGetStatementEmptyPage(t *testing.T) {
+	r := useRecorder(t)
+
+	postings, err := (&Posting{}).GetStatement(PostingFilter{BookId: "4", AfterId: 99}, nil)
+	if err != nil || len(postings) != 0 {
+		t.Fatalf("Empty page should have no postings, got: %+v, err: %v", postings, err)
+	}
+	if len(r.queries) != 1 {
+		t.Fatalf("Opening balances shouldn't be queried for an empty page, got: %+v", r.queries)
+	}
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// recordedQuery is a query run against the recorder, with its args.
+type recordedQuery struct {
+	SQL  string
+	Args []driver.Value
+}
+
+// recorder is a database/sql driver which records the queries run on it, so that the queries the models build
+// can be checked without a database. Queries return the rows of respond (no rows if it's nil).
+type recorder struct {
+	queries []recordedQuery
+	respond func(query string) (columns []string, rows [][]driver.Value)
+}
+
+// useRecorder points the models to a recorder, for the duration of the test.
+func useRecorder(t *testing.T) *recorder {
+	r := &recorder{}
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(r)}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Opening the recorder failed, error: %v", err)
+	}
+	previous := db
+	db = gormDB
+	t.Cleanup(func() { db = previous })
+	return r
+}
+
+// find returns the recorded queries which have all the fragments.
+func (r *recorder) find(fragments ...string) []recordedQuery {
+	var found []recordedQuery
+	for _, query := range r.queries {
+		matches := true
+		for _, fragment := range fragments {
+			matches = matches && strings.Contains(query.SQL, fragment)
+		}
+		if matches {
+			found = append(found, query)
+		}
+	}
+	return found
+}
+
+func (r *recorder) Connect(context.Context) (driver.Conn, error) { return &recorderConn{r}, nil }
+func (r *recorder) Driver() driver.Driver                        { return nil }
+
+type recorderConn struct{ r *recorder }
+
+func (c *recorderConn) Prepare(query string) (driver.Stmt, error) {
+	return &recorderStmt{r: c.r, query: query}, nil
+}
+func (c *recorderConn) Close() error              { return nil }
+func (c *recorderConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *recorderConn) Commit() error             { return nil }
+func (c *recorderConn) Rollback() error           { return nil }
+
+type recorderStmt struct {
+	r     *recorder
+	query string
+}
+
+func (s *recorderStmt) Close() error  { return nil }
+func (s *recorderStmt) NumInput() int { return -1 }
+
+func (s *recorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.r.queries = append(s.r.queries, recordedQuery{SQL: s.query, Args: args})
+	return driver.RowsAffected(0), nil
+}
+
+func (s *recorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.r.queries = append(s.r.queries, recordedQuery{SQL: s.query, Args: args})
+	rows := &recorderRows{}
+	if s.r.respond != nil {
+		rows.columns, rows.rows = s.r.respond(s.query)
+	}
+	return rows, nil
+}
+
+type recorderRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *recorderRows) Columns() []string { return r.columns }
+func (r *recorderRows) Close() error      { return nil }
+
+func (r *recorderRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Repositories are what the services need from the storage. The model types are the Postgres (gorm)
+// implementation, ex: &Book{} is a BookRepository, and models/memory has an in-memory one for tests.
+//
+// Every method takes the transaction to run in, nil for none. It's nil for the in-memory implementation,
+// where Transactor.Transaction snapshots the store instead.
+
+type BookRepository interface {
+	CreateOrUpdateBook(book *Book) (string, error)
+	GetBook(bookId string) (*Book, error)
+	GetBooks(bookIds []string, tx *gorm.DB) (*[]Book, error)
+	GetBookByName(name string, tx *gorm.DB) (*Book, error)
+	GetAncestorIds(bookId string, tx *gorm.DB) ([]string, error)
+	LockBooks(bookIds []string, tx *gorm.DB) error
+}
+
+// BalanceRepository keeps the running balances of the books. ModifyBalance and AdjustBalances enforce the books'
+// balance policies, returning an InsufficientBalanceError if an OVERALL balance would go below what the policy allows.
+type BalanceRepository interface {
+	ModifyBalance(operation OperationRequest, tx *gorm.DB) error
+	AdjustBalances(bookId, assetId string, changes []BalanceChange, tx *gorm.DB) error
+	GetBalance(bookId, assetId, operationType string, tx *gorm.DB) (*[]BookBalance, error)
+	GetRollupBalance(bookId, assetId, operationType string, tx *gorm.DB) (*[]BookBalance, error)
+	GetBalanceAsOf(bookId, assetId, operationType string, asOf *time.Time, afterOperationId uint64, tx *gorm.DB) (*[]BookBalance, error)
+}
+
+// OperationRepository stores the operations, a memo is unique.
+type OperationRepository interface {
+	GetOperation(memo string, tx *gorm.DB) (*Operation, error)
+	GetOperationForUpdate(memo string, tx *gorm.DB) (*Operation, error)
+	GetOperations(filter OperationFilter, tx *gorm.DB) ([]Operation, error)
+	CreateOperation(operation Operation, tx *gorm.DB) (*Operation, error)
+	UpdateOperation(operation *Operation, tx *gorm.DB) error
+}
+
+type PostingRepository interface {
+	BulkCreatePosting(entries []Entry, tx *gorm.DB, operationId uint64, metadata datatypes.JSON) error
+}
+
+// AssetRepository stores the assets, a code is unique.
+type AssetRepository interface {
+	CreateOrUpdateAsset(asset *Asset) (string, error)
+	GetAsset(code string, tx *gorm.DB) (*Asset, error)
+	GetAssets(codes []string, tx *gorm.DB) (*[]Asset, error)
+	DeleteAsset(code string, tx *gorm.DB) (int64, error)
+	IsAssetInUse(code string, tx *gorm.DB) (bool, error)
+}
+
+// HoldRepository stores the holds, a memo is unique.
+type HoldRepository interface {
+	CreateHold(hold *Hold, tx *gorm.DB) error
+	GetHold(memo string, tx *gorm.DB) (*Hold, error)
+	GetHoldForUpdate(memo string, tx *gorm.DB) (*Hold, error)
+	UpdateHold(hold *Hold, tx *gorm.DB) error
+	GetExpiredHoldMemos(now time.Time, limit int, tx *gorm.DB) ([]string, error)
+}
+
+// OutboxRepository stores the outbox events, along with their delivery state and commit order sequence.
+type OutboxRepository interface {
+	CreateEvents(events []OutboxEvent, tx *gorm.DB) error
+	ClaimDueEvents(now time.Time, lease time.Duration, limit int, tx *gorm.DB) ([]OutboxEvent, error)
+	UpdateDelivery(event *OutboxEvent, tx *gorm.DB) error
+	SequenceEvents(limit int, tx *gorm.DB) (int, error)
+	GetBalanceEventsAfter(bookIds, assetIds []string, afterSequence uint64, limit int, tx *gorm.DB) ([]OutboxEvent, error)
+	GetLastSequence(tx *gorm.DB) (uint64, error)
+}
+
+// Transactor runs fn in a transaction, which is committed if fn returns nil, and rolled back otherwise.
+// With a non nil tx, it's a nested transaction (savepoint) of tx.
+type Transactor interface {
+	Transaction(tx *gorm.DB, fn func(tx *gorm.DB) error) error
+}
+
+// DBTransactor is the Postgres Transactor.
+type DBTransactor struct{}
+
+func (DBTransactor) Transaction(tx *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if tx != nil {
+		return tx.Transaction(fn)
+	}
+	return db.Transaction(fn)
+}
+
+var (
+	_ BookRepository      = &Book{}
+	_ BalanceRepository   = &BookBalance{}
+	_ OperationRepository = &Operation{}
+	_ PostingRepository   = &Posting{}
+	_ AssetRepository     = &Asset{}
+	_ HoldRepository      = &Hold{}
+	_ OutboxRepository    = &OutboxEvent{}
+	_ Transactor          = DBTransactor{}
+)
@@ -0,0 +1,124 @@
+// Package repositorytest has scenarios of the models repositories, run against each implementation of them:
+// models/memory in its tests, and Postgres in tests/integration-test.
+package repositorytest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"general_ledger_golang/models"
+)
+
+// Repositories are the implementations a scenario runs against.
+type Repositories struct {
+	Balances   models.BalanceRepository
+	Operations models.OperationRepository
+	Postings   models.PostingRepository
+	Holds      models.HoldRepository
+	Transactor models.Transactor
+}
+
+// BalanceAsOf funds bookId with 10 btc from counterBookId, holds 4 of it, captures 1.5 of the hold and releases
+// the rest, then checks GetBalanceAsOf at every step in between. bookId must have no postings or holds yet,
+// suffix is appended to the memos to keep them unique across runs.
+func BalanceAsOf(t *testing.T, r Repositories, bookId, counterBookId, suffix string) {
+	holdMemo := "hold-" + suffix
+
+	// step returns a time strictly between what was done before and what is done after it.
+	step := func() time.Time {
+		time.Sleep(5 * time.Millisecond)
+		at := time.Now()
+		time.Sleep(5 * time.Millisecond)
+		return at
+	}
+	run := func(name string, fn func(tx *gorm.DB) error) {
+		if err := r.Transactor.Transaction(nil, fn); err != nil {
+			t.Fatalf("%s failed, error: %v", name, err)
+		}
+	}
+	apply := func(memo, value string, metadata map[string]interface{}) uint64 {
+		entries := []models.Entry{
+			{BookId: bookId, AssetId: "btc", Value: decimal.RequireFromString(value)},
+			{BookId: counterBookId, AssetId: "btc", Value: decimal.RequireFromString(value).Neg()},
+		}
+		entriesJSON, _ := json.Marshal(entries)
+		metadataJSON, _ := json.Marshal(metadata)
+
+		var operationId uint64
+		run(memo, func(tx *gorm.DB) error {
+			operation, err := r.Operations.CreateOperation(models.Operation{
+				Type:     "TRANSFER",
+				Memo:     memo + "-" + suffix,
+				Entries:  entriesJSON,
+				Status:   string(models.OperationApplied),
+				Metadata: metadataJSON,
+			}, tx)
+			if err != nil {
+				return err
+			}
+			operationId = operation.Id
+			return r.Postings.BulkCreatePosting(entries, tx, operation.Id, metadataJSON)
+		})
+		return operationId
+	}
+
+	funding := apply("fund", "10", map[string]interface{}{"operation": "DEPOSIT"})
+	funded := step()
+
+	hold := &models.Hold{Memo: holdMemo, BookId: bookId, AssetId: "btc", Amount: decimal.RequireFromString("4"), Status: string(models.HoldHeld)}
+	run("hold", func(tx *gorm.DB) error { return r.Holds.CreateHold(hold, tx) })
+	held := step()
+
+	capture := apply("capture", "-1.5", map[string]interface{}{"operation": "CAPTURE", "holdMemo": holdMemo})
+	run("capture", func(tx *gorm.DB) error {
+		hold.CapturedAmount = decimal.RequireFromString("1.5")
+		hold.Status = string(models.HoldPartiallyCaptured)
+		return r.Holds.UpdateHold(hold, tx)
+	})
+	captured := step()
+
+	run("release", func(tx *gorm.DB) error {
+		hold.ReleasedAmount = hold.Remaining()
+		hold.Status = string(models.HoldReleased)
+		return r.Holds.UpdateHold(hold, tx)
+	})
+
+	for _, c := range []struct {
+		name             string
+		operationType    string
+		asOf             *time.Time
+		afterOperationId uint64
+		expected         string
+	}{
+		{"funded", models.OverallOperation, &funded, 0, "10"},
+		{"funded", models.HeldOperation, &funded, 0, "0"},
+		{"funded", "DEPOSIT", &funded, 0, "10"},
+		{"held", models.OverallOperation, &held, 0, "6"},
+		{"held", models.HeldOperation, &held, 0, "4"},
+		{"captured", models.OverallOperation, &captured, 0, "6"},
+		{"captured", models.HeldOperation, &captured, 0, "2.5"},
+		{"captured", "CAPTURE", &captured, 0, "-1.5"},
+		{"released", models.OverallOperation, nil, 0, "8.5"},
+		{"released", models.HeldOperation, nil, 0, "0"},
+		{"after funding", models.OverallOperation, nil, funding, "10"},
+		{"after funding", models.HeldOperation, nil, funding, "0"},
+		{"after capture", models.OverallOperation, nil, capture, "6"},
+		{"after capture", models.HeldOperation, nil, capture, "2.5"},
+	} {
+		balances, err := r.Balances.GetBalanceAsOf(bookId, "btc", c.operationType, c.asOf, c.afterOperationId, nil)
+		if err != nil {
+			t.Fatalf("%s: fetching the %s balance failed, error: %v", c.name, c.operationType, err)
+		}
+		actual := decimal.Zero
+		if balances != nil {
+			actual = (*balances)[0].Balance
+		}
+		if !actual.Equal(decimal.RequireFromString(c.expected)) {
+			t.Errorf("%s: %s balance is %s, expected %s", c.name, c.operationType, actual, c.expected)
+		}
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
 	"regexp"
 	"strings"
 
 	"github.com/joho/godotenv"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 
 	"general_ledger_golang/pkg/gotypes"
@@ -103,6 +105,36 @@ func ReplaceEnvInConfig(body []byte) []byte {
 	return replacedBody
 }
 
+// emptyStringToMapHookFunc decodes an empty string into an empty map, so that a map config
+// whose env is not set (ex: SERVICE_TOKEN_WHITELIST) doesn't fail the whole config.
+func emptyStringToMapHookFunc() mapstructure.DecodeHookFuncType {
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		if from.Kind() != reflect.String || to.Kind() != reflect.Map || reflect.ValueOf(data).String() != "" {
+			return data, nil
+		}
+		return reflect.MakeMap(to).Interface(), nil
+	}
+}
+
+// jsonStringToMapHookFunc decodes a json object string into a map, for maps whose values are not supported
+// by the json env parsing of Setup (ex: SERVICE_SCOPES, map of structs).
+func jsonStringToMapHookFunc() mapstructure.DecodeHookFuncType {
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		if from.Kind() != reflect.String || to.Kind() != reflect.Map {
+			return data, nil
+		}
+		valueStr := strings.TrimSpace(reflect.ValueOf(data).String())
+		if !strings.HasPrefix(valueStr, "{") {
+			return data, nil
+		}
+		value := reflect.New(to)
+		if err := json.Unmarshal([]byte(valueStr), value.Interface()); err != nil {
+			return nil, fmt.Errorf("could not parse %s as json into %s: %w", valueStr, to, err)
+		}
+		return value.Elem().Interface(), nil
+	}
+}
+
 func GetProjectRoot() string {
 	rootPath, _ := os.Getwd()
 	return rootPath
@@ -170,11 +202,20 @@ func Setup(configPath string) {
 
 		config.Set(key, envOrRaw)
 	}
-	if err = config.Unmarshal(&conf); err != nil {
+	decodeHook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		emptyStringToMapHookFunc(),
+		jsonStringToMapHookFunc(),
+	))
+	if err = config.Unmarshal(&conf, decodeHook); err != nil {
 		logger.Logger.Printf("Could not parse config, Error: %+v", err)
 		panic(err)
 	}
-	logger.Logger.Infof("serv conf: %+v\n", *conf.ServerSetting)
+	logger.Logger.Infof("serv conf: %s", conf.ServerSetting)
+	if len(conf.ServerSetting.ServiceTokenWhitelist) == 0 {
+		logger.Logger.Warn("ServiceTokenWhitelist is empty, every service token protected route and rpc will be rejected")
+	}
 }
 
 func SetupStub(projectRootRelativePath string, ConfigDirPathFromRoot string) {
@@ -194,3 +235,30 @@ func SetupStub(projectRootRelativePath string, ConfigDirPathFromRoot string) {
 func GetConfig() *Config {
 	return conf
 }
+
+// GetDatabaseSetting returns the database section of the config, falls back to defaults
+// if config is not set up (ex: unit tests) or the section is missing.
+func GetDatabaseSetting() *Database {
+	if conf == nil || conf.DatabaseSetting == nil {
+		return &Database{}
+	}
+	return conf.DatabaseSetting
+}
+
+// GetLedgerSetting returns the ledger section of the config, falls back to defaults
+// if config is not set up (ex: unit tests) or the section is missing.
+func GetLedgerSetting() *Ledger {
+	if conf == nil || conf.LedgerSetting == nil {
+		return &Ledger{}
+	}
+	return conf.LedgerSetting
+}
+
+// GetWebhookSetting returns the webhook section of the config, falls back to defaults
+// if config is not set up (ex: unit tests) or the section is missing.
+func GetWebhookSetting() *Webhook {
+	if conf == nil || conf.WebhookSetting == nil {
+		return &Webhook{}
+	}
+	return conf.WebhookSetting
+}
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -26,6 +29,42 @@ type Server struct {
 	// Example:
 	//		{"service_name":{"read":"abc","write":"cde"}}
 	ServiceTokenWhitelist map[string]map[string]string
+	// ServiceScopes limit what a service can do on top of its tokens, services not listed here are denied everything.
+	//
+	// Example:
+	//		{"user_module":{"permissions":["books:write","balances:read"]},
+	//		 "on_ramp":{"permissions":["operations:write"],"operationTypes":["DEPOSIT"],"requiredBookIds":["1"]}}
+	ServiceScopes map[string]ServiceScope
+}
+
+// String describes the server settings without the tokens of the ServiceTokenWhitelist, so that it can be logged.
+// Services are listed by name, along with the number of tokens they have.
+func (s Server) String() string {
+	var services []string
+	for service, tokens := range s.ServiceTokenWhitelist {
+		services = append(services, fmt.Sprintf("%s(%d tokens)", service, len(tokens)))
+	}
+	sort.Strings(services)
+	var scoped []string
+	for service := range s.ServiceScopes {
+		scoped = append(scoped, service)
+	}
+	sort.Strings(scoped)
+	return fmt.Sprintf("{RunMode:%s HttpPort:%d GrpcPort:%d ReadTimeout:%s WriteTimeout:%s Services:[%s] ScopedServices:[%s]}",
+		s.RunMode, s.HttpPort, s.GrpcPort, s.ReadTimeout, s.WriteTimeout, strings.Join(services, " "), strings.Join(scoped, " "))
+}
+
+// ServiceScope is what a service is allowed to do, an empty list doesn't limit that part, except for Permissions.
+type ServiceScope struct {
+	// Permissions are the routes and rpcs the service can call, ex: books:read, operations:write, `*` is every one.
+	// Empty is none.
+	Permissions []string `json:"permissions"`
+	// OperationTypes are the operation types (metadata["operation"]) of the operations the service can apply.
+	OperationTypes []string `json:"operationTypes"`
+	// BookIds are the books the service can read, and have entries on in the operations it applies.
+	BookIds []string `json:"bookIds"`
+	// RequiredBookIds, every operation the service applies should have an entry on at least one of these books.
+	RequiredBookIds []string `json:"requiredBookIds"`
 }
 
 // Database DB settings Section
@@ -38,6 +77,13 @@ type Database struct {
 	Name        string
 	TablePrefix string
 	SSLMode     string
+	// MaxRetries is how many times a transaction is retried after a transient failure
+	// (serialization failure, deadlock, lock not available), 0 disables the retries.
+	MaxRetries int
+	// RetryBaseDelay is the backoff before the first retry, it doubles with every retry up to RetryMaxDelay.
+	// The actual delay is jittered between 0 and the backoff.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
 }
 
 // Redis settings Section
@@ -48,9 +94,50 @@ type Redis struct {
 	IdleTimeout time.Duration
 }
 
+// Ledger accounting rules Section
+type Ledger struct {
+	// MintBurnOperationTypes are the operation types (metadata["operation"]) which are allowed to
+	// create or destroy money, i.e. their entries don't need to sum to zero for each asset.
+	//
+	// Example:
+	//		DEPOSIT,WITHDRAW
+	MintBurnOperationTypes []string
+	// ExcludedBalanceBookIds are the books whose balances are not kept in the book_balances table,
+	// matched by exact id. Empty tracks every book.
+	//
+	// Example:
+	//		1,-1,0
+	ExcludedBalanceBookIds []string
+	// HoldExpirySweepInterval is how often expired holds are released, 0 disables the sweeper.
+	HoldExpirySweepInterval time.Duration
+	// WatchPollInterval is how often a WatchBalances stream checks for new balance changes.
+	WatchPollInterval time.Duration
+}
+
+// Webhook delivery of the outbox events Section
+type Webhook struct {
+	// URLs every event is POSTed to, `,` separated. Empty disables the delivery, events are still written to the outbox.
+	URLs []string
+	// Secret signs the deliveries, X-Ledger-Signature is the hex HMAC-SHA256 of `<X-Ledger-Timestamp>.<body>`.
+	Secret string
+	// MaxAttempts is how many times a delivery is attempted before the event is marked DEAD.
+	MaxAttempts int
+	// BaseDelay is the backoff after the first failed attempt, it doubles with every attempt up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Timeout of a single delivery request.
+	Timeout time.Duration
+	// PollInterval is how often the outbox is checked for due events, 0 disables the dispatcher.
+	PollInterval time.Duration
+	// BatchSize is how many events are claimed per poll.
+	BatchSize int
+}
+
 type Config struct {
 	AppSetting      *App      `mapstructure:"app"`
 	ServerSetting   *Server   `mapstructure:"server"`
 	DatabaseSetting *Database `mapstructure:"database"`
 	RedisSetting    *Redis    `mapstructure:"redis"`
+	LedgerSetting   *Ledger   `mapstructure:"ledger"`
+	WebhookSetting  *Webhook  `mapstructure:"webhook"`
 }
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/jackc/pgconn"
+)
+
+// ErrorCode returns the postgres error code (SQLSTATE) of err, looking through wrapped errors.
+// Returns empty string if err is not a postgres error. Compare it with the codes in pgerrcode.go.
+func ErrorCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// ConstraintName returns the name of the constraint violated by err, empty string if there's none.
+func ConstraintName(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.ConstraintName
+	}
+	return ""
+}
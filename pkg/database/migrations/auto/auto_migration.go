@@ -1,10 +1,60 @@
 package auto
 
 import (
+	"gorm.io/gorm"
+
 	"general_ledger_golang/models"
 	"general_ledger_golang/pkg/logger"
 )
 
+// balancePolicyTrigger is pkg/database/migrations/manual/20261018_balance_policy_trigger.sql, it fails the commit of
+// a trx which decreased the OVERALL balance of a book below what its balance policy allows.
+const balancePolicyTrigger = `
+CREATE OR REPLACE FUNCTION check_balance_policy() RETURNS trigger AS $$
+DECLARE
+	new_balance numeric;
+	book_policy text;
+	book_limits jsonb;
+	lowest numeric := 0;
+BEGIN
+	-- only decreases of OVERALL are checked, a balance below its limit can still be topped up.
+	IF NEW."operationType" <> 'OVERALL' OR (TG_OP = 'UPDATE' AND NEW.balance >= OLD.balance) THEN
+		RETURN NULL;
+	END IF;
+	-- it runs at commit, the balance might have changed since.
+	SELECT balance INTO new_balance FROM book_balances
+	WHERE "bookId" = NEW."bookId" AND "assetId" = NEW."assetId" AND "operationType" = NEW."operationType";
+	IF new_balance IS NULL OR new_balance >= 0 THEN
+		RETURN NULL;
+	END IF;
+	IF NEW."bookId" ~ '^[0-9]+$' THEN
+		SELECT "balancePolicy", "overdraftLimits" INTO book_policy, book_limits FROM books WHERE id = NEW."bookId"::bigint;
+	END IF;
+	IF book_policy = 'ALLOW_NEGATIVE' THEN
+		RETURN NULL;
+	END IF;
+	IF book_policy = 'OVERDRAFT' THEN
+		lowest := -abs(COALESCE((book_limits ->> NEW."assetId")::numeric, 0));
+	END IF;
+	IF new_balance < lowest THEN
+		RAISE EXCEPTION 'book % % balance is %, below its % limit of %',
+			NEW."bookId", NEW."assetId", new_balance, COALESCE(book_policy, 'STRICT'), lowest
+			USING ERRCODE = 'check_violation', CONSTRAINT = 'balance_policy';
+	END IF;
+	RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'balance_policy') THEN
+		CREATE CONSTRAINT TRIGGER balance_policy AFTER INSERT OR UPDATE ON book_balances
+			DEFERRABLE INITIALLY DEFERRED FOR EACH ROW EXECUTE FUNCTION check_balance_policy();
+	END IF;
+END
+$$;
+`
+
 // Migrate will run migrations automatically, when server starts.
 //
 // In local, run migrations, once models are ready, get ddl from the
@@ -13,15 +63,49 @@ import (
 // Run that in prod. `Never run auto migration in prod.`
 func Migrate() {
 	db, _ := models.GetDB()
-	if err := db.AutoMigrate(models.Book{}, models.Operation{}, models.Posting{}, models.BookBalance{}); err != nil {
+	if err := db.AutoMigrate(models.Book{}, models.Operation{}, models.Posting{}, models.BookBalance{}, models.Asset{}, models.Hold{}, models.OutboxEvent{}); err != nil {
 		logger.Logger.Fatalf("Automigration failed, error: %+v", err) // fataF is printf followed by panic
 	}
-	if hasConstraint := db.Migrator().HasConstraint(&models.BookBalance{}, "non_negative_balance"); hasConstraint == false {
-		// create this constraint only if it doesn't exist, if any modification needed,
-		// drop and create the constraint as postgres doesn't have update constraint provision.
-		err := db.Migrator().CreateConstraint(&models.BookBalance{}, "non_negative_balance")
-		if err != nil {
-			logger.Logger.Fatalf("non_negative_balance check constraint add failed, error: %+v", err)
+	// balance policies of the books replaced the non_negative_balance check, which only exempted book 1.
+	// Book 1 gets ALLOW_NEGATIVE once, when the check is dropped, so that it keeps going negative.
+	if db.Migrator().HasConstraint(&models.BookBalance{}, "non_negative_balance") {
+		if err := db.Migrator().DropConstraint(&models.BookBalance{}, "non_negative_balance"); err != nil {
+			logger.Logger.Fatalf("non_negative_balance check constraint drop failed, error: %+v", err)
 		}
+		res := db.Model(&models.Book{}).Where("id = ?", 1).Update("balancePolicy", string(models.BalanceAllowNegative))
+		if res.Error != nil {
+			logger.Logger.Fatalf("Setting balance policy of book 1 failed, error: %+v", res.Error)
+		}
+	}
+	// the ledger checks the balance policies while applying operations and holds, the trigger checks them at commit
+	// for any other write of the balances too.
+	if err := db.Exec(balancePolicyTrigger).Error; err != nil {
+		logger.Logger.Fatalf("Creating the balance_policy trigger failed, error: %+v", err)
+	}
+	// on a fresh database, book 1 is the CashBook, which goes negative as money is brought into the ledger.
+	if err := db.Transaction(seedCashBook); err != nil {
+		logger.Logger.Fatalf("Seeding the CashBook failed, error: %+v", err)
+	}
+	// events from before the sequence column get their ids as sequences, so that watches resume where they were.
+	res := db.Exec(`UPDATE outbox SET sequence = id WHERE sequence IS NULL AND NOT EXISTS (SELECT 1 FROM outbox WHERE sequence IS NOT NULL)`)
+	if res.Error != nil {
+		logger.Logger.Fatalf("Sequencing existing outbox events failed, error: %+v", res.Error)
+	}
+}
+
+// seedCashBook creates the CashBook (ALLOW_NEGATIVE) with id 1 if there are no books yet.
+func seedCashBook(tx *gorm.DB) error {
+	var books int64
+	if err := tx.Model(&models.Book{}).Count(&books).Error; err != nil {
+		return err
+	}
+	if books > 0 {
+		return nil
+	}
+	cashBook := models.Book{Model: models.Model{Id: 1}, Name: "CashBook", BalancePolicy: string(models.BalanceAllowNegative)}
+	if err := tx.Create(&cashBook).Error; err != nil {
+		return err
 	}
+	// the id is set explicitly, the next book should get the next one.
+	return tx.Exec(`SELECT setval(pg_get_serial_sequence('books', 'id'), (SELECT MAX(id) FROM books))`).Error
 }
@@ -0,0 +1,45 @@
+-- The balance policies of the books are checked by the ledger while applying operations and holds, this trigger
+-- checks them at commit for every other write of book_balances (repairs, manual queries).
+CREATE OR REPLACE FUNCTION check_balance_policy() RETURNS trigger AS $$
+DECLARE
+	new_balance numeric;
+	book_policy text;
+	book_limits jsonb;
+	lowest numeric := 0;
+BEGIN
+	-- only decreases of OVERALL are checked, a balance below its limit can still be topped up.
+	IF NEW."operationType" <> 'OVERALL' OR (TG_OP = 'UPDATE' AND NEW.balance >= OLD.balance) THEN
+		RETURN NULL;
+	END IF;
+	-- it runs at commit, the balance might have changed since.
+	SELECT balance INTO new_balance FROM book_balances
+	WHERE "bookId" = NEW."bookId" AND "assetId" = NEW."assetId" AND "operationType" = NEW."operationType";
+	IF new_balance IS NULL OR new_balance >= 0 THEN
+		RETURN NULL;
+	END IF;
+	IF NEW."bookId" ~ '^[0-9]+$' THEN
+		SELECT "balancePolicy", "overdraftLimits" INTO book_policy, book_limits FROM books WHERE id = NEW."bookId"::bigint;
+	END IF;
+	IF book_policy = 'ALLOW_NEGATIVE' THEN
+		RETURN NULL;
+	END IF;
+	IF book_policy = 'OVERDRAFT' THEN
+		lowest := -abs(COALESCE((book_limits ->> NEW."assetId")::numeric, 0));
+	END IF;
+	IF new_balance < lowest THEN
+		RAISE EXCEPTION 'book % % balance is %, below its % limit of %',
+			NEW."bookId", NEW."assetId", new_balance, COALESCE(book_policy, 'STRICT'), lowest
+			USING ERRCODE = 'check_violation', CONSTRAINT = 'balance_policy';
+	END IF;
+	RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'balance_policy') THEN
+		CREATE CONSTRAINT TRIGGER balance_policy AFTER INSERT OR UPDATE ON book_balances
+			DEFERRABLE INITIALLY DEFERRED FOR EACH ROW EXECUTE FUNCTION check_balance_policy();
+	END IF;
+END
+$$;
@@ -0,0 +1,8 @@
+-- Balance policies of the books replace the non_negative_balance check of book_balances.
+ALTER TABLE books ADD COLUMN IF NOT EXISTS "balancePolicy" text DEFAULT 'STRICT';
+ALTER TABLE books ADD COLUMN IF NOT EXISTS "overdraftLimits" jsonb;
+
+-- the check only exempted book 1 (CashBook), it keeps going negative with ALLOW_NEGATIVE.
+UPDATE books SET "balancePolicy" = 'ALLOW_NEGATIVE' WHERE id = 1;
+
+ALTER TABLE book_balances DROP CONSTRAINT IF EXISTS non_negative_balance;
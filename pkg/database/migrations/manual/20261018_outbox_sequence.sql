@@ -0,0 +1,6 @@
+-- The commit order sequence of the outbox events, balance watches stream in it instead of ids.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS sequence bigint;
+CREATE INDEX IF NOT EXISTS idx_outbox_sequence ON outbox (sequence);
+
+-- events from before it get their ids as sequences, so that watches resume where they were.
+UPDATE outbox SET sequence = id WHERE sequence IS NULL AND NOT EXISTS (SELECT 1 FROM outbox WHERE sequence IS NOT NULL);
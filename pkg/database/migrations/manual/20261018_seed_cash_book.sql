@@ -0,0 +1,6 @@
+-- On a fresh database, book 1 is the CashBook, which goes negative as money is brought into the ledger.
+INSERT INTO books (id, name, "balancePolicy", "createdAt", "updatedAt")
+SELECT 1, 'CashBook', 'ALLOW_NEGATIVE', now(), now() WHERE NOT EXISTS (SELECT 1 FROM books);
+
+-- the id is set explicitly, the next book should get the next one.
+SELECT setval(pg_get_serial_sequence('books', 'id'), (SELECT MAX(id) FROM books)) WHERE EXISTS (SELECT 1 FROM books);
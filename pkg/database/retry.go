@@ -0,0 +1,88 @@
+package database
+
+import (
+	"expvar"
+	"math/rand"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"general_ledger_golang/pkg/config"
+	"general_ledger_golang/pkg/logger"
+)
+
+var (
+	// retries and exhaustedRetries count, per transaction name and error code (ex: "ApplyOperation.40001"),
+	// the retries done and the transactions that failed even after all the retries. Served at /debug/vars.
+	retries          = expvar.NewMap("db_tx_retries")
+	exhaustedRetries = expvar.NewMap("db_tx_retries_exhausted")
+)
+
+// RetryPolicy retries a transaction which failed for a transient reason, with jittered exponential backoff.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// GetRetryPolicy returns the retry policy configured in the database section of the config.
+func GetRetryPolicy() RetryPolicy {
+	setting := config.GetDatabaseSetting()
+	return RetryPolicy{
+		MaxRetries: setting.MaxRetries,
+		BaseDelay:  setting.RetryBaseDelay,
+		MaxDelay:   setting.RetryMaxDelay,
+	}
+}
+
+// IsRetryable tells if err is a transient failure, after which the whole transaction can be retried as is.
+func IsRetryable(err error) bool {
+	switch ErrorCode(err) {
+	case SerializationFailure, DeadlockDetected, LockNotAvailable:
+		return true
+	}
+	return false
+}
+
+// Backoff returns the delay before the given retry (0 based), a random duration
+// between 0 and BaseDelay * 2^retry, capped at MaxDelay.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := p.BaseDelay
+	for i := 0; i < retry && (p.MaxDelay <= 0 || backoff < p.MaxDelay); i++ {
+		backoff *= 2
+	}
+	if p.MaxDelay > 0 && backoff > p.MaxDelay {
+		backoff = p.MaxDelay
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// Run calls fn, which should run a whole transaction, and calls it again as long as it fails
+// with a retryable error, up to MaxRetries times. name identifies the transaction in logs and metrics.
+func (p RetryPolicy) Run(name string, fn func() error) error {
+	for retry := 0; ; retry++ {
+		err := fn()
+		if err == nil || !IsRetryable(err) {
+			if retry > 0 {
+				logger.Logger.WithFields(logrus.Fields{"tx": name, "retries": retry}).Infof("Transaction finished after retries, error: %v", err)
+			}
+			return err
+		}
+
+		code := ErrorCode(err)
+		log := logger.Logger.WithFields(logrus.Fields{"tx": name, "retries": retry, "code": code})
+		if retry >= p.MaxRetries {
+			exhaustedRetries.Add(name+"."+code, 1)
+			log.Errorf("Transaction failed, retries are exhausted, error: %+v", err)
+			return err
+		}
+
+		delay := p.Backoff(retry)
+		retries.Add(name+"."+code, 1)
+		log.Warnf("Transaction failed with a retryable error, retrying in %s, error: %v", delay, err)
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	asrt "github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	assert := asrt.New(t)
+
+	assert.True(IsRetryable(&pgconn.PgError{Code: SerializationFailure}))
+	assert.True(IsRetryable(fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: DeadlockDetected})))
+	assert.True(IsRetryable(&pgconn.PgError{Code: LockNotAvailable}))
+	assert.False(IsRetryable(&pgconn.PgError{Code: CheckViolation}))
+	assert.False(IsRetryable(errors.New("not a db error")))
+	assert.False(IsRetryable(nil))
+}
+
+func TestRetryPolicyRun(t *testing.T) {
+	assert := asrt.New(t)
+	policy := RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+
+	// succeeds on the last retry
+	calls := 0
+	err := policy.Run("test", func() error {
+		calls++
+		if calls < 3 {
+			return &pgconn.PgError{Code: SerializationFailure}
+		}
+		return nil
+	})
+	assert.Nil(err)
+	assert.Equal(3, calls)
+
+	// retries are exhausted
+	calls = 0
+	err = policy.Run("test", func() error {
+		calls++
+		return &pgconn.PgError{Code: DeadlockDetected}
+	})
+	assert.Equal(DeadlockDetected, ErrorCode(err))
+	assert.Equal(3, calls)
+
+	// not retryable, no retry
+	calls = 0
+	err = policy.Run("test", func() error {
+		calls++
+		return &pgconn.PgError{Code: CheckViolation}
+	})
+	assert.NotNil(err)
+	assert.Equal(1, calls)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	assert := asrt.New(t)
+	policy := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+	for retry := 0; retry < 10; retry++ {
+		delay := policy.Backoff(retry)
+		assert.GreaterOrEqual(delay, time.Duration(0))
+		assert.LessOrEqual(delay, 50*time.Millisecond)
+	}
+	assert.Equal(time.Duration(0), RetryPolicy{}.Backoff(3))
+}
@@ -5,11 +5,14 @@ const (
 	INVALID_PARAMS      = 400
 	BAD_REQUEST         = 400
 	MISSING_AUTH_HEADER = 401
+	FORBIDDEN           = 403
 	NOT_EXIST           = 404
+	CONFLICT            = 409
 	ERROR               = 500
 
-	DEBIT  = 10500
-	CREDIT = 10501
+	DEBIT              = 10500
+	CREDIT             = 10501
+	INSUFFICIENT_FUNDS = 10502
 
 	ERROR_AUTH_CHECK_TOKEN_FAIL    = 20001
 	ERROR_AUTH_CHECK_TOKEN_TIMEOUT = 20002
@@ -55,6 +55,57 @@ func GrpcRecordNotFound(message string, method string, metadata map[string]strin
 	}
 	return st.Err()
 }
+func GrpcFailedPrecondition(message string, method string, metadata map[string]string) error {
+	st := status.New(codes.FailedPrecondition, message)
+
+	ei := &errdetails.ErrorInfo{
+		Reason:   message,
+		Domain:   method,
+		Metadata: metadata,
+	}
+	st, err := st.WithDetails(ei)
+	if err != nil {
+		// If this errored, it will always error
+		// here, so better panic so we can figure
+		// out why than have this silently passing.
+		panic(fmt.Sprintf("Unexpected error: %v", err))
+	}
+	return st.Err()
+}
+func GrpcAlreadyExists(message string, method string, metadata map[string]string) error {
+	st := status.New(codes.AlreadyExists, message)
+
+	ei := &errdetails.ErrorInfo{
+		Reason:   message,
+		Domain:   method,
+		Metadata: metadata,
+	}
+	st, err := st.WithDetails(ei)
+	if err != nil {
+		// If this errored, it will always error
+		// here, so better panic so we can figure
+		// out why than have this silently passing.
+		panic(fmt.Sprintf("Unexpected error: %v", err))
+	}
+	return st.Err()
+}
+func GrpcPermissionDenied(message string, method string, metadata map[string]string) error {
+	st := status.New(codes.PermissionDenied, message)
+
+	ei := &errdetails.ErrorInfo{
+		Reason:   message,
+		Domain:   method,
+		Metadata: metadata,
+	}
+	st, err := st.WithDetails(ei)
+	if err != nil {
+		// If this errored, it will always error
+		// here, so better panic so we can figure
+		// out why than have this silently passing.
+		panic(fmt.Sprintf("Unexpected error: %v", err))
+	}
+	return st.Err()
+}
 
 //func FormGrpcError(code codes.Code, message string) *status.Status {
 //	st := status.New(code, "invalid username")
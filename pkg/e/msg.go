@@ -4,8 +4,12 @@ var MsgFlags = map[int]string{
 	SUCCESS:             "SUCCESS",
 	DEBIT:               "DEBIT",
 	CREDIT:              "CREDIT",
+	INSUFFICIENT_FUNDS:  "INSUFFICIENT_FUNDS",
 	NOT_EXIST:           "NOT_EXIST",
+	CONFLICT:            "CONFLICT",
 	MISSING_AUTH_HEADER: "MISSING_AUTH_HEADER",
+	ERROR_AUTH_TOKEN:    "ERROR_AUTH_TOKEN",
+	FORBIDDEN:           "FORBIDDEN",
 	INVALID_PARAMS:      "INVALID_PARAMS",
 	ERROR:               "Something Went Wrong, we're checking",
 }
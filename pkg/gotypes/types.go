@@ -134,11 +134,11 @@ func IsMapString(data string) bool {
 }
 
 func IsMapMapString(data string) bool {
-	if isMapOfMap(data) || isJSONMap(data, reflect.Map) {
+	if isMapOfMap(data) || isJSONMapOfMap(data, reflect.String) {
 		return true
 	}
 
-	if !isMapOfMap(data) && !isJSONMap(data, reflect.Map) {
+	if !isMapOfMap(data) && !isJSONMapOfMap(data, reflect.String) {
 		return false
 	}
 
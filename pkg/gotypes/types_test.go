@@ -65,6 +65,14 @@ func TestMapString(t *testing.T) {
 				t.Errorf("K is a map of map of string")
 			}
 		})
+
+		t.Run("Map of map but the inner map has lists", func(t *testing.T) {
+			k := `{"user_module":{"permissions":["books:write"]}}`
+			r := IsMapMapString(k)
+			if r != false {
+				t.Errorf("K is a map of map of lists, not a map of map of string")
+			}
+		})
 	})
 }
 
@@ -1,10 +1,13 @@
 package util
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -47,11 +50,13 @@ func ParseReqBodyToMap(reqBody io.ReadCloser) map[string]interface{} {
 	return x
 }
 
+// GetReqBodyFromCtx decodes the request body read by the UseRequestBody middleware, nil if it's not a json object.
+// Numbers are json.Number, so that ids and amounts keep all their digits (a float64 doesn't, past 2^53).
 func GetReqBodyFromCtx(c *gin.Context) map[string]interface{} {
 	x := map[string]interface{}{}
 
 	bodyBytes := c.MustGet("requestBodyBytes")
-	err := json.Unmarshal(bodyBytes.([]byte), &x)
+	err := UnmarshalUseNumber(bodyBytes.([]byte), &x)
 
 	if err != nil {
 		fmt.Printf("Req.Body parsing failed inside GetReqBodyFromCtx, error: %+v\n", err)
@@ -61,6 +66,19 @@ func GetReqBodyFromCtx(c *gin.Context) map[string]interface{} {
 	return x
 }
 
+// UnmarshalUseNumber is json.Unmarshal, except that numbers in interface{} values are json.Number instead of float64.
+func UnmarshalUseNumber(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after the json value")
+	}
+	return nil
+}
+
 func StructToJSON(m interface{}) map[string]interface{} {
 	resultStr, _ := json.Marshal(m)
 	var result map[string]interface{}
@@ -171,3 +189,30 @@ func ConvertToMapSlice(i interface{}) ([]interface{}, error) {
 	}
 	return v, nil
 }
+
+// ParseOptionalTime parses a RFC3339 timestamp, ex: 2023-10-17T07:41:55Z. Empty value is nil, not an error.
+func ParseOptionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ParseCursor parses a cursor of the paginated lists (statements, operations), the id of the last item of the
+// previous page. Empty cursor is the first page.
+func ParseCursor(cursor string) (uint64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: cursor %s is not valid", ErrInvalidCursor, cursor)
+	}
+	return id, nil
+}
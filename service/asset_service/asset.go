@@ -0,0 +1,116 @@
+package asset_service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+
+	"general_ledger_golang/models"
+)
+
+var (
+	ErrInvalidAsset  = errors.New("invalid asset")
+	ErrAssetNotFound = errors.New("asset not found")
+	ErrAssetInUse    = errors.New("asset is already moved by operations, it can't be deleted")
+)
+
+// AssetService works on the Postgres repository, unless another one (ex: models/memory) is set.
+type AssetService struct {
+	AssetRepository models.AssetRepository
+}
+
+func (a *AssetService) assets() models.AssetRepository {
+	if a.AssetRepository == nil {
+		return &models.Asset{}
+	}
+	return a.AssetRepository
+}
+
+// CreateOrUpdateAsset creates the asset if the code doesn't exist, else updates it.
+func (a *AssetService) CreateOrUpdateAsset(asset *models.Asset) (*models.Asset, string, error) {
+	if err := validateAsset(asset); err != nil {
+		return nil, "", err
+	}
+
+	operation, err := a.assets().CreateOrUpdateAsset(asset)
+	if err != nil {
+		return nil, "", err
+	}
+
+	saved, err := a.assets().GetAsset(asset.Code, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return saved, operation, nil
+}
+
+func (a *AssetService) GetAsset(code string) (*models.Asset, error) {
+	if code == "" {
+		return nil, fmt.Errorf("%w: code is empty", ErrInvalidAsset)
+	}
+	return a.assets().GetAsset(code, nil)
+}
+
+func (a *AssetService) GetAssets() ([]models.Asset, error) {
+	assets, err := a.assets().GetAssets(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if assets == nil {
+		return []models.Asset{}, nil
+	}
+	return *assets, nil
+}
+
+// DeleteAsset deletes an asset, only if no operation has moved it yet.
+func (a *AssetService) DeleteAsset(code string) error {
+	inUse, err := a.assets().IsAssetInUse(code, nil)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrAssetInUse
+	}
+
+	deleted, err := a.assets().DeleteAsset(code, nil)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrAssetNotFound
+	}
+	return nil
+}
+
+func validateAsset(asset *models.Asset) error {
+	if asset.Code == "" {
+		return fmt.Errorf("%w: code is required", ErrInvalidAsset)
+	}
+	if asset.Scale < 0 || asset.Scale > models.MaxAssetScale {
+		return fmt.Errorf("%w: scale should be between 0 and %d", ErrInvalidAsset, models.MaxAssetScale)
+	}
+	limits := []struct {
+		name   string
+		amount decimal.NullDecimal
+	}{
+		{"minTransferAmount", asset.MinTransferAmount},
+		{"maxTransferAmount", asset.MaxTransferAmount},
+	}
+	for _, limit := range limits {
+		if !limit.amount.Valid {
+			continue
+		}
+		if limit.amount.Decimal.IsNegative() {
+			return fmt.Errorf("%w: %s can't be negative", ErrInvalidAsset, limit.name)
+		}
+		if !limit.amount.Decimal.Round(asset.Scale).Equal(limit.amount.Decimal) {
+			return fmt.Errorf("%w: %s has more than %d decimal places", ErrInvalidAsset, limit.name, asset.Scale)
+		}
+	}
+	if asset.MinTransferAmount.Valid && asset.MaxTransferAmount.Valid &&
+		asset.MinTransferAmount.Decimal.GreaterThan(asset.MaxTransferAmount.Decimal) {
+		return fmt.Errorf("%w: minTransferAmount can't be greater than maxTransferAmount", ErrInvalidAsset)
+	}
+	return nil
+}
@@ -1,6 +1,16 @@
 package auth_service
 
-import "general_ledger_golang/pkg/config"
+import (
+	"strings"
+
+	"general_ledger_golang/pkg/config"
+)
+
+// Headers (http) and metadata keys (grpc) carrying the calling service's name and token.
+const (
+	ServiceNameHeader  = "x-service-name"
+	ServiceTokenHeader = "x-service-token"
+)
 
 type Auth struct {
 	ServiceName  string
@@ -21,23 +31,39 @@ var (
 	WRITE CheckType = "WRITE"
 )
 
+// Check tells if token is serviceName's token for checkType in the ServiceTokenWhitelist, a write token can read as well.
+// The token kinds of the whitelist are case-insensitive, `{"user_module":{"read":"abc","write":"cde"}}` works.
+// An empty token, or a missing config, is never allowed.
 func (a *Auth) Check(token string, checkType CheckType, serviceName string) bool {
 	conf := config.GetConfig()
+	if conf == nil || conf.ServerSetting == nil || token == "" {
+		return false
+	}
 	allowedTokens := conf.ServerSetting.ServiceTokenWhitelist
 
 	for service := range allowedTokens {
 		RWToken := allowedTokens[service]
 		if serviceName == service {
-			allowedToken := RWToken[checkType.String()]
+			allowedToken := tokenOf(RWToken, checkType)
 			// If you provide write token and ask to read, allowed
-			if checkType == READ && RWToken[WRITE.String()] == token {
+			if checkType == READ && tokenOf(RWToken, WRITE) == token {
 				return true
 			}
 			// else, write token writes, read token reads.
-			if token == allowedToken {
+			if allowedToken != "" && token == allowedToken {
 				return true
 			}
 		}
 	}
 	return false
 }
+
+// tokenOf returns the token of checkType, matching the kind case-insensitively, empty if there's none.
+func tokenOf(RWToken map[string]string, checkType CheckType) string {
+	for kind, token := range RWToken {
+		if strings.EqualFold(kind, checkType.String()) {
+			return token
+		}
+	}
+	return ""
+}
@@ -0,0 +1,221 @@
+package auth_service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/thoas/go-funk"
+
+	"general_ledger_golang/pkg/config"
+	"general_ledger_golang/pkg/logger"
+)
+
+// Permission is a kind of route or rpc a service can call, `<resource>:<read|write>`.
+type Permission string
+
+const (
+	BooksRead       Permission = "books:read"
+	BooksWrite      Permission = "books:write"
+	BalancesRead    Permission = "balances:read"
+	PostingsRead    Permission = "postings:read"
+	OperationsRead  Permission = "operations:read"
+	OperationsWrite Permission = "operations:write"
+	AssetsRead      Permission = "assets:read"
+	AssetsWrite     Permission = "assets:write"
+	HoldsRead       Permission = "holds:read"
+	HoldsWrite      Permission = "holds:write"
+	ReportsRead     Permission = "reports:read"
+	// BooksPolicy sets the balance policy and overdraft limits of books, it's admin only, `*` doesn't allow it.
+	BooksPolicy Permission = "books:policy"
+	// AllPermissions in a scope allows every permission, except the admin ones.
+	AllPermissions Permission = "*"
+)
+
+// adminPermissions are allowed only if the scope lists them.
+var adminPermissions = []Permission{BooksPolicy}
+
+var ErrForbidden = errors.New("forbidden")
+
+// CheckType is the token kind the permission needs, a read token for `:read` permissions, a write token otherwise.
+func (p Permission) CheckType() CheckType {
+	if strings.HasSuffix(string(p), ":read") {
+		return READ
+	}
+	return WRITE
+}
+
+// scopeOf returns the ServiceScopes entry of the service, false if it has none.
+func scopeOf(serviceName string) (config.ServiceScope, bool) {
+	conf := config.GetConfig()
+	if conf == nil || conf.ServerSetting == nil {
+		return config.ServiceScope{}, false
+	}
+	scope, ok := conf.ServerSetting.ServiceScopes[serviceName]
+	return scope, ok
+}
+
+// scope returns the ServiceScopes entry of the calling service, a service without one is denied everything.
+func (a *Auth) scope() (config.ServiceScope, error) {
+	scope, ok := scopeOf(a.ServiceName)
+	if !ok {
+		return scope, fmt.Errorf("%w: service %s has no scope in ServiceScopes", ErrForbidden, a.ServiceName)
+	}
+	return scope, nil
+}
+
+// Authorize checks if the service's scope has the permission.
+// An empty ServiceName is the ledger itself, it's never limited, same for every check below.
+func (a *Auth) Authorize(permission Permission) error {
+	if a.ServiceName == "" {
+		return nil
+	}
+	scope, err := a.scope()
+	if err != nil {
+		return a.denied(err)
+	}
+	return a.denied(checkPermission(scope, permission))
+}
+
+// AuthorizeBook checks if the service's scope has the permission, on bookId.
+func (a *Auth) AuthorizeBook(permission Permission, bookId string) error {
+	return a.AuthorizeBooks(permission, []string{bookId})
+}
+
+// AuthorizeBooks checks if the service's scope has the permission, on every one of bookIds.
+func (a *Auth) AuthorizeBooks(permission Permission, bookIds []string) error {
+	if a.ServiceName == "" {
+		return nil
+	}
+	scope, err := a.scope()
+	if err != nil {
+		return a.denied(err)
+	}
+	if err := checkPermission(scope, permission); err != nil {
+		return a.denied(err)
+	}
+	return a.denied(checkBooks(scope, bookIds))
+}
+
+// AuthorizeAllBooks checks if the service's scope has the permission, across all the books (ex: reports),
+// services limited to bookIds are denied.
+func (a *Auth) AuthorizeAllBooks(permission Permission) error {
+	if a.ServiceName == "" {
+		return nil
+	}
+	scope, err := a.scope()
+	if err != nil {
+		return a.denied(err)
+	}
+	if err := checkPermission(scope, permission); err != nil {
+		return a.denied(err)
+	}
+	return a.denied(checkAllBooks(scope, permission))
+}
+
+// AuthorizeOperation checks if the service's scope allows applying an operation of operationType
+// (metadata["operation"]) with entries on bookIds.
+func (a *Auth) AuthorizeOperation(operationType string, bookIds []string) error {
+	if a.ServiceName == "" {
+		return nil
+	}
+	scope, err := a.scope()
+	if err != nil {
+		return a.denied(err)
+	}
+	return a.denied(checkOperation(scope, operationType, bookIds))
+}
+
+// denied logs the denied attempt, if err is not nil, and returns err.
+func (a *Auth) denied(err error) error {
+	if err != nil {
+		logger.Logger.Warnf("Denied service %q: %v", a.ServiceName, err)
+	}
+	return err
+}
+
+// checkPermission allows the permissions listed in the scope, all but the admin ones with `*`, none if the list is empty.
+func checkPermission(scope config.ServiceScope, permission Permission) error {
+	if funk.ContainsString(scope.Permissions, string(permission)) {
+		return nil
+	}
+	if funk.ContainsString(scope.Permissions, string(AllPermissions)) && !funk.Contains(adminPermissions, permission) {
+		return nil
+	}
+	return fmt.Errorf("%w: no %s permission", ErrForbidden, permission)
+}
+
+func checkBooks(scope config.ServiceScope, bookIds []string) error {
+	if len(scope.BookIds) == 0 {
+		return nil
+	}
+	for _, bookId := range bookIds {
+		if !funk.ContainsString(scope.BookIds, bookId) {
+			return fmt.Errorf("%w: book %s is out of scope", ErrForbidden, bookId)
+		}
+	}
+	return nil
+}
+
+func checkAllBooks(scope config.ServiceScope, permission Permission) error {
+	if len(scope.BookIds) > 0 {
+		return fmt.Errorf("%w: limited to books %s, no %s across the books", ErrForbidden, strings.Join(scope.BookIds, ","), permission)
+	}
+	return nil
+}
+
+func checkOperation(scope config.ServiceScope, operationType string, bookIds []string) error {
+	if err := checkPermission(scope, OperationsWrite); err != nil {
+		return err
+	}
+	if len(scope.OperationTypes) > 0 && !funk.ContainsString(scope.OperationTypes, operationType) {
+		return fmt.Errorf("%w: operation type %q is out of scope", ErrForbidden, operationType)
+	}
+	if err := checkBooks(scope, bookIds); err != nil {
+		return err
+	}
+	if len(scope.RequiredBookIds) > 0 && len(funk.IntersectString(scope.RequiredBookIds, bookIds)) == 0 {
+		return fmt.Errorf("%w: operation should have an entry on one of the books %s", ErrForbidden, strings.Join(scope.RequiredBookIds, ","))
+	}
+	return nil
+}
+
+// LogPolicy logs what each service of the ServiceTokenWhitelist and ServiceScopes is allowed to do, at startup.
+func LogPolicy() {
+	conf := config.GetConfig()
+	if conf == nil || conf.ServerSetting == nil {
+		return
+	}
+	var services []string
+	for service := range conf.ServerSetting.ServiceTokenWhitelist {
+		services = append(services, service)
+	}
+	for service := range conf.ServerSetting.ServiceScopes {
+		services = append(services, service)
+	}
+	services = funk.UniqString(services)
+	sort.Strings(services)
+
+	for _, service := range services {
+		scope, ok := scopeOf(service)
+		if !ok {
+			logger.Logger.Warnf("Service %q has no scope in ServiceScopes, it's denied everything", service)
+			continue
+		}
+		if _, ok = conf.ServerSetting.ServiceTokenWhitelist[service]; !ok {
+			logger.Logger.Warnf("Service %q has no tokens in ServiceTokenWhitelist, it can't call anything", service)
+			continue
+		}
+		logger.Logger.Infof("Service %q policy: permissions: %s, operationTypes: %s, bookIds: %s, requiredBookIds: %s", service,
+			listOr(scope.Permissions, "none"), listOr(scope.OperationTypes, "any"), listOr(scope.BookIds, "any"), listOr(scope.RequiredBookIds, "any"))
+	}
+}
+
+// listOr joins the list, empty is what an empty list means.
+func listOr(list []string, empty string) string {
+	if len(list) == 0 {
+		return empty
+	}
+	return strings.Join(list, ",")
+}
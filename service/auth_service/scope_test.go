@@ -0,0 +1,83 @@
+package auth_service
+
+import (
+	"errors"
+	"testing"
+
+	asrt "github.com/stretchr/testify/assert"
+
+	"general_ledger_golang/pkg/config"
+)
+
+func TestPermissionCheckType(t *testing.T) {
+	assert := asrt.New(t)
+
+	assert.Equal(READ, BalancesRead.CheckType())
+	assert.Equal(WRITE, BooksWrite.CheckType())
+	assert.Equal(WRITE, AllPermissions.CheckType())
+}
+
+func TestCheckPermission(t *testing.T) {
+	assert := asrt.New(t)
+
+	userModule := config.ServiceScope{Permissions: []string{"books:write", "balances:read"}}
+	assert.NoError(checkPermission(userModule, BooksWrite))
+	assert.NoError(checkPermission(userModule, BalancesRead))
+	assert.True(errors.Is(checkPermission(userModule, OperationsWrite), ErrForbidden))
+	assert.True(errors.Is(checkPermission(userModule, BooksRead), ErrForbidden))
+
+	// an empty list is no permission at all.
+	assert.True(errors.Is(checkPermission(config.ServiceScope{}, OperationsWrite), ErrForbidden))
+	assert.True(errors.Is(checkPermission(config.ServiceScope{BookIds: []string{"3"}}, BooksRead), ErrForbidden))
+	assert.NoError(checkPermission(config.ServiceScope{Permissions: []string{"*"}}, OperationsWrite))
+
+	// admin permissions have to be listed.
+	assert.True(errors.Is(checkPermission(config.ServiceScope{Permissions: []string{"*"}}, BooksPolicy), ErrForbidden))
+	assert.NoError(checkPermission(config.ServiceScope{Permissions: []string{"books:write", "books:policy"}}, BooksPolicy))
+}
+
+func TestCheckOperation(t *testing.T) {
+	assert := asrt.New(t)
+
+	tradingEngine := config.ServiceScope{Permissions: []string{"operations:write"}, OperationTypes: []string{"TRADE", "BLOCK"}}
+	assert.NoError(checkOperation(tradingEngine, "TRADE", []string{"3", "4"}))
+	assert.True(errors.Is(checkOperation(tradingEngine, "DEPOSIT", []string{"1", "4"}), ErrForbidden))
+	assert.True(errors.Is(checkOperation(tradingEngine, "", []string{"3", "4"}), ErrForbidden))
+
+	onRamp := config.ServiceScope{Permissions: []string{"*"}, OperationTypes: []string{"DEPOSIT"}, RequiredBookIds: []string{"1"}}
+	assert.NoError(checkOperation(onRamp, "DEPOSIT", []string{"1", "4"}))
+	assert.True(errors.Is(checkOperation(onRamp, "DEPOSIT", []string{"3", "4"}), ErrForbidden))
+
+	userModule := config.ServiceScope{Permissions: []string{"books:write", "balances:read"}}
+	assert.True(errors.Is(checkOperation(userModule, "DEPOSIT", []string{"1", "4"}), ErrForbidden))
+
+	desk := config.ServiceScope{Permissions: []string{"operations:write"}, BookIds: []string{"3", "4"}}
+	assert.NoError(checkOperation(desk, "TRADE", []string{"3", "4"}))
+	assert.True(errors.Is(checkOperation(desk, "TRADE", []string{"3", "5"}), ErrForbidden))
+	assert.NoError(checkBooks(desk, []string{"4"}))
+	assert.True(errors.Is(checkBooks(desk, []string{"44"}), ErrForbidden))
+}
+
+func TestCheckAllBooks(t *testing.T) {
+	assert := asrt.New(t)
+
+	assert.NoError(checkAllBooks(config.ServiceScope{Permissions: []string{"reports:read"}}, ReportsRead))
+	desk := config.ServiceScope{BookIds: []string{"3", "4"}}
+	assert.True(errors.Is(checkAllBooks(desk, ReportsRead), ErrForbidden))
+	assert.True(errors.Is(checkAllBooks(desk, OperationsRead), ErrForbidden))
+}
+
+func TestAuthorizeWithoutScope(t *testing.T) {
+	assert := asrt.New(t)
+
+	// config is not set up, a service without a scope is denied everything.
+	auth := Auth{ServiceName: "user_module"}
+	assert.True(errors.Is(auth.Authorize(BooksRead), ErrForbidden))
+	assert.True(errors.Is(auth.AuthorizeOperation("DEPOSIT", []string{"1"}), ErrForbidden))
+	assert.True(errors.Is(auth.AuthorizeBooks(OperationsRead, []string{"1", "2"}), ErrForbidden))
+	assert.True(errors.Is(auth.AuthorizeAllBooks(ReportsRead), ErrForbidden))
+
+	// the ledger itself is not limited.
+	assert.NoError((&Auth{}).AuthorizeBook(BooksRead, "1"))
+	assert.NoError((&Auth{}).AuthorizeOperation("DEPOSIT", []string{"1"}))
+}
@@ -1,20 +1,45 @@
 package book_service
 
 import (
+	"encoding/json"
 	"errors"
-	"strconv"
+	"fmt"
+	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/thoas/go-funk"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 
 	"general_ledger_golang/models"
 	"general_ledger_golang/pkg/logger"
 	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
 )
 
+var ErrInvalidBook = errors.New("invalid book")
+
+// BookService works on the Postgres repositories, unless others (ex: models/memory) are set.
 type BookService struct {
-	BookRepository        models.Book
-	BookBalanceRepository models.BookBalance
+	BookRepository        models.BookRepository
+	BookBalanceRepository models.BalanceRepository
+	// ServiceName is the calling service, the book it updates should be in its scope.
+	// Empty for the ledger itself, which is not limited.
+	ServiceName string
+}
+
+func (b *BookService) books() models.BookRepository {
+	if b.BookRepository == nil {
+		return &models.Book{}
+	}
+	return b.BookRepository
+}
+
+func (b *BookService) balances() models.BalanceRepository {
+	if b.BookBalanceRepository == nil {
+		return &models.BookBalance{}
+	}
+	return b.BookBalanceRepository
 }
 
 // GetBook returns book details.
@@ -26,28 +51,178 @@ func (b *BookService) GetBook(bookId string, withBalance bool) (map[string]inter
 	if bookId == "" {
 		return nil, errors.New("BookId is empty")
 	}
-	book, err := b.BookRepository.GetBook(bookId)
+	book, err := b.books().GetBook(bookId)
 	if err != nil {
 		return nil, err
 	}
+	return b.bookResult(book, withBalance), nil
+}
+
+// GetBookByName returns the book with the given name, in the same shape as GetBook, nil if there's none.
+func (b *BookService) GetBookByName(name string, withBalance bool) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Name is empty")
+	}
+	book, err := b.books().GetBookByName(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return b.bookResult(book, withBalance), nil
+}
+
+func (b *BookService) bookResult(book *models.Book, withBalance bool) map[string]interface{} {
 	if book == nil {
-		return nil, nil
+		return nil
 	}
 
 	result := util.StructToJSON(book)
 
 	if withBalance {
-		balanceMap, _ := b.GetBalance(bookId, "", "", nil)
+		balanceMap, _ := b.GetBalance(fmt.Sprint(book.Id), "", "", nil)
 		result["balance"] = balanceMap
 	}
-	return result, nil
+	return result
+}
+
+// CreateOrUpdateBook creates the book, or updates the book with the same name. Its place in the chart of accounts
+// is validated: account type and normal side (defaults to the account type's), parent exists,
+// has the same account type, and isn't the book itself or one of its descendants.
+// Updating a book needs books:write on it, and changing the balance policy or the overdraft limits needs books:policy.
+// Returns "create" or "update", and the book with its id set.
+func (b *BookService) CreateOrUpdateBook(book *models.Book) (string, error) {
+	if book.Name == "" {
+		return "", fmt.Errorf("%w: name is required", ErrInvalidBook)
+	}
+	if err := validateAccount(book); err != nil {
+		return "", err
+	}
+
+	existing, err := b.books().GetBookByName(book.Name, nil)
+	if err != nil {
+		return "", err
+	}
+	auth := auth_service.Auth{ServiceName: b.ServiceName}
+	if existing != nil {
+		if err = auth.AuthorizeBook(auth_service.BooksWrite, fmt.Sprint(existing.Id)); err != nil {
+			return "", err
+		}
+	}
+	if changesPolicy(existing, book) {
+		if err = auth.Authorize(auth_service.BooksPolicy); err != nil {
+			return "", err
+		}
+	}
+
+	accountType, parentId := book.AccountType, book.ParentId
+	if existing != nil {
+		if accountType == "" {
+			accountType = existing.AccountType
+		}
+		if parentId == "" {
+			parentId = existing.ParentId
+		}
+	}
+
+	if parentId != "" {
+		if err = b.validateParent(existing, accountType, parentId); err != nil {
+			return "", err
+		}
+	}
+
+	return b.books().CreateOrUpdateBook(book)
+}
+
+// changesPolicy tells if the book sets a balance policy other than the existing book's (STRICT for a new one),
+// or any overdraft limits.
+func changesPolicy(existing *models.Book, book *models.Book) bool {
+	if len(book.OverdraftLimits) > 0 {
+		return true
+	}
+	current := string(models.BalanceStrict)
+	if existing != nil {
+		current = existing.BalancePolicy
+	}
+	return book.BalancePolicy != "" && book.BalancePolicy != current
+}
+
+// validateAccount checks the account type and normal side of the book, and defaults the normal side.
+func validateAccount(book *models.Book) error {
+	if book.AccountType != "" && !funk.Contains(models.AccountTypes, models.AccountType(book.AccountType)) {
+		return fmt.Errorf("%w: accountType should be one of %v", ErrInvalidBook, models.AccountTypes)
+	}
+	if book.NormalSide != "" && book.NormalSide != string(models.NormalDebit) && book.NormalSide != string(models.NormalCredit) {
+		return fmt.Errorf("%w: normalSide should be %s or %s", ErrInvalidBook, models.NormalDebit, models.NormalCredit)
+	}
+	if book.NormalSide != "" && book.AccountType == "" {
+		return fmt.Errorf("%w: normalSide is given without accountType", ErrInvalidBook)
+	}
+	if book.NormalSide == "" && book.AccountType != "" {
+		book.NormalSide = string(models.DefaultNormalSide(models.AccountType(book.AccountType)))
+	}
+	return validateBalancePolicy(book)
+}
+
+// validateBalancePolicy checks the balance policy of the book, and its overdraft limits, which are only
+// allowed with the OVERDRAFT policy and should be non-negative amounts.
+func validateBalancePolicy(book *models.Book) error {
+	if book.BalancePolicy != "" && !funk.Contains(models.BalancePolicies, models.BalancePolicy(book.BalancePolicy)) {
+		return fmt.Errorf("%w: balancePolicy should be one of %v", ErrInvalidBook, models.BalancePolicies)
+	}
+	if len(book.OverdraftLimits) == 0 || string(book.OverdraftLimits) == "null" {
+		book.OverdraftLimits = nil
+		return nil
+	}
+	if book.BalancePolicy != string(models.BalanceOverdraft) {
+		return fmt.Errorf("%w: overdraftLimits are only allowed with balancePolicy %s", ErrInvalidBook, models.BalanceOverdraft)
+	}
+
+	limits := map[string]decimal.Decimal{}
+	if err := json.Unmarshal(book.OverdraftLimits, &limits); err != nil {
+		return fmt.Errorf("%w: overdraftLimits should be a map of assetId to amount, ex: {\"btc\": \"0.5\"}", ErrInvalidBook)
+	}
+	for assetId, limit := range limits {
+		if limit.IsNegative() {
+			return fmt.Errorf("%w: overdraft limit of %s should be a positive amount", ErrInvalidBook, assetId)
+		}
+	}
+	// limits sent as json numbers are stored as exact decimal strings.
+	limitsBytes, _ := json.Marshal(limits)
+	book.OverdraftLimits = datatypes.JSON(limitsBytes)
+	return nil
+}
+
+// validateParent checks that parentId can be the parent of the book (existing is nil for a new book).
+func (b *BookService) validateParent(existing *models.Book, accountType, parentId string) error {
+	parent, err := b.books().GetBook(parentId)
+	if err != nil {
+		return err
+	}
+	if parent == nil {
+		return fmt.Errorf("%w: parent book %s doesn't exist", ErrInvalidBook, parentId)
+	}
+	if parent.AccountType != accountType {
+		return fmt.Errorf("%w: accountType %q should be the same as the parent's %q", ErrInvalidBook, accountType, parent.AccountType)
+	}
+	if existing == nil {
+		return nil
+	}
+
+	bookId := fmt.Sprint(existing.Id)
+	ancestorIds, err := b.books().GetAncestorIds(parentId, nil)
+	if err != nil {
+		return err
+	}
+	if parentId == bookId || funk.ContainsString(ancestorIds, bookId) {
+		return fmt.Errorf("%w: parent book %s is the book itself or one of its descendants", ErrInvalidBook, parentId)
+	}
+	return nil
 }
 
 func (b *BookService) GetBooks(bookIds []string, tx *gorm.DB) ([]map[string]interface{}, error) {
 	if len(bookIds) < 1 {
 		return nil, errors.New("BookIds length is empty")
 	}
-	books, err := b.BookRepository.GetBooks(bookIds, tx)
+	books, err := b.books().GetBooks(bookIds, tx)
 	if err != nil {
 		return nil, err
 	}
@@ -66,31 +241,59 @@ func (b *BookService) GetBooks(bookIds []string, tx *gorm.DB) ([]map[string]inte
 }
 
 func (b *BookService) GetBalance(bookId, assetId, operationType string, tx *gorm.DB) (map[string]interface{}, error) {
-	balances, err := b.BookBalanceRepository.GetBalance(bookId, assetId, operationType, tx)
+	balances, err := b.balances().GetBalance(bookId, assetId, operationType, tx)
 	// If error, return error
 	if err != nil {
 		logger.Logger.Errorf("Fetching Operation Failed, error: %+v", err)
 		return nil, err
 	}
 
-	// If balance is found, return operation
-	if balances != nil {
-		balance := map[string]interface{}{}
-		// groupBy assetId, ex json: {"inr": {}, "btc": {}}
-		for _, balanceStruct := range *balances {
-			bMap := util.StructToJSON(balanceStruct)
-			bMap["balance"] = strconv.FormatFloat(balanceStruct.Balance, 'f', -1, 64)
-			delete(bMap, "id")
-			delete(bMap, "createdAt")
-			delete(bMap, "updatedAt")
-			balance[balanceStruct.AssetId] = bMap
-		}
+	return balancesToMap(balances), nil
+}
+
+// GetRollupBalance returns the balance of the book aggregated across its descendants, in the same shape as GetBalance.
+func (b *BookService) GetRollupBalance(bookId, assetId, operationType string, tx *gorm.DB) (map[string]interface{}, error) {
+	balances, err := b.balances().GetRollupBalance(bookId, assetId, operationType, tx)
+	if err != nil {
+		logger.Logger.Errorf("Fetching Rollup Balance Failed, error: %+v", err)
+		return nil, err
+	}
+
+	return balancesToMap(balances), nil
+}
+
+// GetBalanceAsOf returns the balance computed from postings and holds, as it was at asOf and/or after the operation
+// afterOperationId. The result is in the same shape as GetBalance, with asOf now, it matches the live balance
+// of a tracked book.
+func (b *BookService) GetBalanceAsOf(bookId, assetId, operationType string, asOf *time.Time, afterOperationId uint64, tx *gorm.DB) (map[string]interface{}, error) {
+	balances, err := b.balances().GetBalanceAsOf(bookId, assetId, operationType, asOf, afterOperationId, tx)
+	if err != nil {
+		logger.Logger.Errorf("Computing Balance As Of Failed, error: %+v", err)
+		return nil, err
+	}
 
-		bInterface := util.StructToJSON(&balance)
-		return bInterface, nil
+	return balancesToMap(balances), nil
+}
+
+// balancesToMap groups the balances by assetId, ex json: {"inr": {}, "btc": {}}.
+// Returns an empty map if no balance is found.
+func balancesToMap(balances *[]models.BookBalance) map[string]interface{} {
+	if balances == nil {
+		return map[string]interface{}{}
 	}
-	// else, return (empty map, nil) if no error and no balance is found.
-	return map[string]interface{}{}, nil
+
+	balance := map[string]interface{}{}
+	for _, balanceStruct := range *balances {
+		bMap := util.StructToJSON(balanceStruct)
+		// canonical decimal string, ex: "0.00000001", never in exponent form or with trailing zeros.
+		bMap["balance"] = balanceStruct.Balance.String()
+		delete(bMap, "id")
+		delete(bMap, "createdAt")
+		delete(bMap, "updatedAt")
+		balance[balanceStruct.AssetId] = bMap
+	}
+
+	return util.StructToJSON(&balance)
 }
 
 func (b *BookService) CheckBookExists(nUniqBookIds []string, tx *gorm.DB) (bool, error) {
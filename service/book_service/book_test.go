@@ -0,0 +1,65 @@
+package book_service
+
+import (
+	"testing"
+
+	asrt "github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+
+	"general_ledger_golang/models"
+)
+
+func TestValidateAccount(t *testing.T) {
+	assert := asrt.New(t)
+
+	book := &models.Book{Name: "cash", AccountType: string(models.AccountAsset)}
+	assert.NoError(validateAccount(book))
+	assert.Equal(string(models.NormalDebit), book.NormalSide)
+
+	book = &models.Book{Name: "fees", AccountType: string(models.AccountRevenue)}
+	assert.NoError(validateAccount(book))
+	assert.Equal(string(models.NormalCredit), book.NormalSide)
+
+	// contra account, ex: accumulated depreciation is an asset with a credit normal side.
+	book = &models.Book{Name: "depreciation", AccountType: string(models.AccountAsset), NormalSide: string(models.NormalCredit)}
+	assert.NoError(validateAccount(book))
+	assert.Equal(string(models.NormalCredit), book.NormalSide)
+
+	book = &models.Book{Name: "untyped"}
+	assert.NoError(validateAccount(book))
+	assert.Equal("", book.NormalSide)
+
+	assert.ErrorIs(validateAccount(&models.Book{Name: "x", AccountType: "INCOME"}), ErrInvalidBook)
+	assert.ErrorIs(validateAccount(&models.Book{Name: "x", AccountType: string(models.AccountEquity), NormalSide: "LEFT"}), ErrInvalidBook)
+	assert.ErrorIs(validateAccount(&models.Book{Name: "x", NormalSide: string(models.NormalDebit)}), ErrInvalidBook)
+}
+
+func TestValidateBalancePolicy(t *testing.T) {
+	assert := asrt.New(t)
+
+	book := &models.Book{Name: "margin", BalancePolicy: string(models.BalanceOverdraft), OverdraftLimits: datatypes.JSON(`{"btc": 0.5, "inr": "1000"}`)}
+	assert.NoError(validateBalancePolicy(book))
+	assert.JSONEq(`{"btc": "0.5", "inr": "1000"}`, string(book.OverdraftLimits))
+
+	assert.NoError(validateBalancePolicy(&models.Book{Name: "cash", BalancePolicy: string(models.BalanceAllowNegative)}))
+	assert.NoError(validateBalancePolicy(&models.Book{Name: "user"}))
+
+	assert.ErrorIs(validateBalancePolicy(&models.Book{Name: "x", BalancePolicy: "NEGATIVE"}), ErrInvalidBook)
+	assert.ErrorIs(validateBalancePolicy(&models.Book{Name: "x", BalancePolicy: string(models.BalanceStrict), OverdraftLimits: datatypes.JSON(`{"btc": "1"}`)}), ErrInvalidBook)
+	assert.ErrorIs(validateBalancePolicy(&models.Book{Name: "x", BalancePolicy: string(models.BalanceOverdraft), OverdraftLimits: datatypes.JSON(`{"btc": "-1"}`)}), ErrInvalidBook)
+	assert.ErrorIs(validateBalancePolicy(&models.Book{Name: "x", BalancePolicy: string(models.BalanceOverdraft), OverdraftLimits: datatypes.JSON(`["btc"]`)}), ErrInvalidBook)
+}
+
+func TestChangesPolicy(t *testing.T) {
+	assert := asrt.New(t)
+
+	assert.False(changesPolicy(nil, &models.Book{Name: "cash"}))
+	assert.False(changesPolicy(nil, &models.Book{Name: "cash", BalancePolicy: string(models.BalanceStrict)}))
+	assert.True(changesPolicy(nil, &models.Book{Name: "cash", BalancePolicy: string(models.BalanceAllowNegative)}))
+
+	existing := &models.Book{Name: "cash", BalancePolicy: string(models.BalanceOverdraft)}
+	assert.False(changesPolicy(existing, &models.Book{Name: "cash", AccountType: string(models.AccountAsset)}))
+	assert.False(changesPolicy(existing, &models.Book{Name: "cash", BalancePolicy: string(models.BalanceOverdraft)}))
+	assert.True(changesPolicy(existing, &models.Book{Name: "cash", BalancePolicy: string(models.BalanceStrict)}))
+	assert.True(changesPolicy(existing, &models.Book{Name: "cash", OverdraftLimits: datatypes.JSON(`{"btc": "1"}`)}))
+}
@@ -0,0 +1,432 @@
+package hold_service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/database"
+	"general_ledger_golang/pkg/logger"
+	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
+	"general_ledger_golang/service/operation_service"
+)
+
+// CaptureOperation is the operation type (metadata["operation"]) of a capture, if the caller doesn't provide one.
+const CaptureOperation = "CAPTURE"
+
+// EventSourceHold is the source of balance.changed events caused by holds.
+const EventSourceHold = "hold"
+
+// expiredHoldsBatchSize is how many expired holds are released per sweep.
+const expiredHoldsBatchSize = 100
+
+var (
+	ErrInvalidHold        = errors.New("invalid hold")
+	ErrHoldNotFound       = errors.New("hold not found")
+	ErrHoldNotActive      = errors.New("hold is not active anymore")
+	ErrHoldExpired        = errors.New("hold is expired")
+	ErrInsufficientFunds  = errors.New("insufficient funds")
+	ErrCaptureExceedsHold = errors.New("capture amount exceeds the remaining held amount")
+	ErrCaptureRejected    = errors.New("capture operation was rejected")
+)
+
+// HoldService works on the Postgres repositories, unless others (ex: models/memory) are set. The operation and
+// posting repositories are the ones of the capture operations.
+type HoldService struct {
+	HoldRepository        models.HoldRepository
+	BookRepository        models.BookRepository
+	BookBalanceRepository models.BalanceRepository
+	AssetRepository       models.AssetRepository
+	OutboxRepository      models.OutboxRepository
+	OperationRepository   models.OperationRepository
+	PostingRepository     models.PostingRepository
+	Transactor            models.Transactor
+	// ServiceName is the calling service, the hold's book, and the operation of a capture, should be in its scope.
+	// Empty for the ledger itself (ex: the expiry sweeper), which is not limited.
+	ServiceName string
+}
+
+func (h *HoldService) GetHold(memo string) (map[string]interface{}, error) {
+	hold, err := h.holds().GetHold(memo, nil)
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		return nil, nil
+	}
+	if err = h.authorizeBook(auth_service.HoldsRead, hold.BookId); err != nil {
+		return nil, err
+	}
+	return util.StructToJSON(hold), nil
+}
+
+// CreateHold reserves amount of assetId on bookId. The amount moves from the OVERALL balance to the HELD balance,
+// so the reserve fails if the book doesn't have enough OVERALL balance.
+//
+// Holds are idempotent on memo, if the memo already exists with the same book, asset and amount, that hold is
+// returned, otherwise operation_service.ErrIdempotencyConflict is returned.
+func (h *HoldService) CreateHold(memo, bookId, assetId string, amount decimal.Decimal, expiresAt *time.Time, metadata map[string]interface{}) (map[string]interface{}, error) {
+	if err := h.authorizeBook(auth_service.HoldsWrite, bookId); err != nil {
+		return nil, err
+	}
+	var hold *models.Hold
+
+	// the whole trx is retried on transient failures, like operations.
+	err := database.GetRetryPolicy().Run("CreateHold", func() error {
+		return h.transactor().Transaction(nil, func(tx *gorm.DB) error {
+			existing, err := h.holds().GetHold(memo, tx)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				if existing.BookId != bookId || existing.AssetId != assetId || !existing.Amount.Equal(amount) {
+					return fmt.Errorf("%w, memo: %s is a hold of a different book, asset or amount", operation_service.ErrIdempotencyConflict, memo)
+				}
+				if err = h.authorizeBook(auth_service.HoldsRead, existing.BookId); err != nil {
+					return err
+				}
+				hold = existing
+				return nil
+			}
+
+			if err = h.validateHold(memo, bookId, assetId, amount, expiresAt, tx); err != nil {
+				return err
+			}
+
+			metadataBytes, _ := json.Marshal(metadata)
+			hold = &models.Hold{
+				Memo:     memo,
+				BookId:   bookId,
+				AssetId:  assetId,
+				Amount:   amount,
+				Status:   string(models.HoldHeld),
+				Metadata: datatypes.JSON(metadataBytes),
+			}
+			if expiresAt != nil {
+				utc := expiresAt.UTC()
+				hold.ExpiresAt = &utc
+			}
+
+			// books before balances, same lock order as operations.
+			if err = h.books().LockBooks([]string{bookId}, tx); err != nil {
+				return err
+			}
+			if err = h.holds().CreateHold(hold, tx); err != nil {
+				return err
+			}
+
+			// OVERALL first, so that the balance policy check fails before touching HELD.
+			return h.adjustHeld(hold, amount, tx)
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return util.StructToJSON(hold), nil
+}
+
+// CaptureHold captures amount (remaining amount, if amount is not valid) of the hold into a real operation,
+// which moves the amount from the hold's book to toBookId. The operation is applied in the same trx,
+// with memo opMemo, type opType and the given metadata, `holdMemo` is added to the metadata to link them.
+//
+// Captures are idempotent on opMemo, if the operation already exists, the hold and the operation are returned as is.
+func (h *HoldService) CaptureHold(memo string, amount decimal.NullDecimal, opMemo, toBookId, opType string, metadata map[string]interface{}) (map[string]interface{}, map[string]interface{}, error) {
+	opService := h.operationService()
+
+	var hold *models.Hold
+	var operation map[string]interface{}
+
+	err := database.GetRetryPolicy().Run("CaptureHold", func() error {
+		return h.transactor().Transaction(nil, func(tx *gorm.DB) error {
+			var err error
+			hold, err = h.holds().GetHoldForUpdate(memo, tx)
+			if err != nil {
+				return err
+			}
+			if hold == nil {
+				return ErrHoldNotFound
+			}
+
+			opMetadata := map[string]interface{}{}
+			for k, v := range metadata {
+				opMetadata[k] = v
+			}
+			if _, ok := opMetadata["operation"]; !ok {
+				opMetadata["operation"] = CaptureOperation
+			}
+			opMetadata["holdMemo"] = hold.Memo
+
+			// checked before the idempotency lookup too, ApplyOperationInTx checks the operation again.
+			if err = h.authorizeBook(auth_service.HoldsWrite, hold.BookId); err != nil {
+				return err
+			}
+			auth := auth_service.Auth{ServiceName: h.ServiceName}
+			operationType := models.OperationRequest{Metadata: opMetadata}.OperationType()
+			if err = auth.AuthorizeOperation(operationType, []string{hold.BookId, toBookId}); err != nil {
+				return err
+			}
+
+			operation, err = opService.GetOperation(opMemo, tx)
+			if err != nil {
+				return err
+			}
+			if operation != nil {
+				if existingMetadata, _ := operation["metadata"].(map[string]interface{}); existingMetadata["holdMemo"] != hold.Memo {
+					return fmt.Errorf("%w, memo: %s is not a capture of hold %s", operation_service.ErrIdempotencyConflict, opMemo, hold.Memo)
+				}
+				return nil
+			}
+
+			if !hold.IsActive() {
+				return fmt.Errorf("%w, status: %s", ErrHoldNotActive, hold.Status)
+			}
+			if hold.IsExpired(time.Now()) {
+				return ErrHoldExpired
+			}
+
+			captureAmount := hold.Remaining()
+			if amount.Valid {
+				captureAmount = amount.Decimal
+			}
+			if !captureAmount.IsPositive() {
+				return fmt.Errorf("%w: amount should be positive", ErrInvalidHold)
+			}
+			if captureAmount.GreaterThan(hold.Remaining()) {
+				return fmt.Errorf("%w, remaining: %s", ErrCaptureExceedsHold, hold.Remaining().String())
+			}
+
+			// lock both books of the operation before touching the balances, ApplyOperationInTx locks them again
+			// for the postings, taking them in a different order would deadlock with concurrent operations.
+			if err = h.books().LockBooks([]string{hold.BookId, toBookId}, tx); err != nil {
+				return err
+			}
+			// put the captured part back to OVERALL, so that the operation can spend it.
+			if err = h.adjustHeld(hold, captureAmount.Neg(), tx); err != nil {
+				return err
+			}
+
+			operation, err = opService.ApplyOperationInTx(models.OperationRequest{
+				Type: opType,
+				Memo: opMemo,
+				Entries: []models.Entry{
+					{BookId: hold.BookId, AssetId: hold.AssetId, Value: captureAmount.Neg()},
+					{BookId: toBookId, AssetId: hold.AssetId, Value: captureAmount},
+				},
+				Metadata: opMetadata,
+			}, tx)
+			if err != nil {
+				return err
+			}
+			if operation["status"] != string(models.OperationApplied) {
+				// roll back, the hold should stay as is when the operation couldn't be applied.
+				return fmt.Errorf("%w, reason: %v", ErrCaptureRejected, operation["rejectionReason"])
+			}
+
+			hold.CapturedAmount = hold.CapturedAmount.Add(captureAmount)
+			hold.Status = string(models.HoldPartiallyCaptured)
+			if hold.Remaining().IsZero() {
+				hold.Status = string(models.HoldCaptured)
+			}
+			return h.holds().UpdateHold(hold, tx)
+		})
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return util.StructToJSON(hold), operation, nil
+}
+
+// ReleaseHold releases the remaining amount of the hold back to the OVERALL balance.
+// Releasing an already released hold returns the hold as is.
+func (h *HoldService) ReleaseHold(memo string) (map[string]interface{}, error) {
+	var hold *models.Hold
+
+	err := database.GetRetryPolicy().Run("ReleaseHold", func() error {
+		return h.transactor().Transaction(nil, func(tx *gorm.DB) error {
+			var err error
+			hold, err = h.holds().GetHoldForUpdate(memo, tx)
+			if err != nil {
+				return err
+			}
+			if hold == nil {
+				return ErrHoldNotFound
+			}
+			if err = h.authorizeBook(auth_service.HoldsWrite, hold.BookId); err != nil {
+				return err
+			}
+			if hold.Status == string(models.HoldReleased) {
+				return nil
+			}
+			if !hold.IsActive() {
+				return fmt.Errorf("%w, status: %s", ErrHoldNotActive, hold.Status)
+			}
+			return h.release(hold, models.HoldReleased, tx)
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return util.StructToJSON(hold), nil
+}
+
+// ReleaseExpiredHolds releases (a batch of) the active holds that are past their expiry, and marks those EXPIRED.
+// Returns the number of holds released.
+func (h *HoldService) ReleaseExpiredHolds() (int, error) {
+	memos, err := h.holds().GetExpiredHoldMemos(time.Now(), expiredHoldsBatchSize, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, memo := range memos {
+		expired := false
+		err = database.GetRetryPolicy().Run("ReleaseExpiredHold", func() error {
+			return h.transactor().Transaction(nil, func(tx *gorm.DB) error {
+				hold, err := h.holds().GetHoldForUpdate(memo, tx)
+				if err != nil {
+					return err
+				}
+				// recheck under lock, it might have been captured or released meanwhile.
+				expired = hold != nil && hold.IsActive() && hold.IsExpired(time.Now())
+				if !expired {
+					return nil
+				}
+				return h.release(hold, models.HoldExpired, tx)
+			})
+		})
+		if err != nil {
+			return released, err
+		}
+		if expired {
+			released++
+		}
+	}
+	return released, nil
+}
+
+// StartExpirySweeper releases expired holds every interval, it's blocking, so call it with a go-routine.
+func (h *HoldService) StartExpirySweeper(interval time.Duration) {
+	if interval <= 0 {
+		logger.Logger.Infof("Hold expiry sweeper is disabled")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		released, err := h.ReleaseExpiredHolds()
+		if err != nil {
+			logger.Logger.Errorf("Releasing expired holds failed, released: %d, error: %+v", released, err)
+			continue
+		}
+		if released > 0 {
+			logger.Logger.Infof("Released %d expired holds", released)
+		}
+	}
+}
+
+// authorizeBook checks the permission on the hold's bookId against the scope of the calling service.
+func (h *HoldService) authorizeBook(permission auth_service.Permission, bookId string) error {
+	auth := auth_service.Auth{ServiceName: h.ServiceName}
+	return auth.AuthorizeBook(permission, bookId)
+}
+
+func (h *HoldService) release(hold *models.Hold, status models.HoldStatus, tx *gorm.DB) error {
+	if err := h.books().LockBooks([]string{hold.BookId}, tx); err != nil {
+		return err
+	}
+	remaining := hold.Remaining()
+	if err := h.adjustHeld(hold, remaining.Neg(), tx); err != nil {
+		return err
+	}
+	hold.ReleasedAmount = hold.ReleasedAmount.Add(remaining)
+	hold.Status = string(status)
+	return h.holds().UpdateHold(hold, tx)
+}
+
+// adjustHeld moves value from the OVERALL balance of the hold's book to its HELD balance,
+// negative value moves it back. A breach of the book's balance policy is reported as ErrInsufficientFunds.
+// The change is recorded as a balance.changed event in the outbox.
+func (h *HoldService) adjustHeld(hold *models.Hold, value decimal.Decimal, tx *gorm.DB) error {
+	changes := []models.BalanceChange{
+		{OperationType: models.OverallOperation, Value: value.Neg()},
+		{OperationType: models.HeldOperation, Value: value},
+	}
+	err := h.balances().AdjustBalances(hold.BookId, hold.AssetId, changes, tx)
+
+	var insufficientBalance *models.InsufficientBalanceError
+	if errors.As(err, &insufficientBalance) {
+		logger.Logger.WithFields(logrus.Fields{
+			"memo":    hold.Memo,
+			"bookId":  hold.BookId,
+			"assetId": hold.AssetId,
+		}).Infof("Hold rejected, not enough balance to hold %s", value.String())
+		return fmt.Errorf("%w: can't hold %s, %s", ErrInsufficientFunds, value.String(), insufficientBalance.Reason())
+	}
+	if err != nil {
+		return err
+	}
+
+	var balances []models.BookBalance
+	for _, change := range changes {
+		changed, err := h.balances().GetBalance(hold.BookId, hold.AssetId, change.OperationType, tx)
+		if err != nil {
+			return err
+		}
+		if changed != nil {
+			balances = append(balances, *changed...)
+		}
+	}
+	event, err := models.BalanceChangedEventOf(EventSourceHold, hold.Memo, hold.BookId, hold.AssetId, changes, balances)
+	if err != nil {
+		return err
+	}
+	return h.outbox().CreateEvents([]models.OutboxEvent{event}, tx)
+}
+
+func (h *HoldService) validateHold(memo, bookId, assetId string, amount decimal.Decimal, expiresAt *time.Time, tx *gorm.DB) error {
+	if memo == "" || bookId == "" || assetId == "" {
+		return fmt.Errorf("%w: memo, bookId and assetId are required", ErrInvalidHold)
+	}
+	if !amount.IsPositive() {
+		return fmt.Errorf("%w: amount should be positive", ErrInvalidHold)
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expiresAt should be in the future", ErrInvalidHold)
+	}
+	// without a balance row, there's nothing to reserve against.
+	if !models.IsBalanceTracked(bookId) {
+		return fmt.Errorf("%w: balance of book %s is not tracked, it can't have holds", ErrInvalidHold, bookId)
+	}
+
+	books, err := h.books().GetBooks([]string{bookId}, tx)
+	if err != nil {
+		return err
+	}
+	if books == nil {
+		return fmt.Errorf("%w: book %s doesn't exist", ErrInvalidHold, bookId)
+	}
+
+	asset, err := h.assets().GetAsset(assetId, tx)
+	if err != nil {
+		return err
+	}
+	if asset == nil {
+		return fmt.Errorf("%w: assetId %s is not registered", ErrInvalidHold, assetId)
+	}
+	if problem := asset.ValidateValue(amount); problem != "" {
+		return fmt.Errorf("%w: %s", ErrInvalidHold, problem)
+	}
+	return nil
+}
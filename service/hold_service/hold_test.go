@@ -0,0 +1,187 @@
+package hold_service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	asrt "github.com/stretchr/testify/assert"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/models/memory"
+	"general_ledger_golang/service/operation_service"
+)
+
+// newMemoryService returns a service over an in-memory store, with btc registered and books
+// 1 (ALLOW_NEGATIVE, the source of funds), 2 (STRICT, funded with 10 btc) and 3 (STRICT).
+func newMemoryService(t *testing.T) (*HoldService, *memory.Store) {
+	store := memory.New()
+	store.SetAsset(models.Asset{Code: "btc", Name: "Bitcoin", Scale: 8})
+	for _, book := range []models.Book{
+		{Name: "world", BalancePolicy: string(models.BalanceAllowNegative)},
+		{Name: "alice"},
+		{Name: "bob"},
+	} {
+		book := book
+		if _, err := store.CreateOrUpdateBook(&book); err != nil {
+			t.Fatalf("creating book %s failed, error: %v", book.Name, err)
+		}
+	}
+
+	h := &HoldService{
+		HoldRepository:        store,
+		BookRepository:        store,
+		BookBalanceRepository: store,
+		AssetRepository:       store,
+		OutboxRepository:      store,
+		OperationRepository:   store,
+		PostingRepository:     store,
+		Transactor:            store,
+	}
+	funded, err := h.operationService().ApplyOperation(models.OperationRequest{
+		Type: "TRANSFER",
+		Memo: "fund-alice",
+		Entries: []models.Entry{
+			{BookId: "1", AssetId: "btc", Value: decimal.RequireFromString("-10")},
+			{BookId: "2", AssetId: "btc", Value: decimal.RequireFromString("10")},
+		},
+		Metadata: map[string]interface{}{"operation": "TRANSFER"},
+	})
+	if err != nil || funded["status"] != string(models.OperationApplied) {
+		t.Fatalf("funding book 2 failed, operation: %+v, error: %v", funded, err)
+	}
+	return h, store
+}
+
+func balanceOf(t *testing.T, store *memory.Store, bookId, operationType string) string {
+	balances, err := store.GetBalance(bookId, "btc", operationType, nil)
+	if err != nil {
+		t.Fatalf("fetching %s balance of %s failed, error: %v", operationType, bookId, err)
+	}
+	if balances == nil {
+		return "0"
+	}
+	return (*balances)[0].Balance.String()
+}
+
+func TestCreateHold(t *testing.T) {
+	assert := asrt.New(t)
+	h, store := newMemoryService(t)
+	events := len(store.Events())
+
+	hold, err := h.CreateHold("hold-1", "2", "btc", decimal.RequireFromString("4"), nil, nil)
+	assert.NoError(err)
+	assert.Equal(string(models.HoldHeld), hold["status"])
+	assert.Equal("6", balanceOf(t, store, "2", models.OverallOperation))
+	assert.Equal("4", balanceOf(t, store, "2", models.HeldOperation))
+	assert.Len(store.Events(), events+1)
+
+	// a retry returns the same hold, nothing is held again.
+	retried, err := h.CreateHold("hold-1", "2", "btc", decimal.RequireFromString("4.0"), nil, nil)
+	assert.NoError(err)
+	assert.Equal(hold["id"], retried["id"])
+	assert.Equal("4", balanceOf(t, store, "2", models.HeldOperation))
+
+	// same memo for another amount or book is a conflict.
+	_, err = h.CreateHold("hold-1", "2", "btc", decimal.RequireFromString("5"), nil, nil)
+	assert.True(errors.Is(err, operation_service.ErrIdempotencyConflict))
+	_, err = h.CreateHold("hold-1", "3", "btc", decimal.RequireFromString("4"), nil, nil)
+	assert.True(errors.Is(err, operation_service.ErrIdempotencyConflict))
+
+	// book 2 has 6 left, the hold is rolled back.
+	_, err = h.CreateHold("hold-2", "2", "btc", decimal.RequireFromString("7"), nil, nil)
+	assert.True(errors.Is(err, ErrInsufficientFunds))
+	assert.Equal("6", balanceOf(t, store, "2", models.OverallOperation))
+	missing, err := store.GetHold("hold-2", nil)
+	assert.NoError(err)
+	assert.Nil(missing)
+
+	_, err = h.CreateHold("hold-3", "2", "eth", decimal.RequireFromString("1"), nil, nil)
+	assert.True(errors.Is(err, ErrInvalidHold))
+}
+
+func TestCaptureHold(t *testing.T) {
+	assert := asrt.New(t)
+	h, store := newMemoryService(t)
+
+	_, err := h.CreateHold("hold-1", "2", "btc", decimal.RequireFromString("4"), nil, nil)
+	assert.NoError(err)
+
+	partial := decimal.NullDecimal{Decimal: decimal.RequireFromString("1.5"), Valid: true}
+	hold, operation, err := h.CaptureHold("hold-1", partial, "capture-1", "3", "PAYMENT", nil)
+	assert.NoError(err)
+	assert.Equal(string(models.HoldPartiallyCaptured), hold["status"])
+	assert.Equal(string(models.OperationApplied), operation["status"])
+	assert.Equal("6", balanceOf(t, store, "2", models.OverallOperation))
+	assert.Equal("2.5", balanceOf(t, store, "2", models.HeldOperation))
+	assert.Equal("1.5", balanceOf(t, store, "3", models.OverallOperation))
+
+	// a retry returns the same operation, nothing is captured again.
+	_, retried, err := h.CaptureHold("hold-1", partial, "capture-1", "3", "PAYMENT", nil)
+	assert.NoError(err)
+	assert.Equal(operation["id"], retried["id"])
+	assert.Equal("2.5", balanceOf(t, store, "2", models.HeldOperation))
+
+	_, _, err = h.CaptureHold("hold-1", decimal.NullDecimal{Decimal: decimal.RequireFromString("3"), Valid: true}, "capture-2", "3", "PAYMENT", nil)
+	assert.True(errors.Is(err, ErrCaptureExceedsHold))
+
+	// the remaining amount, if no amount is given.
+	hold, _, err = h.CaptureHold("hold-1", decimal.NullDecimal{}, "capture-3", "3", "PAYMENT", nil)
+	assert.NoError(err)
+	assert.Equal(string(models.HoldCaptured), hold["status"])
+	assert.Equal("0", balanceOf(t, store, "2", models.HeldOperation))
+	assert.Equal("4", balanceOf(t, store, "3", models.OverallOperation))
+
+	_, _, err = h.CaptureHold("hold-1", decimal.NullDecimal{}, "capture-4", "3", "PAYMENT", nil)
+	assert.True(errors.Is(err, ErrHoldNotActive))
+	_, _, err = h.CaptureHold("hold-9", decimal.NullDecimal{}, "capture-5", "3", "PAYMENT", nil)
+	assert.True(errors.Is(err, ErrHoldNotFound))
+}
+
+func TestReleaseHold(t *testing.T) {
+	assert := asrt.New(t)
+	h, store := newMemoryService(t)
+
+	_, err := h.CreateHold("hold-1", "2", "btc", decimal.RequireFromString("4"), nil, nil)
+	assert.NoError(err)
+	_, _, err = h.CaptureHold("hold-1", decimal.NullDecimal{Decimal: decimal.RequireFromString("1"), Valid: true}, "capture-1", "3", "PAYMENT", nil)
+	assert.NoError(err)
+
+	hold, err := h.ReleaseHold("hold-1")
+	assert.NoError(err)
+	assert.Equal(string(models.HoldReleased), hold["status"])
+	assert.Equal("9", balanceOf(t, store, "2", models.OverallOperation))
+	assert.Equal("0", balanceOf(t, store, "2", models.HeldOperation))
+
+	// releasing again returns the hold as is.
+	_, err = h.ReleaseHold("hold-1")
+	assert.NoError(err)
+	assert.Equal("9", balanceOf(t, store, "2", models.OverallOperation))
+}
+
+func TestReleaseExpiredHolds(t *testing.T) {
+	assert := asrt.New(t)
+	h, store := newMemoryService(t)
+
+	expiresAt := time.Now().Add(20 * time.Millisecond)
+	_, err := h.CreateHold("expiring", "2", "btc", decimal.RequireFromString("4"), &expiresAt, nil)
+	assert.NoError(err)
+	_, err = h.CreateHold("open", "2", "btc", decimal.RequireFromString("1"), nil, nil)
+	assert.NoError(err)
+
+	released, err := h.ReleaseExpiredHolds()
+	assert.NoError(err)
+	assert.Equal(0, released)
+
+	time.Sleep(30 * time.Millisecond)
+	released, err = h.ReleaseExpiredHolds()
+	assert.NoError(err)
+	assert.Equal(1, released)
+	assert.Equal("9", balanceOf(t, store, "2", models.OverallOperation))
+	assert.Equal("1", balanceOf(t, store, "2", models.HeldOperation))
+
+	hold, err := store.GetHold("expiring", nil)
+	assert.NoError(err)
+	assert.Equal(string(models.HoldExpired), hold.Status)
+}
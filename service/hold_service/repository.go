@@ -0,0 +1,64 @@
+package hold_service
+
+import (
+	"general_ledger_golang/models"
+	"general_ledger_golang/service/operation_service"
+)
+
+// the repositories of the service, Postgres ones for the unset fields.
+
+func (h *HoldService) holds() models.HoldRepository {
+	if h.HoldRepository == nil {
+		return &models.Hold{}
+	}
+	return h.HoldRepository
+}
+
+func (h *HoldService) books() models.BookRepository {
+	if h.BookRepository == nil {
+		return &models.Book{}
+	}
+	return h.BookRepository
+}
+
+func (h *HoldService) balances() models.BalanceRepository {
+	if h.BookBalanceRepository == nil {
+		return &models.BookBalance{}
+	}
+	return h.BookBalanceRepository
+}
+
+func (h *HoldService) assets() models.AssetRepository {
+	if h.AssetRepository == nil {
+		return &models.Asset{}
+	}
+	return h.AssetRepository
+}
+
+func (h *HoldService) outbox() models.OutboxRepository {
+	if h.OutboxRepository == nil {
+		return &models.OutboxEvent{}
+	}
+	return h.OutboxRepository
+}
+
+func (h *HoldService) transactor() models.Transactor {
+	if h.Transactor == nil {
+		return models.DBTransactor{}
+	}
+	return h.Transactor
+}
+
+// operationService applies the capture operations, on the same repositories.
+func (h *HoldService) operationService() *operation_service.OperationService {
+	return &operation_service.OperationService{
+		OperationRepository:   h.OperationRepository,
+		AssetRepository:       h.AssetRepository,
+		OutboxRepository:      h.OutboxRepository,
+		BookRepository:        h.BookRepository,
+		BookBalanceRepository: h.BookBalanceRepository,
+		PostingRepository:     h.PostingRepository,
+		Transactor:            h.Transactor,
+		ServiceName:           h.ServiceName,
+	}
+}
@@ -0,0 +1,121 @@
+package operation_service
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/database"
+)
+
+// MaxBatchSize is the max number of operations a batch can have.
+const MaxBatchSize = 1000
+
+const (
+	// BatchOperationError is the status of an operation which errored out, nothing of it is persisted.
+	BatchOperationError = "ERROR"
+	// BatchOperationRolledBack is the status of an operation which was applied, but rolled back with the batch.
+	BatchOperationRolledBack = "ROLLED_BACK"
+	// BatchOperationSkipped is the status of an operation which wasn't attempted, as the batch failed before it.
+	BatchOperationSkipped = "SKIPPED"
+)
+
+var (
+	ErrInvalidBatch    = errors.New("invalid batch")
+	ErrBatchRolledBack = errors.New("batch is rolled back")
+)
+
+// BatchResult is the outcome of a single operation of a batch.
+// Status is the operation's status (APPLIED, REJECTED) or one of the BatchOperation* statuses.
+type BatchResult struct {
+	Memo      string                 `json:"memo"`
+	Status    string                 `json:"status"`
+	Operation map[string]interface{} `json:"operation,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+// ApplyOperationBatch applies the operations in order, inside a single transaction.
+//
+// By default, the batch is all-or-nothing: the first operation that's not APPLIED (rejected or errored out)
+// rolls back the whole batch, ErrBatchRolledBack is returned along with the results.
+// With continueOnError, every operation is applied in its own savepoint, a failed one doesn't affect the others,
+// and rejected ones are persisted as REJECTED, same as applying them one by one.
+//
+// Like ApplyOperation, it's idempotent per memo, an already existing memo returns the existing operation,
+// which stays as is (not ROLLED_BACK) when the batch is rolled back.
+func (o *OperationService) ApplyOperationBatch(ops []models.OperationRequest, continueOnError bool) ([]BatchResult, error) {
+	if len(ops) < 1 {
+		return nil, fmt.Errorf("%w: operations are empty", ErrInvalidBatch)
+	}
+	if len(ops) > MaxBatchSize {
+		return nil, fmt.Errorf("%w: a batch can have at most %d operations", ErrInvalidBatch, MaxBatchSize)
+	}
+
+	// a batch with an operation out of the service's scope is refused as a whole.
+	for _, op := range ops {
+		if err := o.authorize(op); err != nil {
+			return nil, err
+		}
+	}
+
+	var results []BatchResult
+	var created []bool
+
+	err := database.GetRetryPolicy().Run("ApplyOperationBatch", func() error {
+		return o.transactor().Transaction(nil, func(tx *gorm.DB) error {
+			results = make([]BatchResult, len(ops))
+			// created tells which operations this batch created, the others were there before it (replays).
+			created = make([]bool, len(ops))
+			for i, op := range ops {
+				results[i] = BatchResult{Memo: op.Memo, Status: BatchOperationSkipped}
+			}
+
+			for i, op := range ops {
+				var applied map[string]interface{}
+
+				// nested transaction is a savepoint, a db error inside it only rolls back this operation.
+				err := o.transactor().Transaction(tx, func(sp *gorm.DB) error {
+					var err error
+					applied, created[i], err = o.applyOperationInTx(op, sp)
+					return err
+				})
+
+				if database.IsRetryable(err) {
+					// retry the whole batch, rather than failing an operation which would succeed on a retry.
+					return err
+				}
+				if err != nil {
+					results[i].Status = BatchOperationError
+					results[i].Error = err.Error()
+					if continueOnError {
+						continue
+					}
+					return fmt.Errorf("%w, operation %s errored out: %v", ErrBatchRolledBack, results[i].Memo, err)
+				}
+
+				results[i].Status = fmt.Sprint(applied["status"])
+				results[i].Operation = applied
+				if results[i].Status != string(models.OperationApplied) && !continueOnError {
+					return fmt.Errorf("%w, operation %s is %s: %v", ErrBatchRolledBack, results[i].Memo, results[i].Status, applied["rejectionReason"])
+				}
+			}
+			return nil
+		})
+	})
+
+	if errors.Is(err, ErrBatchRolledBack) {
+		for i := range results {
+			// replays were applied before the batch, they aren't rolled back with it.
+			if created[i] && results[i].Status == string(models.OperationApplied) {
+				results[i].Status = BatchOperationRolledBack
+			}
+		}
+		return results, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,81 @@
+package operation_service
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"general_ledger_golang/models"
+)
+
+// EventSourceOperation is the source of balance.changed events caused by operations.
+const EventSourceOperation = "operation"
+
+// recordOperationEvents writes the event of the operation (applied or rejected) to the outbox in tx, and for
+// an applied one, a balance.changed event for every book and asset of its entries.
+func (o *OperationService) recordOperationEvents(op map[string]interface{}, entries []models.Entry, tx *gorm.DB) error {
+	memo := fmt.Sprint(op["memo"])
+
+	eventType := models.EventOperationRejected
+	if op["status"] == string(models.OperationApplied) {
+		eventType = models.EventOperationApplied
+	}
+	event, err := models.NewOutboxEvent(eventType, memo, op)
+	if err != nil {
+		return err
+	}
+	events := []models.OutboxEvent{event}
+
+	if eventType == models.EventOperationApplied {
+		for _, change := range entryChanges(entries) {
+			balances, err := o.balances().GetBalance(change.bookId, change.assetId, models.OverallOperation, tx)
+			if err != nil {
+				return err
+			}
+			if balances == nil {
+				// untracked books have no balance.
+				balances = &[]models.BookBalance{}
+			}
+			event, err = models.BalanceChangedEventOf(EventSourceOperation, memo, change.bookId, change.assetId, []models.BalanceChange{
+				{OperationType: models.OverallOperation, Value: change.value},
+			}, *balances)
+			if err != nil {
+				return err
+			}
+			events = append(events, event)
+		}
+	}
+
+	return o.outbox().CreateEvents(events, tx)
+}
+
+type entryChange struct {
+	bookId  string
+	assetId string
+	value   decimal.Decimal
+}
+
+// entryChanges sums the entry values per book and asset, sorted by bookId, assetId.
+func entryChanges(entries []models.Entry) []entryChange {
+	var changes []entryChange
+	index := map[[2]string]int{}
+	for _, entry := range entries {
+		key := [2]string{entry.BookId, entry.AssetId}
+		if i, ok := index[key]; ok {
+			changes[i].value = changes[i].value.Add(entry.Value)
+			continue
+		}
+		index[key] = len(changes)
+		changes = append(changes, entryChange{bookId: entry.BookId, assetId: entry.AssetId, value: entry.Value})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].bookId == changes[j].bookId {
+			return changes[i].assetId < changes[j].assetId
+		}
+		return changes[i].bookId < changes[j].bookId
+	})
+	return changes
+}
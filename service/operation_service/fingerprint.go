@@ -0,0 +1,88 @@
+package operation_service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"general_ledger_golang/models"
+)
+
+var ErrIdempotencyConflict = errors.New("memo is already used by an operation with a different payload")
+
+// ledgerManagedMetadataKeys are added to an operation's metadata by the ledger after it's created,
+// those are not part of the client's payload, so they're not fingerprinted.
+var ledgerManagedMetadataKeys = []string{"reversedBy"}
+
+// canonicalOperation is the client provided part of an operation, in a form where equal payloads
+// have the same json, irrespective of entries order, key order or how decimals are written (1.0 vs 1).
+type canonicalOperation struct {
+	Type     string          `json:"type"`
+	Entries  [][3]string     `json:"entries"`
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+func canonicalize(op models.OperationRequest) canonicalOperation {
+	c := canonicalOperation{Type: op.Type, Entries: [][3]string{}}
+
+	for _, entry := range op.Entries {
+		c.Entries = append(c.Entries, [3]string{entry.BookId, entry.AssetId, entry.Value.String()})
+	}
+	sort.Slice(c.Entries, func(i, j int) bool {
+		for k := 0; k < 3; k++ {
+			if c.Entries[i][k] != c.Entries[j][k] {
+				return c.Entries[i][k] < c.Entries[j][k]
+			}
+		}
+		return false
+	})
+
+	metadata := map[string]interface{}{}
+	for k, v := range op.Metadata {
+		metadata[k] = v
+	}
+	for _, key := range ledgerManagedMetadataKeys {
+		delete(metadata, key)
+	}
+	// json.Marshal sorts map keys, nested ones too.
+	c.Metadata, _ = json.Marshal(metadata)
+
+	return c
+}
+
+// Fingerprint is the sha256 (hex) of the canonical form of the operation's type, entries and metadata.
+func Fingerprint(op models.OperationRequest) string {
+	canonical, _ := json.Marshal(canonicalize(op))
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// differingFields compares the payload of a request with an existing operation,
+// and returns the fields that differ, empty if it's the same payload.
+func differingFields(request models.OperationRequest, existing *models.Operation) ([]string, error) {
+	if existing.Fingerprint != "" && existing.Fingerprint == Fingerprint(request) {
+		return nil, nil
+	}
+
+	existingRequest, err := models.OperationRequestOf(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	r, e := canonicalize(request), canonicalize(existingRequest)
+	var fields []string
+	if r.Type != e.Type {
+		fields = append(fields, "type")
+	}
+	rEntries, _ := json.Marshal(r.Entries)
+	eEntries, _ := json.Marshal(e.Entries)
+	if string(rEntries) != string(eEntries) {
+		fields = append(fields, "entries")
+	}
+	if string(r.Metadata) != string(e.Metadata) {
+		fields = append(fields, "metadata")
+	}
+	return fields, nil
+}
@@ -0,0 +1,221 @@
+package operation_service
+
+import (
+	"errors"
+	"testing"
+
+	asrt "github.com/stretchr/testify/assert"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/models/memory"
+	"general_ledger_golang/pkg/util"
+)
+
+// newMemoryService returns a service over an in-memory store, with btc registered and books
+// 1 (ALLOW_NEGATIVE, the source of funds), 2 and 3 (STRICT).
+func newMemoryService(t *testing.T) (*OperationService, *memory.Store) {
+	store := memory.New()
+	store.SetAsset(models.Asset{Code: "btc", Name: "Bitcoin", Scale: 8})
+	for _, book := range []models.Book{
+		{Name: "world", BalancePolicy: string(models.BalanceAllowNegative)},
+		{Name: "alice"},
+		{Name: "bob"},
+	} {
+		book := book
+		if _, err := store.CreateOrUpdateBook(&book); err != nil {
+			t.Fatalf("creating book %s failed, error: %v", book.Name, err)
+		}
+	}
+
+	return &OperationService{
+		OperationRepository:   store,
+		AssetRepository:       store,
+		OutboxRepository:      store,
+		BookRepository:        store,
+		BookBalanceRepository: store,
+		PostingRepository:     store,
+		Transactor:            store,
+	}, store
+}
+
+func transfer(memo, from, to, value string) models.OperationRequest {
+	return models.OperationRequest{
+		Type:     "TRANSFER",
+		Memo:     memo,
+		Entries:  []models.Entry{entry(from, "btc", "-"+value), entry(to, "btc", value)},
+		Metadata: map[string]interface{}{"operation": "TRANSFER"},
+	}
+}
+
+func balanceOf(t *testing.T, store *memory.Store, bookId string) string {
+	balances, err := store.GetBalance(bookId, "btc", models.OverallOperation, nil)
+	if err != nil {
+		t.Fatalf("fetching balance of %s failed, error: %v", bookId, err)
+	}
+	if balances == nil {
+		return "0"
+	}
+	return (*balances)[0].Balance.String()
+}
+
+func TestApplyOperationWithMemoryStore(t *testing.T) {
+	assert := asrt.New(t)
+	o, store := newMemoryService(t)
+
+	applied, err := o.ApplyOperation(transfer("fund-alice", "1", "2", "1.5"))
+	assert.NoError(err)
+	assert.Equal(string(models.OperationApplied), applied["status"])
+	assert.Equal("-1.5", balanceOf(t, store, "1"))
+	assert.Equal("1.5", balanceOf(t, store, "2"))
+	assert.Len(store.Postings(""), 2)
+	// operation.applied, and a balance.changed per book.
+	assert.Len(store.Events(), 3)
+
+	// a retry returns the same operation, nothing is applied again.
+	retried, err := o.ApplyOperation(transfer("fund-alice", "1", "2", "1.5"))
+	assert.NoError(err)
+	assert.Equal(applied["id"], retried["id"])
+	assert.Equal("1.5", balanceOf(t, store, "2"))
+
+	// same memo with a different payload is a conflict.
+	_, err = o.ApplyOperation(transfer("fund-alice", "1", "2", "2"))
+	assert.True(errors.Is(err, ErrIdempotencyConflict))
+}
+
+func TestApplyOperationRejectionsWithMemoryStore(t *testing.T) {
+	assert := asrt.New(t)
+	o, store := newMemoryService(t)
+
+	// book 2 is STRICT and empty.
+	rejected, err := o.ApplyOperation(transfer("alice-pays-bob", "2", "3", "1"))
+	assert.NoError(err)
+	assert.True(IsInsufficientFunds(rejected))
+	assert.Equal("0", balanceOf(t, store, "2"))
+	assert.Empty(store.Postings(""), "postings of a rejected operation should be rolled back")
+
+	operation, err := store.GetOperation("alice-pays-bob", nil)
+	assert.NoError(err)
+	assert.Equal(string(models.OperationRejected), operation.Status)
+
+	unbalanced := transfer("unbalanced", "1", "2", "1")
+	unbalanced.Entries[1] = entry("2", "btc", "2")
+	rejected, err = o.ApplyOperation(unbalanced)
+	assert.NoError(err)
+	assert.Equal(string(models.OperationRejected), rejected["status"])
+	assert.Contains(rejected["rejectionReason"], "entries don't sum to zero")
+
+	rejected, err = o.ApplyOperation(transfer("unknown-book", "1", "42", "1"))
+	assert.NoError(err)
+	assert.Equal(string(models.OperationRejected), rejected["status"])
+}
+
+func TestReverseOperationWithMemoryStore(t *testing.T) {
+	assert := asrt.New(t)
+	o, store := newMemoryService(t)
+
+	_, err := o.ApplyOperation(transfer("fund-bob", "1", "3", "0.25"))
+	assert.NoError(err)
+
+	reversal, err := o.ReverseOperation("fund-bob", "sent to the wrong book")
+	assert.NoError(err)
+	assert.Equal(string(models.OperationApplied), reversal["status"])
+	assert.Equal("0", balanceOf(t, store, "3"))
+
+	original, err := store.GetOperation("fund-bob", nil)
+	assert.NoError(err)
+	assert.Equal(string(models.OperationReversed), original.Status)
+
+	_, err = o.ReverseOperation("fund-bob", "again")
+	assert.True(errors.Is(err, ErrOperationAlreadyReversed))
+}
+
+func TestApplyOperationBatchWithMemoryStore(t *testing.T) {
+	assert := asrt.New(t)
+	o, store := newMemoryService(t)
+
+	// the second one is rejected, book 3 has nothing to pay with, so the whole batch is rolled back.
+	results, err := o.ApplyOperationBatch([]models.OperationRequest{
+		transfer("batch-fund-alice", "1", "2", "1"),
+		transfer("batch-bob-pays", "3", "2", "1"),
+	}, false)
+	assert.True(errors.Is(err, ErrBatchRolledBack))
+	assert.Equal(BatchOperationRolledBack, results[0].Status)
+	assert.Equal(string(models.OperationRejected), results[1].Status)
+	assert.Equal("0", balanceOf(t, store, "2"))
+
+	operation, err := store.GetOperation("batch-fund-alice", nil)
+	assert.NoError(err)
+	assert.Nil(operation)
+	assert.Empty(store.Events())
+
+	// with continueOnError, the rejected one is persisted as REJECTED, the other one is applied.
+	results, err = o.ApplyOperationBatch([]models.OperationRequest{
+		transfer("batch-fund-alice", "1", "2", "1"),
+		transfer("batch-bob-pays", "3", "2", "1"),
+	}, true)
+	assert.NoError(err)
+	assert.Equal(string(models.OperationApplied), results[0].Status)
+	assert.Equal(string(models.OperationRejected), results[1].Status)
+	assert.Equal("1", balanceOf(t, store, "2"))
+}
+
+func TestListOperationsWithMemoryStore(t *testing.T) {
+	assert := asrt.New(t)
+	o, _ := newMemoryService(t)
+
+	for _, op := range []models.OperationRequest{
+		transfer("fund-alice", "1", "2", "1"),
+		transfer("fund-bob", "1", "3", "1"),
+		transfer("alice-pays-bob", "2", "3", "0.5"),
+	} {
+		_, err := o.ApplyOperation(op)
+		assert.NoError(err)
+	}
+
+	page, cursor, err := o.ListOperations(models.OperationFilter{Limit: 2})
+	assert.NoError(err)
+	if assert.Len(page, 2) {
+		assert.Equal("alice-pays-bob", page[0]["memo"], "newest first")
+		assert.Equal("fund-bob", page[1]["memo"])
+	}
+	assert.NotEmpty(cursor)
+
+	beforeId, err := util.ParseCursor(cursor)
+	assert.NoError(err)
+	page, cursor, err = o.ListOperations(models.OperationFilter{Limit: 2, BeforeId: beforeId})
+	assert.NoError(err)
+	if assert.Len(page, 1) {
+		assert.Equal("fund-alice", page[0]["memo"])
+	}
+	assert.Empty(cursor, "last page")
+
+	page, _, err = o.ListOperations(models.OperationFilter{BookId: "2"})
+	assert.NoError(err)
+	assert.Len(page, 2)
+
+	_, _, err = o.ListOperations(models.OperationFilter{Status: "DONE"})
+	assert.True(errors.Is(err, ErrInvalidOperationQuery))
+	_, _, err = o.ListOperations(models.OperationFilter{MetadataValue: "42"})
+	assert.True(errors.Is(err, ErrInvalidOperationQuery))
+}
+
+func TestApplyOperationBatchReplayWithMemoryStore(t *testing.T) {
+	assert := asrt.New(t)
+	o, store := newMemoryService(t)
+
+	_, err := o.ApplyOperation(transfer("fund-alice", "1", "2", "1"))
+	assert.NoError(err)
+
+	results, err := o.ApplyOperationBatch([]models.OperationRequest{
+		transfer("fund-alice", "1", "2", "1"),
+		transfer("fund-bob", "1", "3", "1"),
+		transfer("bob-overpays", "3", "2", "5"),
+	}, false)
+	assert.True(errors.Is(err, ErrBatchRolledBack))
+	// the replay was applied before the batch, it's not rolled back with it.
+	assert.Equal(string(models.OperationApplied), results[0].Status)
+	assert.Equal(BatchOperationRolledBack, results[1].Status)
+	assert.Equal(string(models.OperationRejected), results[2].Status)
+	assert.Equal("1", balanceOf(t, store, "2"))
+	assert.Equal("0", balanceOf(t, store, "3"))
+}
@@ -1,26 +1,64 @@
 package operation_service
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/thoas/go-funk"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 
 	proto "general_ledger_golang/api/proto/code/go"
 
 	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/config"
+	"general_ledger_golang/pkg/database"
 	"general_ledger_golang/pkg/util"
+	"general_ledger_golang/service/auth_service"
 	"general_ledger_golang/service/book_service"
 )
 
+// InsufficientFundsReason prefixes the rejection reason of operations which would take a balance below
+// what the book's balance policy allows.
+const InsufficientFundsReason = "INSUFFICIENT_FUNDS"
+
+// ReversalMemoSuffix is appended to the memo of an operation to form the memo of its reversal.
+const ReversalMemoSuffix = "_REVERSAL"
+
+var (
+	ErrOperationNotFound        = errors.New("operation not found")
+	ErrOperationAlreadyReversed = errors.New("operation is already reversed")
+	ErrOperationNotApplied      = errors.New("only applied operations can be reversed")
+	ErrInvalidOperationQuery    = errors.New("invalid operation query")
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// OperationService works on the Postgres repositories, unless others (ex: models/memory) are set.
 type OperationService struct {
-	OperationRepository models.Operation
+	OperationRepository   models.OperationRepository
+	AssetRepository       models.AssetRepository
+	OutboxRepository      models.OutboxRepository
+	BookRepository        models.BookRepository
+	BookBalanceRepository models.BalanceRepository
+	PostingRepository     models.PostingRepository
+	Transactor            models.Transactor
+	// ServiceName is the calling service, the operations it applies should be in its scope (ServiceScopes).
+	// Empty for the ledger's own operations, which are not limited.
+	ServiceName string
 }
 
 func (o *OperationService) GetOperation(memo string, tx *gorm.DB) (map[string]interface{}, error) {
-	foundOp, err := o.OperationRepository.GetOperation(memo, tx)
+	foundOp, err := o.operations().GetOperation(memo, tx)
 	// If error, return error
 	if err != nil {
 		fmt.Printf("Fetching Operation Failed, error: %+v", err)
@@ -36,8 +74,62 @@ func (o *OperationService) GetOperation(memo string, tx *gorm.DB) (map[string]in
 	return nil, nil
 }
 
-// PostOperation op-> {type: '', memo:'', entries: [{bookId: '', assetId: '', value: ''}], metadata: {}}
-func (o *OperationService) PostOperation(op map[string]interface{}) (map[string]interface{}, error) {
+// ListOperations returns a page of operations matching the filter (newest first),
+// and the cursor for the next page, empty cursor if it's the last page.
+func (o *OperationService) ListOperations(filter models.OperationFilter) ([]map[string]interface{}, string, error) {
+	// a service limited to bookIds can only list the operations of one of its books.
+	auth := auth_service.Auth{ServiceName: o.ServiceName}
+	if filter.BookId != "" {
+		if err := auth.AuthorizeBook(auth_service.OperationsRead, filter.BookId); err != nil {
+			return nil, "", err
+		}
+	} else if err := auth.AuthorizeAllBooks(auth_service.OperationsRead); err != nil {
+		return nil, "", err
+	}
+	if filter.Status != "" && !funk.ContainsString([]string{
+		string(models.OperationInit),
+		string(models.OperationApplied),
+		string(models.OperationRejected),
+		string(models.OperationReversed),
+	}, filter.Status) {
+		return nil, "", fmt.Errorf("%w: unknown status %s", ErrInvalidOperationQuery, filter.Status)
+	}
+	if filter.MetadataKey == "" && filter.MetadataValue != "" {
+		return nil, "", fmt.Errorf("%w: metadataValue is given without metadataKey", ErrInvalidOperationQuery)
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, "", fmt.Errorf("%w: from should be before to", ErrInvalidOperationQuery)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultListLimit
+	}
+	if filter.Limit > MaxListLimit {
+		filter.Limit = MaxListLimit
+	}
+
+	limit := filter.Limit
+	// fetch one extra row, to know if there's a next page.
+	filter.Limit++
+	operations, err := o.operations().GetOperations(filter, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(operations) > limit {
+		operations = operations[:limit]
+		nextCursor = strconv.FormatUint(operations[limit-1].Id, 10)
+	}
+
+	result := make([]map[string]interface{}, 0, len(operations))
+	for _, operation := range operations {
+		result = append(result, util.StructToJSON(operation))
+	}
+	return result, nextCursor, nil
+}
+
+// PostOperation applies the operation, see ApplyOperation.
+func (o *OperationService) PostOperation(op models.OperationRequest) (map[string]interface{}, error) {
 	// This should call ApplyOperation
 	newOp, err := o.ApplyOperation(op)
 
@@ -49,125 +141,301 @@ func (o *OperationService) PostOperation(op map[string]interface{}) (map[string]
 	return opInterface, nil
 }
 
-func (o *OperationService) ApplyOperation(op map[string]interface{}) (map[string]interface{}, error) {
-	db, _ := models.GetDB()
+func (o *OperationService) ApplyOperation(op models.OperationRequest) (map[string]interface{}, error) {
+	var result map[string]interface{}
 
-	var newOp *models.Operation
-
-	existingOp, err := o.GetOperation(op["memo"].(string), nil)
+	// the whole trx is retried on transient failures (serialization failure, deadlock, lock not available).
+	err := database.GetRetryPolicy().Run("ApplyOperation", func() error {
+		return o.transactor().Transaction(nil, func(tx *gorm.DB) error {
+			// return nil commits trx, return error will roll back transaction
+			var err error
+			result, err = o.ApplyOperationInTx(op, tx)
+			return err
+		})
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	if existingOp != nil {
-		return existingOp, nil
+	return result, nil
+}
+
+// ApplyOperationInTx does the actual work of ApplyOperation inside the given transaction, so that callers
+// which need to apply an operation along with other changes (ex: reversals, hold captures) can share the same trx.
+// A malformed operation returns an error wrapping models.ErrInvalidOperation, nothing is persisted for it.
+func (o *OperationService) ApplyOperationInTx(op models.OperationRequest, tx *gorm.DB) (map[string]interface{}, error) {
+	applied, _, err := o.applyOperationInTx(op, tx)
+	return applied, err
+}
+
+// applyOperationInTx is ApplyOperationInTx, created tells if the operation was created by this call,
+// false if an operation with the memo already existed (a replay).
+func (o *OperationService) applyOperationInTx(op models.OperationRequest, tx *gorm.DB) (map[string]interface{}, bool, error) {
+	if err := op.Validate(); err != nil {
+		return nil, false, err
 	}
-	bS := book_service.BookService{}
 
-	// TODO: Maybe create rejected status in case of non_negative_balance as well, to have a better insight.
-	// This memo will not be further tried, as ledger is meant to be idempotent, a new memo should be created with correct bookIds.
+	// checked before the idempotency lookup, a service shouldn't read operations it can't apply.
+	if err := o.authorize(op); err != nil {
+		return nil, false, err
+	}
 
-	deepCopiedOp := util.DeepCopyMap(op)
+	existingOp, err := o.operations().GetOperation(op.Memo, tx)
 
-	err = db.Transaction(func(tx *gorm.DB) error {
-		// do some database operations in the transaction (use 'tx' from this point, not 'db')
-		// apply operation with retries
-		// return nil commits trx, return error will roll back transaction
-		op["status"] = string(models.OperationInit)
+	if err != nil {
+		return nil, false, err
+	}
 
-		newOp, err = o.applyOperationWithRetries(op, tx, 0)
+	if existingOp != nil {
+		// same memo must mean the same operation, a different payload is a client bug, not a retry.
+		fields, err := differingFields(op, existingOp)
 		if err != nil {
-			return err
+			return nil, false, err
 		}
-
-		bookIds := funk.Map(deepCopiedOp["entries"], func(entry interface{}) string {
-			e := entry.(map[string]interface{})
-			id := e["bookId"]
-			if reflect.TypeOf(id).Kind() != reflect.String {
-				return ""
-			}
-			return id.(string)
-		})
-		ok, e := bS.CheckBookExists(bookIds.([]string), tx)
-
-		if !ok {
-			op["status"] = string(models.OperationRejected)
-			op["rejectionReason"] = e.Error()
-			_, err = o.UpdateOperation(op, tx)
-			// update newOp as that will get returned to the user.
-			newOp.Status = string(models.OperationRejected)
-			newOp.RejectionReason = e.Error()
-			if err != nil {
-				return err
-			}
-			// return nil to create rejected operation
-			return nil
+		if len(fields) > 0 {
+			return nil, false, fmt.Errorf("%w, memo: %s, differing fields: %s", ErrIdempotencyConflict, op.Memo, strings.Join(fields, ", "))
 		}
+		return util.StructToJSON(existingOp), false, nil
+	}
+	bS := book_service.BookService{BookRepository: o.BookRepository, BookBalanceRepository: o.BookBalanceRepository}
 
-		postings := &models.Posting{}
+	operation, err := op.ToOperation()
+	if err != nil {
+		return nil, false, err
+	}
+	operation.Status = string(models.OperationInit)
+	operation.Fingerprint = Fingerprint(op)
 
-		err = postings.BulkCreatePosting(deepCopiedOp["entries"].([]interface{}), tx, newOp.Id, newOp.Metadata)
-		if err != nil {
-			return err
-		}
+	newOp, err := o.operations().CreateOperation(operation, tx)
+	if err != nil {
+		return nil, false, err
+	}
 
-		// create Book balance here, if the balance goes below 0, then rollBack the trx. else proceed
-		err = bS.BookBalanceRepository.ModifyBalance(deepCopiedOp, tx)
-		if err != nil {
-			return err
+	// double entry: unless it's a mint/burn operation, money can only move between books, never appear or vanish.
+	if !isMintBurnOperation(op) {
+		if unbalanced := unbalancedAssets(op.Entries); len(unbalanced) > 0 {
+			reason := fmt.Sprintf("entries don't sum to zero for assets: %s", strings.Join(unbalanced, ", "))
+			return o.reject(newOp, reason, tx)
 		}
+	}
 
-		newOp.Status = string(models.OperationApplied)
-		op["status"] = string(models.OperationApplied)
-		newOp.UpdatedAt = time.Time{}
+	// only registered assets can be moved, and only with values that fit the asset's scale and limits.
+	problems, err := models.ValidateEntries(o.assets(), op.Entries, tx)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(problems) > 0 {
+		return o.reject(newOp, strings.Join(problems, "; "), tx)
+	}
 
-		err = o.OperationRepository.UpdateOperation(op, tx)
+	ok, e := bS.CheckBookExists(op.BookIds(), tx)
+
+	if !ok {
+		return o.reject(newOp, e.Error(), tx)
+	}
+
+	// postings and balances go in a savepoint, so that if a balance goes below what the book's balance policy allows,
+	// only those are rolled back and the operation is persisted as REJECTED. This memo will not be further tried,
+	// as ledger is meant to be idempotent, a new memo should be created once the book has enough balance.
+	err = o.transactor().Transaction(tx, func(sp *gorm.DB) error {
+		err := o.postings().BulkCreatePosting(op.Entries, sp, newOp.Id, newOp.Metadata)
 		if err != nil {
 			return err
 		}
 
-		return nil // commits the transaction
+		return o.balances().ModifyBalance(op, sp)
 	})
 
+	var insufficientBalance *models.InsufficientBalanceError
+	if errors.As(err, &insufficientBalance) {
+		reason := fmt.Sprintf("%s: %s", InsufficientFundsReason, insufficientBalance.Reason())
+		return o.reject(newOp, reason, tx)
+	}
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	opInterface := util.StructToJSON(*newOp)
-	return opInterface, nil
+	newOp.Status = string(models.OperationApplied)
+	newOp.UpdatedAt = time.Time{}
+
+	err = o.operations().UpdateOperation(newOp, tx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	applied := util.StructToJSON(*newOp)
+	if err = o.recordOperationEvents(applied, op.Entries, tx); err != nil {
+		return nil, false, err
+	}
+	return applied, true, nil
+}
+
+// IsInsufficientFunds tells if the operation was rejected as a book didn't have enough balance.
+func IsInsufficientFunds(op map[string]interface{}) bool {
+	reason, _ := op["rejectionReason"].(string)
+	return op["status"] == string(models.OperationRejected) && strings.HasPrefix(reason, InsufficientFundsReason)
 }
 
-func (o *OperationService) UpdateOperation(op map[string]interface{}, tx *gorm.DB) (map[string]interface{}, error) {
-	var db *gorm.DB
+// reject marks the operation REJECTED with the given reason. Caller should return without error,
+// so that the rejected operation gets persisted when the trx commits. The operation is one applyOperationInTx
+// created, so created is true, unless it errors out.
+func (o *OperationService) reject(newOp *models.Operation, reason string, tx *gorm.DB) (map[string]interface{}, bool, error) {
+	// newOp gets returned to the user as well.
+	newOp.Status = string(models.OperationRejected)
+	newOp.RejectionReason = reason
+	err := o.operations().UpdateOperation(newOp, tx)
+	if err != nil {
+		return nil, false, err
+	}
 
-	if tx != nil {
-		db = tx
-	} else {
-		db, _ = models.GetDB()
+	rejected := util.StructToJSON(*newOp)
+	if err = o.recordOperationEvents(rejected, nil, tx); err != nil {
+		return nil, false, err
 	}
+	return rejected, true, nil
+}
 
-	// update operation
-	r := db.Model(&o.OperationRepository).Where("memo = ?", op["memo"]).Updates(op)
-	if r.Error != nil {
-		return nil, r.Error
+// isMintBurnOperation checks if the operation type (metadata["operation"]) is configured as mint/burn,
+// such operations are exempted from the zero sum check.
+func isMintBurnOperation(op models.OperationRequest) bool {
+	operationType := op.OperationType()
+	if operationType == "" {
+		return false
 	}
-	return op, nil
+	return funk.ContainsString(config.GetLedgerSetting().MintBurnOperationTypes, operationType)
 }
 
-func (o *OperationService) applyOperationWithRetries(op map[string]interface{}, tx *gorm.DB, rC int) (*models.Operation, error) {
-	newOp, err := o.OperationRepository.CreateOperation(op, tx)
-	totalRetryCount, currRetryCount := rC, 0
+// AuthorizeRead checks the books of the operation (as returned by GetOperation) against the scope of
+// the calling service, for reads.
+func (o *OperationService) AuthorizeRead(operation map[string]interface{}) error {
+	var bookIds []string
+	entries, _ := operation["entries"].([]interface{})
+	for _, entry := range entries {
+		if entryMap, ok := entry.(map[string]interface{}); ok {
+			bookIds = append(bookIds, fmt.Sprint(entryMap["bookId"]))
+		}
+	}
+	auth := auth_service.Auth{ServiceName: o.ServiceName}
+	return auth.AuthorizeBooks(auth_service.OperationsRead, bookIds)
+}
 
-	for currRetryCount < totalRetryCount && err != nil {
-		newOp, err = o.OperationRepository.CreateOperation(op, tx)
-		currRetryCount++
+// authorize checks the operation's type and books against the scope of the calling service.
+func (o *OperationService) authorize(op models.OperationRequest) error {
+	if o.ServiceName == "" {
+		return nil
 	}
+	auth := auth_service.Auth{ServiceName: o.ServiceName}
+	return auth.AuthorizeOperation(op.OperationType(), op.BookIds())
+}
+
+// unbalancedAssets sums the entry values per assetId, and returns the assets (along with the sum)
+// for which the sum is not zero. Sorted by assetId, to have a stable rejection reason.
+func unbalancedAssets(entries []models.Entry) []string {
+	sums := map[string]decimal.Decimal{}
+	for _, entry := range entries {
+		sums[entry.AssetId] = sums[entry.AssetId].Add(entry.Value)
+	}
+
+	var unbalanced []string
+	for assetId, sum := range sums {
+		if !sum.IsZero() {
+			unbalanced = append(unbalanced, fmt.Sprintf("%s (sum: %s)", assetId, sum.String()))
+		}
+	}
+	sort.Strings(unbalanced)
+
+	return unbalanced
+}
+
+// ReverseOperation undoes an applied operation by posting a compensating operation, whose entries
+// negate the original entries. The compensating operation's metadata carries `reversalOf` and the original
+// operation is marked REVERSED with `reversedBy` in its metadata, all inside the same transaction.
+//
+// An operation can be reversed only once, and only if it was applied.
+func (o *OperationService) ReverseOperation(memo, reason string) (map[string]interface{}, error) {
+	var reversalOp map[string]interface{}
+
+	err := database.GetRetryPolicy().Run("ReverseOperation", func() error {
+		return o.transactor().Transaction(nil, func(tx *gorm.DB) error {
+			// lock the original, so that two concurrent reversals of the same memo can't both go through.
+			original, err := o.operations().GetOperationForUpdate(memo, tx)
+			if err != nil {
+				return err
+			}
+			if original == nil {
+				return ErrOperationNotFound
+			}
+
+			switch models.Status(original.Status) {
+			case models.OperationApplied:
+			case models.OperationReversed:
+				return ErrOperationAlreadyReversed
+			default:
+				return ErrOperationNotApplied
+			}
+
+			op, err := reversalOf(original, reason)
+			if err != nil {
+				return err
+			}
+
+			taken, err := o.GetOperation(op.Memo, tx)
+			if err != nil {
+				return err
+			}
+			if taken != nil {
+				return fmt.Errorf("memo %s, needed for the reversal, is already used by another operation", op.Memo)
+			}
+
+			reversalOp, err = o.ApplyOperationInTx(op, tx)
+			if err != nil {
+				return err
+			}
+			if reversalOp["status"] != string(models.OperationApplied) {
+				// roll back, the original should stay as is when the reversal couldn't be applied.
+				return fmt.Errorf("reversal of %s was rejected, reason: %v", memo, reversalOp["rejectionReason"])
+			}
+
+			metadata := map[string]interface{}{}
+			if len(original.Metadata) > 0 {
+				if err = util.UnmarshalUseNumber(original.Metadata, &metadata); err != nil {
+					return err
+				}
+			}
+			metadata["reversedBy"] = op.Memo
+			metadataBytes, _ := json.Marshal(metadata)
+
+			original.Status = string(models.OperationReversed)
+			original.Metadata = datatypes.JSON(metadataBytes)
+			return o.operations().UpdateOperation(original, tx)
+		})
+	})
 
 	if err != nil {
 		return nil, err
 	}
-	return newOp, nil
+
+	return reversalOp, nil
+}
+
+// reversalOf builds the compensating operation for the original operation.
+// Every entry's value is negated, type and metadata (thus metadata["operation"]) are kept as is,
+// so that the same balances get reverted.
+func reversalOf(original *models.Operation, reason string) (models.OperationRequest, error) {
+	op, err := models.OperationRequestOf(original)
+	if err != nil {
+		return op, err
+	}
+
+	for i := range op.Entries {
+		op.Entries[i].Value = op.Entries[i].Value.Neg()
+	}
+	op.Memo = original.Memo + ReversalMemoSuffix
+	op.Metadata["reversalOf"] = original.Memo
+	op.Metadata["reversalReason"] = reason
+
+	return op, nil
 }
 
 func (o *OperationService) EntryInterfaceToProtoEntries(entries interface{}) ([]*proto.Entries, error) {
@@ -191,19 +459,20 @@ func (o *OperationService) EntryInterfaceToProtoEntries(entries interface{}) ([]
 	return protoEntries, nil
 }
 
-func (o *OperationService) ProtoEntriesToEntryInterface(entries []*proto.Entries) []interface{} {
-	if len(entries) < 1 {
-		return []interface{}{}
-	}
-	var resultMap []interface{}
-	for i := 0; i < len(entries); i++ {
-		protoEntry := entries[i]
-		mapEntry := map[string]interface{}{
-			"bookId":  protoEntry.BookId,
-			"assetId": protoEntry.AssetId,
-			"value":   protoEntry.Value,
+// ProtoEntriesToEntries reads the entries of a grpc request, a value which is not a number
+// returns an error wrapping models.ErrInvalidOperation.
+func (o *OperationService) ProtoEntriesToEntries(entries []*proto.Entries) ([]models.Entry, error) {
+	result := make([]models.Entry, 0, len(entries))
+	for i, protoEntry := range entries {
+		value, err := decimal.NewFromString(protoEntry.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: value %q of entries[%d] is not a number", models.ErrInvalidOperation, protoEntry.Value, i)
 		}
-		resultMap = append(resultMap, mapEntry)
+		result = append(result, models.Entry{
+			BookId:  protoEntry.BookId,
+			AssetId: protoEntry.AssetId,
+			Value:   value,
+		})
 	}
-	return resultMap
+	return result, nil
 }
@@ -0,0 +1,157 @@
+package operation_service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	asrt "github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+
+	"general_ledger_golang/models"
+)
+
+func TestReversalOf(t *testing.T) {
+	assert := asrt.New(t)
+
+	original := &models.Operation{
+		Type:     "TRANSFER",
+		Memo:     "MEMO_1",
+		Entries:  datatypes.JSON(`[{"bookId":"4","assetId":"btc","value":"-1.5"},{"bookId":"3","assetId":"btc","value":"1.5"}]`),
+		Status:   string(models.OperationApplied),
+		Metadata: datatypes.JSON(`{"operation":"BLOCK"}`),
+	}
+
+	op, err := reversalOf(original, "blocked by mistake")
+	assert.Nil(err)
+	assert.Equal("MEMO_1"+ReversalMemoSuffix, op.Memo)
+	assert.Equal("TRANSFER", op.Type)
+
+	entriesBytes, _ := json.Marshal(op.Entries)
+	assert.JSONEq(`[{"bookId":"4","assetId":"btc","value":"1.5"},{"bookId":"3","assetId":"btc","value":"-1.5"}]`, string(entriesBytes))
+
+	assert.Equal("BLOCK", op.OperationType())
+	assert.Equal("MEMO_1", op.Metadata["reversalOf"])
+	assert.Equal("blocked by mistake", op.Metadata["reversalReason"])
+
+	original.Entries = datatypes.JSON(`[{"bookId":"4","assetId":"btc","value":"abc"}]`)
+	_, err = reversalOf(original, "blocked by mistake")
+	assert.ErrorIs(err, models.ErrInvalidOperation)
+}
+
+func entry(bookId, assetId, value string) models.Entry {
+	return models.Entry{BookId: bookId, AssetId: assetId, Value: decimal.RequireFromString(value)}
+}
+
+func TestUnbalancedAssets(t *testing.T) {
+	assert := asrt.New(t)
+
+	t.Run("Balanced_Entries", func(t *testing.T) {
+		unbalanced := unbalancedAssets([]models.Entry{
+			entry("1", "btc", "-0.00000001"),
+			entry("4", "btc", "0.00000001"),
+			entry("4", "inr", "-100"),
+			entry("3", "inr", "60.5"),
+			entry("2", "inr", "39.5"),
+		})
+		assert.Empty(unbalanced)
+	})
+
+	t.Run("Unbalanced_Entries", func(t *testing.T) {
+		unbalanced := unbalancedAssets([]models.Entry{
+			entry("4", "inr", "100"),
+			entry("1", "btc", "-1"),
+			entry("3", "btc", "1"),
+		})
+		assert.Equal([]string{"inr (sum: 100)"}, unbalanced)
+	})
+}
+
+func TestIsMintBurnOperation(t *testing.T) {
+	assert := asrt.New(t)
+	// no config is set up, so no operation type is mint/burn.
+	assert.False(isMintBurnOperation(models.OperationRequest{
+		Metadata: map[string]interface{}{"operation": "DEPOSIT"},
+	}))
+	assert.False(isMintBurnOperation(models.OperationRequest{}))
+}
+
+func TestFingerprint(t *testing.T) {
+	assert := asrt.New(t)
+
+	op := models.OperationRequest{
+		Type:     "TRANSFER",
+		Memo:     "MEMO_1",
+		Entries:  []models.Entry{entry("4", "btc", "-1.5"), entry("3", "btc", "1.5")},
+		Metadata: map[string]interface{}{"operation": "BLOCK", "note": "x"},
+	}
+	// same payload, written differently: entries reordered, decimals with trailing zeros, numeric bookIds.
+	same, err := models.NewOperationRequest(map[string]interface{}{
+		"type": "TRANSFER",
+		"memo": "MEMO_1",
+		"entries": []interface{}{
+			map[string]interface{}{"assetId": "btc", "bookId": 3, "value": "1.50"},
+			map[string]interface{}{"assetId": "btc", "bookId": "4", "value": -1.500},
+		},
+		"metadata": map[string]interface{}{"note": "x", "operation": "BLOCK"},
+	})
+	assert.Nil(err)
+	assert.Equal(Fingerprint(op), Fingerprint(same))
+
+	existing := &models.Operation{
+		Type:        "TRANSFER",
+		Memo:        "MEMO_1",
+		Entries:     datatypes.JSON(`[{"bookId":"4","assetId":"btc","value":"-1.5"},{"bookId":"3","assetId":"btc","value":"1.5"}]`),
+		Metadata:    datatypes.JSON(`{"operation":"BLOCK","note":"x","reversedBy":"MEMO_1_REVERSAL"}`),
+		Fingerprint: Fingerprint(op),
+	}
+	fields, err := differingFields(same, existing)
+	assert.Nil(err)
+	assert.Empty(fields)
+
+	different := same.Copy()
+	different.Type = "TRADE"
+	different.Entries[0].Value = decimal.RequireFromString("2")
+	fields, err = differingFields(different, existing)
+	assert.Nil(err)
+	assert.Equal([]string{"type", "entries"}, fields)
+	// the copy is modified, not the original.
+	assert.Equal("1.5", same.Entries[0].Value.String())
+
+	// operations created before fingerprints are compared field by field.
+	existing.Fingerprint = ""
+	fields, err = differingFields(same, existing)
+	assert.Nil(err)
+	assert.Empty(fields)
+}
+
+func TestEntryChanges(t *testing.T) {
+	assert := asrt.New(t)
+
+	changes := entryChanges([]models.Entry{
+		entry("4", "btc", "-1"),
+		entry("3", "btc", "0.5"),
+		entry("3", "btc", "0.5"),
+		entry("3", "inr", "0"),
+	})
+	if assert.Len(changes, 3) {
+		assert.Equal("3", changes[0].bookId)
+		assert.Equal("1", changes[0].value.String())
+		assert.Equal("inr", changes[1].assetId)
+		assert.Equal("4", changes[2].bookId)
+	}
+}
+
+func TestIsInsufficientFunds(t *testing.T) {
+	assert := asrt.New(t)
+
+	assert.True(IsInsufficientFunds(map[string]interface{}{
+		"status":          string(models.OperationRejected),
+		"rejectionReason": InsufficientFundsReason + ": book 4 btc balance would be -1, below its STRICT limit of 0",
+	}))
+	assert.False(IsInsufficientFunds(map[string]interface{}{
+		"status":          string(models.OperationRejected),
+		"rejectionReason": "entries don't sum to zero for assets: btc (sum: 1)",
+	}))
+	assert.False(IsInsufficientFunds(map[string]interface{}{"status": string(models.OperationApplied)}))
+}
@@ -0,0 +1,49 @@
+package operation_service
+
+import (
+	"general_ledger_golang/models"
+)
+
+// the repositories of the service, Postgres ones for the unset fields.
+
+func (o *OperationService) operations() models.OperationRepository {
+	if o.OperationRepository == nil {
+		return &models.Operation{}
+	}
+	return o.OperationRepository
+}
+
+func (o *OperationService) assets() models.AssetRepository {
+	if o.AssetRepository == nil {
+		return &models.Asset{}
+	}
+	return o.AssetRepository
+}
+
+func (o *OperationService) outbox() models.OutboxRepository {
+	if o.OutboxRepository == nil {
+		return &models.OutboxEvent{}
+	}
+	return o.OutboxRepository
+}
+
+func (o *OperationService) balances() models.BalanceRepository {
+	if o.BookBalanceRepository == nil {
+		return &models.BookBalance{}
+	}
+	return o.BookBalanceRepository
+}
+
+func (o *OperationService) postings() models.PostingRepository {
+	if o.PostingRepository == nil {
+		return &models.Posting{}
+	}
+	return o.PostingRepository
+}
+
+func (o *OperationService) transactor() models.Transactor {
+	if o.Transactor == nil {
+		return models.DBTransactor{}
+	}
+	return o.Transactor
+}
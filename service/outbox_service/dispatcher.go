@@ -0,0 +1,236 @@
+package outbox_service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/config"
+	"general_ledger_golang/pkg/logger"
+)
+
+const (
+	defaultMaxAttempts = 10
+	defaultBaseDelay   = time.Second
+	defaultMaxDelay    = 10 * time.Minute
+	defaultTimeout     = 5 * time.Second
+	defaultBatchSize   = 50
+	// errorBodyLimit is how much of a failed response's body is kept in lastError.
+	errorBodyLimit = 256
+)
+
+// Headers of a webhook delivery. Deliveries are at least once, receivers should dedupe on X-Ledger-Event-Id.
+const (
+	HeaderEventId   = "X-Ledger-Event-Id"
+	HeaderEventType = "X-Ledger-Event-Type"
+	HeaderTimestamp = "X-Ledger-Timestamp"
+	HeaderSignature = "X-Ledger-Signature"
+)
+
+// Delivery is the body POSTed to the webhooks.
+type Delivery struct {
+	Id          uint64          `json:"id"`
+	Type        string          `json:"type"`
+	AggregateId string          `json:"aggregateId"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// Dispatcher delivers the pending outbox events to the webhook URLs, signed with Secret.
+// A failed delivery is retried with exponential backoff, up to MaxAttempts, then the event is marked DEAD.
+// It works on the Postgres repositories, unless others (ex: models/memory) are set.
+type Dispatcher struct {
+	OutboxRepository models.OutboxRepository
+	Transactor       models.Transactor
+	URLs             []string
+	Secret           string
+	MaxAttempts      int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	BatchSize        int
+	Client           *http.Client
+}
+
+// NewDispatcher returns a dispatcher configured with the webhook section of the config, with defaults for unset values.
+func NewDispatcher(setting *config.Webhook) *Dispatcher {
+	d := &Dispatcher{
+		URLs:        setting.URLs,
+		Secret:      setting.Secret,
+		MaxAttempts: setting.MaxAttempts,
+		BaseDelay:   setting.BaseDelay,
+		MaxDelay:    setting.MaxDelay,
+		BatchSize:   setting.BatchSize,
+		Client:      &http.Client{Timeout: setting.Timeout},
+	}
+	if d.MaxAttempts <= 0 {
+		d.MaxAttempts = defaultMaxAttempts
+	}
+	if d.BaseDelay <= 0 {
+		d.BaseDelay = defaultBaseDelay
+	}
+	if d.MaxDelay <= 0 {
+		d.MaxDelay = defaultMaxDelay
+	}
+	if d.BatchSize <= 0 {
+		d.BatchSize = defaultBatchSize
+	}
+	if d.Client.Timeout <= 0 {
+		d.Client.Timeout = defaultTimeout
+	}
+	return d
+}
+
+// Start dispatches the due events every interval, it's blocking, so call it with a go-routine.
+func (d *Dispatcher) Start(interval time.Duration) {
+	if interval <= 0 || len(d.URLs) == 0 {
+		logger.Logger.Infof("Webhook dispatcher is disabled")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// keep going while full batches are claimed, there's a backlog.
+		for {
+			claimed, err := d.DispatchDue()
+			if err != nil {
+				logger.Logger.Errorf("Dispatching outbox events failed, error: %+v", err)
+			}
+			if err != nil || claimed < d.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// DispatchDue claims a batch of due events and delivers those, one by one, in id order.
+// Returns the number of events claimed.
+func (d *Dispatcher) DispatchDue() (int, error) {
+	// the claim is held for as long as delivering the whole batch can take, if this dispatcher dies meanwhile,
+	// the events become due again after it.
+	lease := d.Client.Timeout * time.Duration(len(d.URLs)*d.BatchSize+1)
+
+	var events []models.OutboxEvent
+	err := d.transactor().Transaction(nil, func(tx *gorm.DB) error {
+		var err error
+		events, err = d.outbox().ClaimDueEvents(time.Now(), lease, d.BatchSize, tx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range events {
+		event := &events[i]
+		d.settle(event, d.deliver(event), time.Now())
+
+		log := logger.Logger.WithFields(logrus.Fields{
+			"eventId":   event.Id,
+			"eventType": event.EventType,
+			"attempts":  event.Attempts,
+			"status":    event.Status,
+		})
+		switch event.Status {
+		case string(models.OutboxDead):
+			log.Errorf("Webhook delivery failed, event is dead, error: %s", event.LastError)
+		case string(models.OutboxPending):
+			log.Warnf("Webhook delivery failed, retrying at %s, error: %s", event.NextAttemptAt.Format(time.RFC3339), event.LastError)
+		}
+
+		if err = d.outbox().UpdateDelivery(event, nil); err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+// deliver POSTs the event to every URL, it fails if any of them doesn't respond with 2xx.
+// On a retry, the event goes to every URL again.
+func (d *Dispatcher) deliver(event *models.OutboxEvent) error {
+	body, err := json.Marshal(Delivery{
+		Id:          event.Id,
+		Type:        event.EventType,
+		AggregateId: event.AggregateId,
+		CreatedAt:   event.CreatedAt,
+		Data:        json.RawMessage(event.Payload),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, url := range d.URLs {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(HeaderEventId, strconv.FormatUint(event.Id, 10))
+		req.Header.Set(HeaderEventType, event.EventType)
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderSignature, Sign(d.Secret, timestamp, body))
+
+		res, err := d.Client.Do(req)
+		if err != nil {
+			return fmt.Errorf("%s: %w", url, err)
+		}
+		resBody, _ := io.ReadAll(io.LimitReader(res.Body, errorBodyLimit))
+		res.Body.Close()
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return fmt.Errorf("%s: responded with %d, body: %s", url, res.StatusCode, string(resBody))
+		}
+	}
+	return nil
+}
+
+// settle updates the delivery state of the event after an attempt, which failed if err is not nil.
+func (d *Dispatcher) settle(event *models.OutboxEvent, err error, now time.Time) {
+	event.Attempts++
+	if err == nil {
+		event.Status = string(models.OutboxDelivered)
+		event.LastError = ""
+		event.DeliveredAt = &now
+		return
+	}
+
+	event.LastError = err.Error()
+	if event.Attempts >= d.MaxAttempts {
+		event.Status = string(models.OutboxDead)
+		return
+	}
+	event.NextAttemptAt = now.Add(d.backoff(event.Attempts))
+}
+
+// backoff returns the delay after the given number of failed attempts, BaseDelay * 2^(attempts-1), capped at MaxDelay.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay
+}
+
+// Sign returns the signature of a delivery, the hex HMAC-SHA256 of `<timestamp>.<body>` with secret.
+// Receivers should recompute it, compare with hmac.Equal and reject old timestamps.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,126 @@
+package outbox_service
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	asrt "github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/models/memory"
+	"general_ledger_golang/pkg/config"
+)
+
+func TestDispatcherDeliver(t *testing.T) {
+	assert := asrt.New(t)
+
+	var received []Delivery
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature := Sign("secret", r.Header.Get(HeaderTimestamp), body)
+		if !hmac.Equal([]byte(signature), []byte(r.Header.Get(HeaderSignature))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("try later"))
+			return
+		}
+		delivery := Delivery{}
+		_ = json.Unmarshal(body, &delivery)
+		received = append(received, delivery)
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(&config.Webhook{URLs: []string{server.URL}, Secret: "secret", MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 3 * time.Second})
+	event := &models.OutboxEvent{
+		Model:       models.Model{Id: 7},
+		EventType:   models.EventOperationApplied,
+		AggregateId: "memo-1",
+		Payload:     datatypes.JSON(`{"memo":"memo-1","status":"APPLIED"}`),
+		Status:      string(models.OutboxPending),
+	}
+	now := time.Now()
+
+	err := d.deliver(event)
+	assert.ErrorContains(err, "responded with 503, body: try later")
+	d.settle(event, err, now)
+	assert.Equal(string(models.OutboxPending), event.Status)
+	assert.Equal(1, event.Attempts)
+	assert.Equal(now.Add(time.Second), event.NextAttemptAt)
+
+	d.settle(event, err, now)
+	assert.Equal(now.Add(2*time.Second), event.NextAttemptAt)
+
+	failing = false
+	err = d.deliver(event)
+	assert.NoError(err)
+	d.settle(event, err, now)
+	assert.Equal(string(models.OutboxDelivered), event.Status)
+	assert.Equal(3, event.Attempts)
+	assert.Equal("", event.LastError)
+	if assert.Len(received, 1) {
+		assert.Equal(uint64(7), received[0].Id)
+		assert.Equal(models.EventOperationApplied, received[0].Type)
+		assert.JSONEq(`{"memo":"memo-1","status":"APPLIED"}`, string(received[0].Data))
+	}
+
+	// a wrong secret is rejected by the receiver, after MaxAttempts the event is dead.
+	d.Secret = "wrong"
+	event = &models.OutboxEvent{Model: models.Model{Id: 8}, Payload: datatypes.JSON(`{}`), Status: string(models.OutboxPending)}
+	for i := 0; i < 3; i++ {
+		d.settle(event, d.deliver(event), now)
+	}
+	assert.Equal(string(models.OutboxDead), event.Status)
+	assert.Contains(event.LastError, "responded with 401")
+}
+
+func TestDispatcherBackoff(t *testing.T) {
+	assert := asrt.New(t)
+
+	d := &Dispatcher{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	assert.Equal(time.Second, d.backoff(1))
+	assert.Equal(4*time.Second, d.backoff(3))
+	assert.Equal(10*time.Second, d.backoff(5))
+	assert.Equal(10*time.Second, d.backoff(50))
+}
+
+func TestDispatchDue(t *testing.T) {
+	assert := asrt.New(t)
+
+	delivered := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered++
+	}))
+	defer server.Close()
+
+	store := memory.New()
+	due, _ := models.NewOutboxEvent(models.EventOperationApplied, "memo-1", map[string]string{"memo": "memo-1"})
+	later, _ := models.NewOutboxEvent(models.EventOperationApplied, "memo-2", map[string]string{"memo": "memo-2"})
+	later.NextAttemptAt = time.Now().Add(time.Hour)
+	assert.NoError(store.CreateEvents([]models.OutboxEvent{due, later}, nil))
+
+	d := NewDispatcher(&config.Webhook{URLs: []string{server.URL}, Secret: "secret"})
+	d.OutboxRepository, d.Transactor = store, store
+	claimed, err := d.DispatchDue()
+	assert.NoError(err)
+	assert.Equal(1, claimed)
+	assert.Equal(1, delivered)
+
+	events := store.Events()
+	assert.Equal(string(models.OutboxDelivered), events[0].Status)
+	assert.Equal(string(models.OutboxPending), events[1].Status)
+
+	// nothing is due anymore.
+	claimed, err = d.DispatchDue()
+	assert.NoError(err)
+	assert.Equal(0, claimed)
+}
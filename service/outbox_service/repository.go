@@ -0,0 +1,42 @@
+package outbox_service
+
+import (
+	"general_ledger_golang/models"
+)
+
+// the repositories of the dispatcher, sequencer and watcher, Postgres ones for the unset fields.
+
+func (d *Dispatcher) outbox() models.OutboxRepository {
+	if d.OutboxRepository == nil {
+		return &models.OutboxEvent{}
+	}
+	return d.OutboxRepository
+}
+
+func (d *Dispatcher) transactor() models.Transactor {
+	if d.Transactor == nil {
+		return models.DBTransactor{}
+	}
+	return d.Transactor
+}
+
+func (s *EventSequencer) outbox() models.OutboxRepository {
+	if s.OutboxRepository == nil {
+		return &models.OutboxEvent{}
+	}
+	return s.OutboxRepository
+}
+
+func (s *EventSequencer) transactor() models.Transactor {
+	if s.Transactor == nil {
+		return models.DBTransactor{}
+	}
+	return s.Transactor
+}
+
+func (w *BalanceWatcher) outbox() models.OutboxRepository {
+	if w.OutboxRepository == nil {
+		return &models.OutboxEvent{}
+	}
+	return w.OutboxRepository
+}
@@ -0,0 +1,54 @@
+package outbox_service
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/logger"
+)
+
+// sequenceBatchSize is how many events are sequenced per trx.
+const sequenceBatchSize = 1000
+
+// EventSequencer sets the commit order sequence of the outbox events, which the balance watches stream in.
+// Any number of them can run, only one sequences at a time. It works on the Postgres repositories, unless others
+// (ex: models/memory) are set.
+type EventSequencer struct {
+	OutboxRepository models.OutboxRepository
+	Transactor       models.Transactor
+}
+
+// Start sequences the committed events every interval, it's blocking, so call it with a go-routine.
+func (s *EventSequencer) Start(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultWatchPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// keep going while full batches are sequenced, there's a backlog.
+		for {
+			sequenced, err := s.SequenceCommitted()
+			if err != nil {
+				logger.Logger.Errorf("Sequencing outbox events failed, error: %+v", err)
+			}
+			if err != nil || sequenced < sequenceBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// SequenceCommitted sequences a batch of the committed events, returns the number of events sequenced.
+func (s *EventSequencer) SequenceCommitted() (int, error) {
+	var sequenced int
+	err := s.transactor().Transaction(nil, func(tx *gorm.DB) error {
+		var err error
+		sequenced, err = s.outbox().SequenceEvents(sequenceBatchSize, tx)
+		return err
+	})
+	return sequenced, err
+}
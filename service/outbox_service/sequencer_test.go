@@ -0,0 +1,39 @@
+package outbox_service
+
+import (
+	"testing"
+
+	asrt "github.com/stretchr/testify/assert"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/models/memory"
+)
+
+func TestSequenceCommitted(t *testing.T) {
+	assert := asrt.New(t)
+
+	store := memory.New()
+	first, _ := models.NewOutboxEvent(models.EventBalanceChanged, "2", models.BalanceChangedPayload{BookId: "2", AssetId: "btc"})
+	second, _ := models.NewOutboxEvent(models.EventBalanceChanged, "3", models.BalanceChangedPayload{BookId: "3", AssetId: "btc"})
+	assert.NoError(store.CreateEvents([]models.OutboxEvent{first, second}, nil))
+
+	s := &EventSequencer{OutboxRepository: store, Transactor: store}
+	sequenced, err := s.SequenceCommitted()
+	assert.NoError(err)
+	assert.Equal(2, sequenced)
+
+	events, err := store.GetBalanceEventsAfter([]string{"2", "3"}, nil, 0, 10, nil)
+	assert.NoError(err)
+	if assert.Len(events, 2) {
+		assert.Equal(uint64(1), *events[0].Sequence)
+		assert.Equal("3", events[1].AggregateId)
+	}
+
+	// already sequenced events keep their sequence.
+	sequenced, err = s.SequenceCommitted()
+	assert.NoError(err)
+	assert.Equal(0, sequenced)
+	last, err := store.GetLastSequence(nil)
+	assert.NoError(err)
+	assert.Equal(uint64(2), last)
+}
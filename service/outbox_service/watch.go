@@ -0,0 +1,139 @@
+package outbox_service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/thoas/go-funk"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/config"
+)
+
+const (
+	// MaxWatchedBooks is the max number of books a single watch can subscribe to.
+	MaxWatchedBooks = 100
+	// watchBatchSize is how many events are read per poll.
+	watchBatchSize           = 500
+	defaultWatchPollInterval = 500 * time.Millisecond
+)
+
+var ErrInvalidWatch = errors.New("invalid balance watch")
+
+// BalanceUpdate is a change of a single balance, Sequence is the sequence of the balance.changed event.
+type BalanceUpdate struct {
+	Sequence      uint64    `json:"sequence"`
+	BookId        string    `json:"bookId"`
+	AssetId       string    `json:"assetId"`
+	OperationType string    `json:"operationType"`
+	Change        string    `json:"change"`
+	Balance       string    `json:"balance"`
+	Source        string    `json:"source"`
+	Memo          string    `json:"memo"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// BalanceWatcher streams the balance changes of a set of books, read from the balance.changed events of the outbox.
+// It works on the Postgres repository, unless another one (ex: models/memory) is set.
+type BalanceWatcher struct {
+	OutboxRepository models.OutboxRepository
+}
+
+// Watch polls the outbox and calls send with every balance change of bookIds (and assetIds, if not empty),
+// in sequence (commit) order, after fromSequence. With fromSequence 0 it starts from the latest change.
+// Changes are sequenced by the EventSequencer, so they show up here after it runs.
+// It returns when ctx is done or send fails.
+func (w *BalanceWatcher) Watch(ctx context.Context, bookIds, assetIds []string, fromSequence uint64, send func(BalanceUpdate) error) error {
+	if len(bookIds) == 0 {
+		return fmt.Errorf("%w: bookIds are required", ErrInvalidWatch)
+	}
+	if len(bookIds) > MaxWatchedBooks {
+		return fmt.Errorf("%w: at most %d books can be watched", ErrInvalidWatch, MaxWatchedBooks)
+	}
+
+	cursor := fromSequence
+	if cursor == 0 {
+		lastSequence, err := w.outbox().GetLastSequence(nil)
+		if err != nil {
+			return err
+		}
+		cursor = lastSequence
+	}
+
+	interval := config.GetLedgerSetting().WatchPollInterval
+	if interval <= 0 {
+		interval = defaultWatchPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		events, err := w.outbox().GetBalanceEventsAfter(bookIds, assetIds, cursor, watchBatchSize, nil)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			for _, update := range balanceUpdates(event, bookIds, assetIds) {
+				if err = send(update); err != nil {
+					return err
+				}
+			}
+			cursor = *event.Sequence
+		}
+
+		// read the next batch right away if this one was full.
+		if len(events) == watchBatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// balanceUpdates returns the changes of a balance.changed event, one per operationType, if the event is of a
+// watched book and asset. Other events give none.
+func balanceUpdates(event models.OutboxEvent, bookIds, assetIds []string) []BalanceUpdate {
+	if event.EventType != models.EventBalanceChanged || event.Sequence == nil || !funk.ContainsString(bookIds, event.AggregateId) {
+		return nil
+	}
+	payload := models.BalanceChangedPayload{}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return nil
+	}
+	if len(assetIds) > 0 && !funk.ContainsString(assetIds, payload.AssetId) {
+		return nil
+	}
+
+	var operationTypes []string
+	for operationType := range payload.Changes {
+		operationTypes = append(operationTypes, operationType)
+	}
+	sort.Strings(operationTypes)
+
+	updates := make([]BalanceUpdate, 0, len(operationTypes))
+	for _, operationType := range operationTypes {
+		updates = append(updates, BalanceUpdate{
+			Sequence:      *event.Sequence,
+			BookId:        payload.BookId,
+			AssetId:       payload.AssetId,
+			OperationType: operationType,
+			Change:        payload.Changes[operationType],
+			Balance:       payload.Balances[operationType],
+			Source:        payload.Source,
+			Memo:          payload.Memo,
+			CreatedAt:     event.CreatedAt,
+		})
+	}
+	return updates
+}
@@ -0,0 +1,43 @@
+package outbox_service
+
+import (
+	"testing"
+
+	asrt "github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+
+	"general_ledger_golang/models"
+)
+
+func TestBalanceUpdates(t *testing.T) {
+	assert := asrt.New(t)
+
+	sequence := uint64(5)
+	event := models.OutboxEvent{
+		Model:       models.Model{Id: 7},
+		Sequence:    &sequence,
+		EventType:   models.EventBalanceChanged,
+		AggregateId: "3",
+		Payload: datatypes.JSON(`{"bookId":"3","assetId":"btc","changes":{"OVERALL":"-1","HELD":"1"},` +
+			`"balances":{"OVERALL":"4","HELD":"1"},"source":"hold","memo":"hold-1"}`),
+	}
+
+	updates := balanceUpdates(event, []string{"3", "4"}, nil)
+	if assert.Len(updates, 2) {
+		assert.Equal(BalanceUpdate{Sequence: 5, BookId: "3", AssetId: "btc", OperationType: "HELD", Change: "1", Balance: "1", Source: "hold", Memo: "hold-1"}, updates[0])
+		assert.Equal("OVERALL", updates[1].OperationType)
+		assert.Equal("4", updates[1].Balance)
+	}
+
+	assert.Len(balanceUpdates(event, []string{"3"}, []string{"btc"}), 2)
+	assert.Len(balanceUpdates(event, []string{"3"}, []string{"eth"}), 0)
+	assert.Len(balanceUpdates(event, []string{"4"}, nil), 0)
+
+	event.EventType = models.EventOperationApplied
+	assert.Len(balanceUpdates(event, []string{"3"}, nil), 0)
+
+	// not sequenced yet.
+	event.EventType = models.EventBalanceChanged
+	event.Sequence = nil
+	assert.Len(balanceUpdates(event, []string{"3"}, nil), 0)
+}
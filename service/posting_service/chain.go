@@ -0,0 +1,73 @@
+package posting_service
+
+import (
+	"general_ledger_golang/models"
+)
+
+// chainPageSize is how many postings are read per query while walking the chain.
+const chainPageSize = 1000
+
+// ChainReport is the outcome of walking the hash chain of a book (or of every book, BookId empty).
+// FirstBrokenPostingId is the id of the first posting whose link doesn't verify, 0 if the chain is valid.
+type ChainReport struct {
+	BookId               string `json:"bookId"`
+	Checked              int    `json:"checked"`
+	Valid                bool   `json:"valid"`
+	FirstBrokenPostingId uint64 `json:"firstBrokenPostingId,omitempty"`
+	Reason               string `json:"reason,omitempty"`
+}
+
+// VerifyChain walks the postings of the book (every book, if bookId is empty) in id order, and checks that every
+// posting's PrevHash is the Hash of the previous posting of its book, and that its Hash matches its content.
+// It stops at the first broken link. Postings created before the chain was introduced (empty Hash) are skipped,
+// as long as those come before the chained ones of their book.
+func (p *PostingService) VerifyChain(bookId string) (ChainReport, error) {
+	report := ChainReport{BookId: bookId, Valid: true}
+	// lastHash of every book seen so far, a book is in it once its first chained posting is seen.
+	lastHash := map[string]string{}
+
+	var afterId uint64
+	for {
+		postings, err := p.PostingRepository.GetChainPage(bookId, afterId, chainPageSize, nil)
+		if err != nil {
+			return report, err
+		}
+
+		for _, posting := range postings {
+			report.Checked++
+			if reason := verifyLink(posting, lastHash); reason != "" {
+				report.Valid = false
+				report.FirstBrokenPostingId = posting.Id
+				report.Reason = reason
+				return report, nil
+			}
+		}
+
+		if len(postings) < chainPageSize {
+			return report, nil
+		}
+		afterId = postings[len(postings)-1].Id
+	}
+}
+
+// verifyLink checks a single posting against the last hash of its book, and moves the book's chain forward.
+func verifyLink(posting models.Posting, lastHash map[string]string) string {
+	prevHash, chained := lastHash[posting.BookId]
+
+	if posting.Hash == "" {
+		if chained {
+			return "hash is empty, after the chain of the book started"
+		}
+		// legacy posting.
+		return ""
+	}
+	if posting.PrevHash != prevHash {
+		return "prevHash doesn't match the hash of the previous posting of the book, a posting is missing or modified"
+	}
+	if models.PostingHash(posting) != posting.Hash {
+		return "hash doesn't match the posting's content, the posting is modified"
+	}
+
+	lastHash[posting.BookId] = posting.Hash
+	return ""
+}
@@ -0,0 +1,75 @@
+package posting_service
+
+import (
+	"testing"
+	"time"
+
+	asrt "github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+
+	"general_ledger_golang/models"
+)
+
+// chain links the postings in order, the same way BulkCreatePosting does.
+func chain(postings []models.Posting) []models.Posting {
+	lastHash := map[string]string{}
+	for i := range postings {
+		postings[i].PrevHash = lastHash[postings[i].BookId]
+		postings[i].Hash = models.PostingHash(postings[i])
+		lastHash[postings[i].BookId] = postings[i].Hash
+	}
+	return postings
+}
+
+func verify(postings []models.Posting) (uint64, string) {
+	lastHash := map[string]string{}
+	for _, posting := range postings {
+		if reason := verifyLink(posting, lastHash); reason != "" {
+			return posting.Id, reason
+		}
+	}
+	return 0, ""
+}
+
+func TestVerifyLink(t *testing.T) {
+	assert := asrt.New(t)
+
+	createdAt := time.Date(2023, 10, 17, 7, 41, 55, 123456000, time.UTC)
+	newPostings := func() []models.Posting {
+		legacy := models.Posting{Model: models.Model{Id: 1, CreatedAt: createdAt}, OperationId: "1", BookId: "3", AssetId: "btc", Value: "2"}
+		chained := chain([]models.Posting{
+			{Model: models.Model{Id: 2, CreatedAt: createdAt}, OperationId: "2", BookId: "3", AssetId: "btc", Value: "-1", Metadata: datatypes.JSON(`{"operation":"TRADE","a":1}`)},
+			{Model: models.Model{Id: 3, CreatedAt: createdAt}, OperationId: "2", BookId: "4", AssetId: "btc", Value: "1", Metadata: datatypes.JSON(`{"operation":"TRADE","a":1}`)},
+			{Model: models.Model{Id: 4, CreatedAt: createdAt}, OperationId: "3", BookId: "3", AssetId: "btc", Value: "-0.5"},
+		})
+		return append([]models.Posting{legacy}, chained...)
+	}
+
+	id, reason := verify(newPostings())
+	assert.Equal(uint64(0), id, reason)
+
+	// same content, read back from the db: metadata keys reordered and createdAt in another timezone.
+	postings := newPostings()
+	postings[1].Metadata = datatypes.JSON(`{"a": 1, "operation": "TRADE"}`)
+	postings[1].CreatedAt = createdAt.In(time.FixedZone("Asia/Shanghai", 8*60*60))
+	id, reason = verify(postings)
+	assert.Equal(uint64(0), id, reason)
+
+	postings = newPostings()
+	postings[1].Value = "-2"
+	id, reason = verify(postings)
+	assert.Equal(uint64(2), id)
+	assert.Contains(reason, "content")
+
+	// deleting a posting breaks the link of the next one of the same book.
+	postings = newPostings()
+	postings = append(postings[:1], postings[2:]...)
+	id, reason = verify(postings)
+	assert.Equal(uint64(4), id)
+	assert.Contains(reason, "prevHash")
+
+	postings = newPostings()
+	postings[3].Hash = ""
+	id, _ = verify(postings)
+	assert.Equal(uint64(4), id)
+}
@@ -0,0 +1,61 @@
+package posting_service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/util"
+)
+
+const (
+	DefaultStatementLimit = 50
+	MaxStatementLimit     = 500
+)
+
+var ErrInvalidStatementQuery = errors.New("invalid statement query")
+
+type PostingService struct {
+	PostingRepository models.Posting
+}
+
+// GetStatement returns a page of the book's postings (oldest first) with their running balances,
+// and the cursor for the next page, empty cursor if it's the last page.
+func (p *PostingService) GetStatement(filter models.PostingFilter) ([]map[string]interface{}, string, error) {
+	if filter.BookId == "" {
+		return nil, "", fmt.Errorf("%w: bookId is empty", ErrInvalidStatementQuery)
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, "", fmt.Errorf("%w: from should be before to", ErrInvalidStatementQuery)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultStatementLimit
+	}
+	if filter.Limit > MaxStatementLimit {
+		filter.Limit = MaxStatementLimit
+	}
+
+	limit := filter.Limit
+	// fetch one extra row, to know if there's a next page.
+	filter.Limit++
+	postings, err := p.PostingRepository.GetStatement(filter, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(postings) > limit {
+		postings = postings[:limit]
+		nextCursor = strconv.FormatUint(postings[limit-1].Id, 10)
+	}
+
+	result := make([]map[string]interface{}, 0, len(postings))
+	for _, posting := range postings {
+		postingMap := util.StructToJSON(posting)
+		// canonical decimal string, same as balances.
+		postingMap["runningBalance"] = posting.RunningBalance.String()
+		result = append(result, postingMap)
+	}
+	return result, nextCursor, nil
+}
@@ -0,0 +1,178 @@
+package reconcile_service
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/pkg/logger"
+)
+
+// Drift is a balance which doesn't match what its postings (and holds) say it should be.
+// Actual is null if the balance row is missing.
+type Drift struct {
+	BookId        string              `json:"bookId"`
+	AssetId       string              `json:"assetId"`
+	OperationType string              `json:"operationType"`
+	Actual        decimal.NullDecimal `json:"actual"`
+	Expected      decimal.Decimal     `json:"expected"`
+}
+
+type Report struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	Checked   int       `json:"checked"`
+	Drifts    []Drift   `json:"drifts"`
+	Fixed     bool      `json:"fixed"`
+}
+
+type ReconcileService struct {
+	BookBalanceRepository models.BookBalance
+	PostingRepository     models.Posting
+	HoldRepository        models.Hold
+}
+
+// Reconcile recomputes every balance from the postings and the active holds, and reports the drifts:
+//   - OVERALL is the sum of all the postings of the book and asset, minus the amount held by active holds.
+//   - HELD is the amount held by active holds.
+//   - any other operationType is the sum of the postings of operations with that metadata["operation"].
+//
+// With fix, the drifted balances are overwritten with the expected ones, in the same transaction.
+// book_balances is locked meanwhile, so no balance changes between the check and the fix.
+func (r *ReconcileService) Reconcile(fix bool) (*Report, error) {
+	db, _ := models.GetDB()
+	report := &Report{CheckedAt: time.Now().UTC(), Drifts: []Drift{}}
+
+	txOptions := &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: !fix}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if fix {
+			// blocks balance changes (operations, holds) until the fix commits, reads are still allowed.
+			if err := tx.Exec("LOCK TABLE book_balances IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+				return err
+			}
+		}
+
+		actual, err := r.BookBalanceRepository.GetAllBalances(tx)
+		if err != nil {
+			return err
+		}
+		postingSums, err := r.PostingRepository.SumPostings(tx)
+		if err != nil {
+			return err
+		}
+		held, err := r.HoldRepository.SumHeld(tx)
+		if err != nil {
+			return err
+		}
+
+		report.Checked, report.Drifts = findDrifts(actual, postingSums, held, models.IsBalanceTracked)
+		if !fix || len(report.Drifts) < 1 {
+			return nil
+		}
+
+		for _, drift := range report.Drifts {
+			logger.Logger.Warnf("Fixing balance drift: %+v", drift)
+			err = r.BookBalanceRepository.SetBalance(models.BookBalance{
+				BookId:        drift.BookId,
+				AssetId:       drift.AssetId,
+				OperationType: drift.OperationType,
+				Balance:       drift.Expected,
+			}, tx)
+			if err != nil {
+				return err
+			}
+		}
+		report.Fixed = true
+		return nil
+	}, txOptions)
+
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+type balanceKey struct {
+	bookId, assetId, operationType string
+}
+
+// findDrifts compares the actual balances with the ones expected from the posting sums (per operation type)
+// and the held amounts. Missing rows are expected only for books whose balance is tracked, and only if non-zero.
+// Returns the number of balances checked and the drifts, sorted by bookId, assetId and operationType.
+func findDrifts(actual, postingSums, held []models.BookBalance, isTracked func(bookId string) bool) (int, []Drift) {
+	byType := map[balanceKey]decimal.Decimal{}
+	overall := map[balanceKey]decimal.Decimal{}
+	for _, sum := range postingSums {
+		byType[balanceKey{sum.BookId, sum.AssetId, sum.OperationType}] = sum.Balance
+		k := balanceKey{sum.BookId, sum.AssetId, models.OverallOperation}
+		overall[k] = overall[k].Add(sum.Balance)
+	}
+	heldByBook := map[balanceKey]decimal.Decimal{}
+	for _, h := range held {
+		heldByBook[balanceKey{h.BookId, h.AssetId, models.HeldOperation}] = h.Balance
+	}
+
+	expectedOf := func(k balanceKey) decimal.Decimal {
+		heldAmount := heldByBook[balanceKey{k.bookId, k.assetId, models.HeldOperation}]
+		switch k.operationType {
+		case models.OverallOperation:
+			return overall[k].Sub(heldAmount)
+		case models.HeldOperation:
+			return heldAmount
+		default:
+			return byType[k]
+		}
+	}
+
+	actualByKey := map[balanceKey]decimal.Decimal{}
+	for _, balance := range actual {
+		actualByKey[balanceKey{balance.BookId, balance.AssetId, balance.OperationType}] = balance.Balance
+	}
+
+	keys := map[balanceKey]bool{}
+	for k := range actualByKey {
+		keys[k] = true
+	}
+	for k := range overall {
+		if isTracked(k.bookId) {
+			keys[k] = true
+		}
+	}
+	for k := range heldByBook {
+		keys[k] = true
+		keys[balanceKey{k.bookId, k.assetId, models.OverallOperation}] = true
+	}
+
+	drifts := []Drift{}
+	for k := range keys {
+		expected := expectedOf(k)
+		actualBalance, ok := actualByKey[k]
+		if ok && actualBalance.Equal(expected) {
+			continue
+		}
+		if !ok && expected.IsZero() {
+			continue
+		}
+		drifts = append(drifts, Drift{
+			BookId:        k.bookId,
+			AssetId:       k.assetId,
+			OperationType: k.operationType,
+			Actual:        decimal.NullDecimal{Decimal: actualBalance, Valid: ok},
+			Expected:      expected,
+		})
+	}
+
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].BookId != drifts[j].BookId {
+			return drifts[i].BookId < drifts[j].BookId
+		}
+		if drifts[i].AssetId != drifts[j].AssetId {
+			return drifts[i].AssetId < drifts[j].AssetId
+		}
+		return drifts[i].OperationType < drifts[j].OperationType
+	})
+	return len(keys), drifts
+}
@@ -0,0 +1,50 @@
+package reconcile_service
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	asrt "github.com/stretchr/testify/assert"
+
+	"general_ledger_golang/models"
+)
+
+func balance(bookId, assetId, operationType, value string) models.BookBalance {
+	return models.BookBalance{BookId: bookId, AssetId: assetId, OperationType: operationType, Balance: decimal.RequireFromString(value)}
+}
+
+func TestFindDrifts(t *testing.T) {
+	assert := asrt.New(t)
+
+	postingSums := []models.BookBalance{
+		balance("3", "btc", "BLOCK", "2"),
+		balance("3", "btc", "TRADE", "1"),
+		balance("4", "btc", "BLOCK", "-3"),
+		balance("5", "inr", "DEPOSIT", "100"),
+	}
+	held := []models.BookBalance{
+		balance("3", "btc", models.HeldOperation, "0.5"),
+	}
+	actual := []models.BookBalance{
+		balance("3", "btc", models.OverallOperation, "2.5"), // matches: 2 + 1 - 0.5
+		balance("3", "btc", models.HeldOperation, "0.5"),
+		balance("3", "btc", "BLOCK", "1"),                  // drifted, postings say 2
+		balance("4", "btc", models.OverallOperation, "-3"), // matches
+		// book 5 OVERALL is missing
+	}
+	isTracked := func(bookId string) bool { return bookId != "4" }
+
+	checked, drifts := findDrifts(actual, postingSums, held, isTracked)
+	assert.Equal(5, checked)
+	assert.Len(drifts, 2)
+
+	assert.Equal("3", drifts[0].BookId)
+	assert.Equal("BLOCK", drifts[0].OperationType)
+	assert.True(drifts[0].Actual.Valid)
+	assert.True(drifts[0].Expected.Equal(decimal.RequireFromString("2")))
+
+	assert.Equal("5", drifts[1].BookId)
+	assert.Equal(models.OverallOperation, drifts[1].OperationType)
+	assert.False(drifts[1].Actual.Valid)
+	assert.True(drifts[1].Expected.Equal(decimal.RequireFromString("100")))
+}
@@ -0,0 +1,234 @@
+package report_service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"general_ledger_golang/models"
+)
+
+const (
+	// GroupByAccountType groups the balance sheet by the books' account type.
+	GroupByAccountType = "accountType"
+	// GroupByMetadataPrefix followed by a key groups the balance sheet by that key of the books' metadata.
+	GroupByMetadataPrefix = "metadata."
+	// UngroupedGroup is the group of books without an account type, or without the metadata key.
+	UngroupedGroup = "UNGROUPED"
+)
+
+var ErrInvalidReportQuery = errors.New("invalid report query")
+
+// TrialBalanceRow is a book's totals for an asset. Balance is the net of the totals,
+// on the side (BalanceSide) where it's bigger.
+type TrialBalanceRow struct {
+	BookId      string          `json:"bookId"`
+	Name        string          `json:"name"`
+	AccountType string          `json:"accountType"`
+	NormalSide  string          `json:"normalSide"`
+	Debit       decimal.Decimal `json:"debit"`
+	Credit      decimal.Decimal `json:"credit"`
+	Balance     decimal.Decimal `json:"balance"`
+	BalanceSide string          `json:"balanceSide"`
+}
+
+// AssetTrialBalance is the trial balance of an asset, Balanced tells if the debits and credits of all books net to zero.
+type AssetTrialBalance struct {
+	AssetId     string            `json:"assetId"`
+	Rows        []TrialBalanceRow `json:"rows"`
+	TotalDebit  decimal.Decimal   `json:"totalDebit"`
+	TotalCredit decimal.Decimal   `json:"totalCredit"`
+	Balanced    bool              `json:"balanced"`
+}
+
+type TrialBalance struct {
+	AsOf     time.Time           `json:"asOf"`
+	Assets   []AssetTrialBalance `json:"assets"`
+	Balanced bool                `json:"balanced"`
+}
+
+// BalanceSheetGroup is the totals of a group of books. For account type groups, Balance is on the
+// account type's normal side (ex: debit - credit for assets), for other groups it's credit - debit.
+type BalanceSheetGroup struct {
+	Group   string          `json:"group"`
+	Books   int             `json:"books"`
+	Debit   decimal.Decimal `json:"debit"`
+	Credit  decimal.Decimal `json:"credit"`
+	Balance decimal.Decimal `json:"balance"`
+}
+
+type AssetBalanceSheet struct {
+	AssetId string              `json:"assetId"`
+	Groups  []BalanceSheetGroup `json:"groups"`
+	// Balanced tells if the debits and credits of all groups net to zero, for account type groups, it's
+	// ASSET + EXPENSE = LIABILITY + EQUITY + REVENUE.
+	Balanced bool `json:"balanced"`
+}
+
+type BalanceSheet struct {
+	AsOf     time.Time           `json:"asOf"`
+	GroupBy  string              `json:"groupBy"`
+	Assets   []AssetBalanceSheet `json:"assets"`
+	Balanced bool                `json:"balanced"`
+}
+
+type ReportService struct {
+	PostingRepository models.Posting
+}
+
+// GetTrialBalance returns the debit and credit totals of every book's postings, created till asOf (now, if nil),
+// of assetId (every asset, if empty), per asset.
+func (r *ReportService) GetTrialBalance(asOf *time.Time, assetId string) (*TrialBalance, error) {
+	at := reportTime(asOf)
+	totals, err := r.PostingRepository.SumBookTotals(&at, assetId, nil)
+	if err != nil {
+		return nil, err
+	}
+	return buildTrialBalance(at, totals), nil
+}
+
+// GetBalanceSheet returns the totals of the books' postings grouped by account type (default),
+// or by a metadata key (groupBy "metadata.<key>"), per asset.
+func (r *ReportService) GetBalanceSheet(asOf *time.Time, assetId, groupBy string) (*BalanceSheet, error) {
+	if groupBy == "" {
+		groupBy = GroupByAccountType
+	}
+	if groupBy != GroupByAccountType && (!strings.HasPrefix(groupBy, GroupByMetadataPrefix) || groupBy == GroupByMetadataPrefix) {
+		return nil, fmt.Errorf("%w: groupBy should be %s or %s<key>", ErrInvalidReportQuery, GroupByAccountType, GroupByMetadataPrefix)
+	}
+
+	at := reportTime(asOf)
+	totals, err := r.PostingRepository.SumBookTotals(&at, assetId, nil)
+	if err != nil {
+		return nil, err
+	}
+	return buildBalanceSheet(at, groupBy, totals), nil
+}
+
+func reportTime(asOf *time.Time) time.Time {
+	if asOf != nil {
+		return asOf.UTC()
+	}
+	return time.Now().UTC()
+}
+
+// buildTrialBalance builds the trial balance from the book totals, which are sorted by assetId, bookId.
+func buildTrialBalance(asOf time.Time, totals []models.BookTotal) *TrialBalance {
+	report := &TrialBalance{AsOf: asOf, Assets: []AssetTrialBalance{}, Balanced: true}
+
+	for _, total := range totals {
+		if len(report.Assets) == 0 || report.Assets[len(report.Assets)-1].AssetId != total.AssetId {
+			report.Assets = append(report.Assets, AssetTrialBalance{AssetId: total.AssetId, Rows: []TrialBalanceRow{}})
+		}
+		asset := &report.Assets[len(report.Assets)-1]
+
+		row := TrialBalanceRow{
+			BookId:      total.BookId,
+			Name:        total.Name,
+			AccountType: total.AccountType,
+			NormalSide:  total.NormalSide,
+			Debit:       total.Debit,
+			Credit:      total.Credit,
+			Balance:     total.Credit.Sub(total.Debit).Abs(),
+			BalanceSide: string(models.NormalCredit),
+		}
+		if total.Debit.GreaterThan(total.Credit) {
+			row.BalanceSide = string(models.NormalDebit)
+		}
+		asset.Rows = append(asset.Rows, row)
+		asset.TotalDebit = asset.TotalDebit.Add(total.Debit)
+		asset.TotalCredit = asset.TotalCredit.Add(total.Credit)
+	}
+
+	for i := range report.Assets {
+		report.Assets[i].Balanced = report.Assets[i].TotalDebit.Equal(report.Assets[i].TotalCredit)
+		report.Balanced = report.Balanced && report.Assets[i].Balanced
+	}
+	return report
+}
+
+// buildBalanceSheet builds the balance sheet from the book totals, which are sorted by assetId, bookId.
+// Account type groups are in chart of accounts order, other groups are sorted by name, ungrouped books last.
+func buildBalanceSheet(asOf time.Time, groupBy string, totals []models.BookTotal) *BalanceSheet {
+	report := &BalanceSheet{AsOf: asOf, GroupBy: groupBy, Assets: []AssetBalanceSheet{}, Balanced: true}
+
+	groupsOfAsset := map[string]map[string]*BalanceSheetGroup{}
+	var assetIds []string
+	for _, total := range totals {
+		groups, ok := groupsOfAsset[total.AssetId]
+		if !ok {
+			groups = map[string]*BalanceSheetGroup{}
+			groupsOfAsset[total.AssetId] = groups
+			assetIds = append(assetIds, total.AssetId)
+		}
+
+		name := groupOf(total, groupBy)
+		group, ok := groups[name]
+		if !ok {
+			group = &BalanceSheetGroup{Group: name}
+			groups[name] = group
+		}
+		group.Books++
+		group.Debit = group.Debit.Add(total.Debit)
+		group.Credit = group.Credit.Add(total.Credit)
+	}
+
+	for _, assetId := range assetIds {
+		asset := AssetBalanceSheet{AssetId: assetId, Groups: []BalanceSheetGroup{}}
+		net := decimal.Zero
+		for _, group := range groupsOfAsset[assetId] {
+			group.Balance = group.Credit.Sub(group.Debit)
+			if groupBy == GroupByAccountType && models.DefaultNormalSide(models.AccountType(group.Group)) == models.NormalDebit {
+				group.Balance = group.Balance.Neg()
+			}
+			net = net.Add(group.Credit).Sub(group.Debit)
+			asset.Groups = append(asset.Groups, *group)
+		}
+		sort.Slice(asset.Groups, func(i, j int) bool {
+			return groupOrder(asset.Groups[i].Group, groupBy) < groupOrder(asset.Groups[j].Group, groupBy)
+		})
+
+		asset.Balanced = net.IsZero()
+		report.Balanced = report.Balanced && asset.Balanced
+		report.Assets = append(report.Assets, asset)
+	}
+	return report
+}
+
+// groupOf returns the group of the book, UngroupedGroup if the book doesn't have the group by field.
+func groupOf(total models.BookTotal, groupBy string) string {
+	if groupBy == GroupByAccountType {
+		if total.AccountType == "" {
+			return UngroupedGroup
+		}
+		return total.AccountType
+	}
+
+	metadata := map[string]interface{}{}
+	_ = json.Unmarshal(total.Metadata, &metadata)
+	value, ok := metadata[strings.TrimPrefix(groupBy, GroupByMetadataPrefix)]
+	if !ok || value == nil {
+		return UngroupedGroup
+	}
+	return fmt.Sprint(value)
+}
+
+// groupOrder is the sort key of a group.
+func groupOrder(group, groupBy string) string {
+	if group == UngroupedGroup {
+		return "\xff"
+	}
+	if groupBy == GroupByAccountType {
+		for i, accountType := range models.AccountTypes {
+			if string(accountType) == group {
+				return fmt.Sprintf("%02d", i)
+			}
+		}
+	}
+	return group
+}
@@ -0,0 +1,100 @@
+package report_service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	asrt "github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+
+	"general_ledger_golang/models"
+)
+
+func total(bookId, accountType, metadata, assetId, debit, credit string) models.BookTotal {
+	return models.BookTotal{
+		BookId:      bookId,
+		AccountType: accountType,
+		Metadata:    datatypes.JSON(metadata),
+		AssetId:     assetId,
+		Debit:       decimal.RequireFromString(debit),
+		Credit:      decimal.RequireFromString(credit),
+	}
+}
+
+// sorted by assetId, bookId, like SumBookTotals.
+var totals = []models.BookTotal{
+	total("1", "ASSET", `{"desk":"treasury"}`, "btc", "10", "4"),
+	total("2", "LIABILITY", `{"desk":"retail"}`, "btc", "1", "5"),
+	total("3", "REVENUE", `{}`, "btc", "0", "0.5"),
+	total("4", "EXPENSE", `{"desk":"retail"}`, "btc", "0.5", "0"),
+	total("1", "ASSET", `{"desk":"treasury"}`, "inr", "100", "0"),
+	total("9", "", `{}`, "inr", "0", "90"),
+}
+
+func TestBuildTrialBalance(t *testing.T) {
+	assert := asrt.New(t)
+
+	report := buildTrialBalance(time.Now(), totals)
+	if !assert.Len(report.Assets, 2) {
+		return
+	}
+
+	btc := report.Assets[0]
+	assert.Equal("btc", btc.AssetId)
+	assert.Len(btc.Rows, 4)
+	assert.Equal("11.5", btc.TotalDebit.String())
+	assert.Equal("9.5", btc.TotalCredit.String())
+	assert.False(btc.Balanced)
+	assert.Equal("6", btc.Rows[0].Balance.String())
+	assert.Equal("DEBIT", btc.Rows[0].BalanceSide)
+	assert.Equal("4", btc.Rows[1].Balance.String())
+	assert.Equal("CREDIT", btc.Rows[1].BalanceSide)
+
+	inr := report.Assets[1]
+	assert.False(inr.Balanced)
+	assert.False(report.Balanced)
+
+	report = buildTrialBalance(time.Now(), []models.BookTotal{
+		total("1", "ASSET", `{}`, "btc", "2", "1"),
+		total("2", "LIABILITY", `{}`, "btc", "0", "1"),
+	})
+	assert.True(report.Balanced)
+
+	assert.True(buildTrialBalance(time.Now(), nil).Balanced)
+}
+
+func TestBuildBalanceSheet(t *testing.T) {
+	assert := asrt.New(t)
+
+	report := buildBalanceSheet(time.Now(), GroupByAccountType, totals[:4])
+	if !assert.Len(report.Assets, 1) {
+		return
+	}
+	groups := report.Assets[0].Groups
+	if assert.Len(groups, 4) {
+		assert.Equal(BalanceSheetGroup{Group: "ASSET", Books: 1, Debit: decimal.RequireFromString("10"), Credit: decimal.RequireFromString("4"), Balance: decimal.RequireFromString("6")}, groups[0])
+		assert.Equal("LIABILITY", groups[1].Group)
+		assert.Equal("4", groups[1].Balance.String())
+		assert.Equal("REVENUE", groups[2].Group)
+		assert.Equal("0.5", groups[2].Balance.String())
+		assert.Equal("EXPENSE", groups[3].Group)
+		assert.Equal("0.5", groups[3].Balance.String())
+	}
+	// 10 - 4 + 0.5 != 4 + 0.5, 2 btc are unaccounted for.
+	assert.False(report.Balanced)
+
+	report = buildBalanceSheet(time.Now(), "metadata.desk", totals[:4])
+	groups = report.Assets[0].Groups
+	if assert.Len(groups, 3) {
+		assert.Equal("retail", groups[0].Group)
+		assert.Equal(2, groups[0].Books)
+		assert.Equal("3.5", groups[0].Balance.String())
+		assert.Equal("treasury", groups[1].Group)
+		assert.Equal(UngroupedGroup, groups[2].Group)
+	}
+
+	report = buildBalanceSheet(time.Now(), GroupByAccountType, totals[4:])
+	assert.Equal(UngroupedGroup, report.Assets[0].Groups[1].Group)
+	assert.False(report.Balanced)
+}
@@ -0,0 +1,31 @@
+package integration_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"general_ledger_golang/models"
+	"general_ledger_golang/models/repositorytest"
+	"general_ledger_golang/pkg/config"
+	"general_ledger_golang/pkg/database"
+)
+
+// TestPostgresBalanceAsOf runs the repositorytest scenario against the local database, on a book id no book has.
+func TestPostgresBalanceAsOf(t *testing.T) {
+	_ = godotenv.Load("../../.env")
+	config.Setup("../../pkg/config/")
+	database.Setup()
+	models.Setup()
+
+	run := fmt.Sprint(time.Now().UnixNano())
+	repositorytest.BalanceAsOf(t, repositorytest.Repositories{
+		Balances:   &models.BookBalance{},
+		Operations: &models.Operation{},
+		Postings:   &models.Posting{},
+		Holds:      &models.Hold{},
+		Transactor: models.DBTransactor{},
+	}, run, "1", run)
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/joho/godotenv"
+	"github.com/shopspring/decimal"
 	asrt "github.com/stretchr/testify/assert"
 
 	"general_ledger_golang/models"
@@ -16,19 +17,12 @@ import (
 func TestQueryGeneration(t *testing.T) {
 	assert := asrt.New(t)
 	t.Run("Test_Bulk_Query_Generation", func(t *testing.T) {
-		entries := []interface{}{
-			map[string]interface{}{
-				"bookId":  "4112314",
-				"assetId": "inr",
-				"value":   "20000"},
-			map[string]interface{}{
-				"bookId":  "4112313",
-				"assetId": "inr",
-				"value":   "-20000",
-			}}
+		entries := []models.Entry{
+			{BookId: "4112314", AssetId: "inr", Value: decimal.RequireFromString("20000")},
+			{BookId: "4112313", AssetId: "inr", Value: decimal.RequireFromString("-20000")},
+		}
 		logger.Logger.Infof("Entries: %+v", entries)
-		metadata := map[string]interface{}{"operation": "DEPOSIT"}
-		q, p, e := models.GenerateBulkUpsertQuery(entries, metadata)
+		q, p, e := models.GenerateBulkUpsertQuery(entries, "DEPOSIT")
 		assert.Nil(e)
 		assert.NotEqual("", p, "Params slice should not be empty")
 		assert.Len(p[0], len(entries))
@@ -39,19 +33,12 @@ func TestQueryGeneration(t *testing.T) {
 		//logger.Logger.Printf("Params: %+v", p)
 	})
 	t.Run("Test_Upsert_Query_Generation", func(t *testing.T) {
-		entries := []interface{}{
-			map[string]interface{}{
-				"bookId":  "4112314",
-				"assetId": "inr",
-				"value":   "20000"},
-			map[string]interface{}{
-				"bookId":  "4112313",
-				"assetId": "inr",
-				"value":   "-20000",
-			}}
+		entries := []models.Entry{
+			{BookId: "4112314", AssetId: "inr", Value: decimal.RequireFromString("20000")},
+			{BookId: "4112313", AssetId: "inr", Value: decimal.RequireFromString("-20000")},
+		}
 		logger.Logger.Infof("Entries: %+v", entries)
-		metadata := map[string]interface{}{"operation": "DEPOSIT"}
-		q, p, e := models.GenerateUpsertCteQuery(entries, metadata)
+		q, p, e := models.GenerateUpsertCteQuery(entries, "DEPOSIT")
 		assert.Nil(e)
 		assert.NotEqual("", p, "Params slice should not be empty")
 		logger.Logger.Printf("Query: %+v", strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(strings.Join(q, "\n"), "\t", ""), "\n", ""), "\\", ""))
@@ -75,3 +62,20 @@ func TestConfig(t *testing.T) {
 	assert.Equal(c.AppSetting.JwtSecret, "usx1957-213123123123-12312sa7687-23424")
 	assert.Equal(c.RedisSetting.Host, "127.0.0.1:6379")
 }
+
+func TestServerSettingString(t *testing.T) {
+	assert := asrt.New(t)
+	server := config.Server{
+		RunMode:               "debug",
+		HttpPort:              8000,
+		ServiceTokenWhitelist: map[string]map[string]string{"user_module": {"read": "abc", "write": "cde"}},
+		ServiceScopes:         map[string]config.ServiceScope{"user_module": {Permissions: []string{"books:write"}}},
+	}
+
+	logged := fmt.Sprintf("%+v", server)
+	assert.Contains(logged, "HttpPort:8000")
+	assert.Contains(logged, "user_module(2 tokens)")
+	assert.NotContains(logged, "abc")
+	assert.NotContains(logged, "cde")
+	assert.NotContains(logged, "books:write")
+}
@@ -22,3 +22,20 @@ func TestIncludes(t *testing.T) {
 		assert.Equal(notOk, false)
 	})
 }
+
+func TestParseCursor(t *testing.T) {
+	assert := asrt.New(t)
+
+	id, err := util.ParseCursor("")
+	assert.Nil(err)
+	assert.Equal(uint64(0), id, "empty cursor is the first page")
+
+	id, err = util.ParseCursor("18446744073709551615")
+	assert.Nil(err)
+	assert.Equal(uint64(18446744073709551615), id)
+
+	for _, cursor := range []string{"-1", "abc", "1.5"} {
+		_, err = util.ParseCursor(cursor)
+		assert.ErrorIs(err, util.ErrInvalidCursor, cursor)
+	}
+}